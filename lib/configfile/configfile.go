@@ -0,0 +1,104 @@
+package configfile
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/ShimmerGlass/shimdns/lib/atomicfile"
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	"github.com/ShimmerGlass/shimdns/lib/reload"
+)
+
+// Writer writes generated configuration files for programs that cannot be
+// driven through an API.
+type Writer struct {
+	log    *slog.Logger
+	path   string
+	reload reload.Config
+
+	lastUnsupported string
+	// the file was written but the reload did not succeed yet
+	reloadPending bool
+}
+
+func New(log *slog.Logger, path string, reload reload.Config) (*Writer, error) {
+	if path == "" {
+		return nil, fmt.Errorf("missing path")
+	}
+
+	err := reload.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("reload: %w", err)
+	}
+
+	return &Writer{
+		log:    log,
+		path:   path,
+		reload: reload,
+	}, nil
+}
+
+// Write replaces the file with content and triggers the reload, unless the
+// file already has this content. A failed reload is retried on the next
+// call.
+func (w *Writer) Write(ctx context.Context, content []byte) error {
+	current, err := os.ReadFile(w.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if !bytes.Equal(current, content) {
+		perm := os.FileMode(0o644)
+		if fi, err := os.Stat(w.path); err == nil {
+			perm = fi.Mode().Perm()
+		}
+
+		err = atomicfile.Write(w.path, content, perm)
+		if err != nil {
+			return err
+		}
+
+		w.log.Info("config file updated", "path", w.path)
+		w.reloadPending = true
+	}
+
+	if !w.reloadPending {
+		return nil
+	}
+
+	err = w.reload.Run(ctx)
+	if err != nil {
+		return err
+	}
+
+	w.reloadPending = false
+
+	return nil
+}
+
+// ReportUnsupported logs the records that cannot be expressed in the file,
+// only when they differ from the previous call to avoid repeating the same
+// warning on every run.
+func (w *Writer) ReportUnsupported(recs []dns.Record) {
+	lines := []string{}
+	for _, rec := range recs {
+		lines = append(lines, rec.String())
+	}
+	slices.Sort(lines)
+
+	key := strings.Join(lines, "\n")
+	if key == w.lastUnsupported {
+		return
+	}
+	w.lastUnsupported = key
+
+	for _, rec := range recs {
+		w.log.Warn("record not supported, skipping", "record", rec)
+	}
+}
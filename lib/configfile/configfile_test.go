@@ -0,0 +1,34 @@
+package configfile
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ShimmerGlass/shimdns/lib/reload"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloadRetried(t *testing.T) {
+	dir := t.TempDir()
+	ready := filepath.Join(dir, "ready")
+	reloads := filepath.Join(dir, "reloads")
+
+	w, err := New(slog.Default(), filepath.Join(dir, "config"), reload.Config{
+		Command: "test -f " + ready + " && echo >> " + reloads,
+	})
+	require.NoError(t, err)
+
+	require.Error(t, w.Write(context.Background(), []byte("content\n")))
+
+	// the file is already up to date, the reload is still retried
+	require.NoError(t, os.WriteFile(ready, nil, 0o600))
+	require.NoError(t, w.Write(context.Background(), []byte("content\n")))
+	require.NoError(t, w.Write(context.Background(), []byte("content\n")))
+
+	reloaded, err := os.ReadFile(reloads)
+	require.NoError(t, err)
+	require.Equal(t, "\n", string(reloaded))
+}
@@ -0,0 +1,115 @@
+package dns
+
+import (
+	"net"
+	"net/netip"
+
+	dnssrv "github.com/miekg/dns"
+)
+
+// RR converts the record to a resource record with the given TTL. It
+// returns false for record types with no wire representation.
+func (r Record) RR(ttl uint32) (dnssrv.RR, bool) {
+	hdr := func(t uint16) dnssrv.RR_Header {
+		return dnssrv.RR_Header{
+			Name:   r.Name,
+			Rrtype: t,
+			Class:  dnssrv.ClassINET,
+			Ttl:    ttl,
+		}
+	}
+
+	switch r.Type {
+	case A:
+		return &dnssrv.A{
+			Hdr: hdr(dnssrv.TypeA),
+			A:   net.IP(r.Address.AsSlice()),
+		}, true
+
+	case AAAA:
+		return &dnssrv.AAAA{
+			Hdr:  hdr(dnssrv.TypeAAAA),
+			AAAA: net.IP(r.Address.AsSlice()),
+		}, true
+
+	case PTR:
+		return &dnssrv.PTR{
+			Hdr: hdr(dnssrv.TypePTR),
+			Ptr: r.Ptr,
+		}, true
+
+	case CNAME:
+		return &dnssrv.CNAME{
+			Hdr:    hdr(dnssrv.TypeCNAME),
+			Target: r.Target,
+		}, true
+
+	case SRV:
+		return &dnssrv.SRV{
+			Hdr:      hdr(dnssrv.TypeSRV),
+			Priority: r.Priority,
+			Weight:   r.Weight,
+			Port:     r.Port,
+			Target:   r.Target,
+		}, true
+
+	case MX:
+		return &dnssrv.MX{
+			Hdr:        hdr(dnssrv.TypeMX),
+			Preference: r.Preference,
+			Mx:         r.Mx,
+		}, true
+
+	default:
+		return nil, false
+	}
+}
+
+// FromRR converts a resource record to a record. It returns false for
+// unsupported types.
+func FromRR(rr dnssrv.RR) (Record, bool) {
+	rec := Record{Name: rr.Header().Name}
+
+	switch rr := rr.(type) {
+	case *dnssrv.A:
+		addr, ok := netip.AddrFromSlice(rr.A.To4())
+		if !ok {
+			return Record{}, false
+		}
+		rec.Type = A
+		rec.Address = addr
+
+	case *dnssrv.AAAA:
+		addr, ok := netip.AddrFromSlice(rr.AAAA.To16())
+		if !ok {
+			return Record{}, false
+		}
+		rec.Type = AAAA
+		rec.Address = addr
+
+	case *dnssrv.PTR:
+		rec.Type = PTR
+		rec.Ptr = rr.Ptr
+
+	case *dnssrv.CNAME:
+		rec.Type = CNAME
+		rec.Target = rr.Target
+
+	case *dnssrv.SRV:
+		rec.Type = SRV
+		rec.Priority = rr.Priority
+		rec.Weight = rr.Weight
+		rec.Port = rr.Port
+		rec.Target = rr.Target
+
+	case *dnssrv.MX:
+		rec.Type = MX
+		rec.Preference = rr.Preference
+		rec.Mx = rr.Mx
+
+	default:
+		return Record{}, false
+	}
+
+	return rec, true
+}
@@ -0,0 +1,97 @@
+package reload
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultTimeout = 30 * time.Second
+
+// Config describes how to tell a program its configuration changed.
+type Config struct {
+	// shell command, ie. "rndc reload lan"
+	Command string        `yaml:"command"`
+	Timeout time.Duration `yaml:"timeout"`
+
+	// signal name, ie. "HUP", sent to PID or to the pid read from PIDFile
+	Signal  string `yaml:"signal"`
+	PID     int    `yaml:"pid"`
+	PIDFile string `yaml:"pid_file"`
+}
+
+func (c Config) Validate() error {
+	if c.Signal == "" {
+		return nil
+	}
+
+	_, err := lookupSignal(c.Signal)
+	if err != nil {
+		return err
+	}
+
+	if c.PID == 0 && c.PIDFile == "" {
+		return fmt.Errorf("signal requires pid or pid_file")
+	}
+
+	return nil
+}
+
+// Run runs the reload command and sends the signal, if configured.
+func (c Config) Run(ctx context.Context) error {
+	if c.Command != "" {
+		timeout := c.Timeout
+		if timeout == 0 {
+			timeout = defaultTimeout
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		out, err := exec.CommandContext(ctx, "sh", "-c", c.Command).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("reload command: %w: %s", err, strings.TrimSpace(string(out)))
+		}
+	}
+
+	if c.Signal != "" {
+		err := c.signal()
+		if err != nil {
+			return fmt.Errorf("reload signal: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (c Config) signal() error {
+	sig, err := lookupSignal(c.Signal)
+	if err != nil {
+		return err
+	}
+
+	pid := c.PID
+
+	if c.PIDFile != "" {
+		buf, err := os.ReadFile(c.PIDFile)
+		if err != nil {
+			return err
+		}
+
+		pid, err = strconv.Atoi(strings.TrimSpace(string(buf)))
+		if err != nil {
+			return fmt.Errorf("%s: %w", c.PIDFile, err)
+		}
+	}
+
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+
+	return proc.Signal(sig)
+}
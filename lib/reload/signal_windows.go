@@ -0,0 +1,11 @@
+package reload
+
+import (
+	"fmt"
+	"os"
+)
+
+// processes cannot be signaled on windows, use a reload command instead
+func lookupSignal(name string) (os.Signal, error) {
+	return nil, fmt.Errorf("signal %q: signals are not supported on windows", name)
+}
@@ -11,13 +11,29 @@ import (
 )
 
 type Request struct {
-	URL  string
-	Path string
+	URL   string
+	Path  string
+	Query url.Values
 
 	ExpectEmptyResponse bool
 
 	BasicUser string
 	BasicPass string
+	Headers   map[string]string
+}
+
+// StatusError is returned for responses with an error status code.
+type StatusError struct {
+	Code int
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("bad status code: %d", e.Code)
+	}
+
+	return fmt.Sprintf("bad status code %d: %s", e.Code, e.Body)
 }
 
 func Get[T any](ctx context.Context, r Request) (T, error) {
@@ -28,6 +44,14 @@ func Put[T any](ctx context.Context, body any, r Request) (T, error) {
 	return req[T](ctx, http.MethodPut, r, body)
 }
 
+func Post[T any](ctx context.Context, body any, r Request) (T, error) {
+	return req[T](ctx, http.MethodPost, r, body)
+}
+
+func Patch[T any](ctx context.Context, body any, r Request) (T, error) {
+	return req[T](ctx, http.MethodPatch, r, body)
+}
+
 func Delete[T any](ctx context.Context, body any, r Request) (T, error) {
 	return req[T](ctx, http.MethodDelete, r, body)
 }
@@ -52,20 +76,32 @@ func reqInternal[T any](ctx context.Context, method string, r Request, body any)
 		}
 	}
 
-	url, err := url.JoinPath(r.URL, r.Path)
+	u, err := url.JoinPath(r.URL, r.Path)
 	if err != nil {
 		return data, err
 	}
 
-	req, err := http.NewRequestWithContext(ctx, method, url, buf)
+	if len(r.Query) > 0 {
+		u += "?" + r.Query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, buf)
 	if err != nil {
 		return data, err
 	}
 
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
 	if r.BasicUser != "" {
 		req.SetBasicAuth(r.BasicUser, r.BasicPass)
 	}
 
+	for k, v := range r.Headers {
+		req.Header.Set(k, v)
+	}
+
 	res, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return data, err
@@ -73,15 +109,11 @@ func reqInternal[T any](ctx context.Context, method string, r Request, body any)
 	defer func() { _ = res.Body.Close() }()
 
 	if res.StatusCode >= 400 {
-		body, err := io.ReadAll(res.Body)
-		if err != nil {
-			return data, fmt.Errorf("bad status code: %d", res.StatusCode)
-		}
-
-		return data, fmt.Errorf("bad status code %d: %s", res.StatusCode, string(body))
+		body, _ := io.ReadAll(res.Body)
+		return data, &StatusError{Code: res.StatusCode, Body: string(body)}
 	}
 
-	if !r.ExpectEmptyResponse {
+	if !r.ExpectEmptyResponse && res.StatusCode != http.StatusNoContent {
 		err = json.NewDecoder(res.Body).Decode(&data)
 		if err != nil {
 			return data, err
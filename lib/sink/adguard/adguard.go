@@ -0,0 +1,164 @@
+package adguard
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+)
+
+type AdGuard struct {
+	log *slog.Logger
+	cfg Config
+	api *api
+
+	owned map[string]struct{}
+}
+
+func New(log *slog.Logger, cfg Config) (*AdGuard, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("missing url")
+	}
+
+	if cfg.StateFile == "" {
+		return nil, fmt.Errorf("missing state_file")
+	}
+
+	a := &AdGuard{
+		log:   log.With("sink", "adguard"),
+		cfg:   cfg,
+		api:   newAPI(cfg.URL, cfg.User, cfg.Password),
+		owned: map[string]struct{}{},
+	}
+
+	err := a.loadState()
+	if err != nil {
+		return nil, fmt.Errorf("state: %w", err)
+	}
+
+	return a, nil
+}
+
+func (a *AdGuard) Write(ctx context.Context, records []dns.Record) error {
+	err := a.write(ctx, records)
+	if err != nil {
+		return fmt.Errorf("adguard sink: %w", err)
+	}
+
+	return nil
+}
+
+func (a *AdGuard) write(ctx context.Context, records []dns.Record) error {
+	records, err := a.cfg.Filter.Filter(records)
+	if err != nil {
+		return err
+	}
+
+	desired := rewrites(records)
+
+	current, err := a.api.Rewrites(ctx)
+	if err != nil {
+		return err
+	}
+
+	add, remove := a.changes(current, desired)
+	changed := false
+
+	for _, r := range remove {
+		a.log.Info("removing rewrite", "domain", r.Domain, "answer", r.Answer)
+
+		err := a.api.Delete(ctx, r)
+		if err != nil {
+			return err
+		}
+
+		delete(a.owned, key(r))
+		changed = true
+	}
+
+	for _, r := range add {
+		a.log.Info("adding rewrite", "domain", r.Domain, "answer", r.Answer)
+
+		err := a.api.Add(ctx, r)
+		if err != nil {
+			return err
+		}
+
+		a.owned[key(r)] = struct{}{}
+		changed = true
+	}
+
+	// forget rewrites removed by others
+	for k := range a.owned {
+		if !slices.ContainsFunc(current, func(r rewrite) bool { return key(r) == k }) &&
+			!slices.ContainsFunc(desired, func(r rewrite) bool { return key(r) == k }) {
+			delete(a.owned, k)
+			changed = true
+		}
+	}
+
+	if changed {
+		err := a.saveState()
+		if err != nil {
+			return fmt.Errorf("state: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// rewrites returns the rewrites of records.
+func rewrites(records []dns.Record) []rewrite {
+	res := []rewrite{}
+	for _, rec := range records {
+		r, ok := recordToRewrite(rec)
+		if ok && !slices.Contains(res, r) {
+			res = append(res, r)
+		}
+	}
+
+	return res
+}
+
+// changes returns the rewrites to add and the owned ones to remove, to turn
+// current into desired.
+func (a *AdGuard) changes(current []rewrite, desired []rewrite) ([]rewrite, []rewrite) {
+	add := []rewrite{}
+	remove := []rewrite{}
+
+	for _, r := range current {
+		if _, ok := a.owned[key(r)]; ok && !slices.Contains(desired, r) {
+			remove = append(remove, r)
+		}
+	}
+
+	for _, r := range desired {
+		if !slices.Contains(current, r) {
+			add = append(add, r)
+		}
+	}
+
+	return add, remove
+}
+
+// recordToRewrite returns the rewrite for rec, or false if AdGuard Home
+// cannot express it.
+func recordToRewrite(rec dns.Record) (rewrite, bool) {
+	name := strings.TrimSuffix(rec.Name, ".")
+
+	switch rec.Type {
+	case dns.A, dns.AAAA:
+		return rewrite{Domain: name, Answer: rec.Address.String()}, true
+	case dns.CNAME:
+		return rewrite{Domain: name, Answer: strings.TrimSuffix(rec.Target, ".")}, true
+	default:
+		return rewrite{}, false
+	}
+}
+
+func key(r rewrite) string {
+	return r.Domain + " " + r.Answer
+}
@@ -0,0 +1,136 @@
+package adguard
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"path/filepath"
+	"testing"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	"github.com/stretchr/testify/require"
+)
+
+type testCase struct {
+	Owned   []string
+	Current []rewrite
+	Records []dns.Record
+	Add     []rewrite
+	Remove  []rewrite
+}
+
+var testCases = []testCase{
+	{
+		// records AdGuard Home cannot express are ignored
+		Records: []dns.Record{
+			{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+			{Type: dns.AAAA, Name: "foo.lan.", Address: netip.MustParseAddr("fd00::1")},
+			{Type: dns.CNAME, Name: "www.lan.", Target: "foo.lan."},
+			{Type: dns.PTR, Name: "1.1.168.192.in-addr.arpa.", Ptr: "foo.lan."},
+		},
+		Add: []rewrite{
+			{Domain: "foo.lan", Answer: "192.168.1.1"},
+			{Domain: "foo.lan", Answer: "fd00::1"},
+			{Domain: "www.lan", Answer: "foo.lan"},
+		},
+		Remove: []rewrite{},
+	},
+	{
+		// rewrites not created by the sink are never removed
+		Owned: []string{"foo.lan 192.168.1.1"},
+		Current: []rewrite{
+			{Domain: "manual.lan", Answer: "10.0.0.1"},
+			{Domain: "foo.lan", Answer: "192.168.1.1"},
+		},
+		Records: []dns.Record{
+			{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.2")},
+			{Type: dns.A, Name: "manual.lan.", Address: netip.MustParseAddr("10.0.0.1")},
+		},
+		Add:    []rewrite{{Domain: "foo.lan", Answer: "192.168.1.2"}},
+		Remove: []rewrite{{Domain: "foo.lan", Answer: "192.168.1.1"}},
+	},
+}
+
+func TestChanges(t *testing.T) {
+	for i, tc := range testCases {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			a, err := New(slog.Default(), Config{URL: "http://adguard", StateFile: filepath.Join(t.TempDir(), "state.json")})
+			require.NoError(t, err)
+
+			for _, k := range tc.Owned {
+				a.owned[k] = struct{}{}
+			}
+
+			add, remove := a.changes(tc.Current, rewrites(tc.Records))
+			require.Equal(t, tc.Add, add)
+			require.Equal(t, tc.Remove, remove)
+		})
+	}
+}
+
+type request struct {
+	Method string
+	Path   string
+	Body   rewrite
+}
+
+func TestWrite(t *testing.T) {
+	current := []rewrite{{Domain: "manual.lan", Answer: "10.0.0.1"}}
+	requests := []request{}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "admin" || pass != "secret" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if r.URL.Path == "/control/rewrite/list" {
+			_ = json.NewEncoder(w).Encode(current)
+			return
+		}
+
+		if r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "only application/json is allowed", http.StatusUnsupportedMediaType)
+			return
+		}
+
+		req := request{Method: r.Method, Path: r.URL.Path}
+		_ = json.NewDecoder(r.Body).Decode(&req.Body)
+		requests = append(requests, req)
+	}))
+	defer srv.Close()
+
+	cfg := Config{URL: srv.URL, User: "admin", Password: "secret", StateFile: filepath.Join(t.TempDir(), "state.json")}
+
+	a, err := New(slog.Default(), cfg)
+	require.NoError(t, err)
+	require.NoError(t, a.Write(context.Background(), []dns.Record{
+		{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+	}))
+
+	// ownership is kept across restarts
+	current = append(current, rewrite{Domain: "foo.lan", Answer: "192.168.1.1"})
+	a, err = New(slog.Default(), cfg)
+	require.NoError(t, err)
+	require.NoError(t, a.Write(context.Background(), nil))
+
+	require.Equal(t, []request{
+		{Method: http.MethodPost, Path: "/control/rewrite/add", Body: rewrite{Domain: "foo.lan", Answer: "192.168.1.1"}},
+		{Method: http.MethodPost, Path: "/control/rewrite/delete", Body: rewrite{Domain: "foo.lan", Answer: "192.168.1.1"}},
+	}, requests)
+
+	cfg.Password = "wrong"
+	a, err = New(slog.Default(), cfg)
+	require.NoError(t, err)
+	require.ErrorContains(t, a.Write(context.Background(), nil), "401")
+}
+
+func TestStateFileRequired(t *testing.T) {
+	_, err := New(slog.Default(), Config{URL: "http://127.0.0.1"})
+	require.ErrorContains(t, err, "state_file")
+}
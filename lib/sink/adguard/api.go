@@ -0,0 +1,57 @@
+package adguard
+
+import (
+	"context"
+
+	"github.com/ShimmerGlass/shimdns/lib/rest"
+)
+
+type rewrite struct {
+	Domain string `json:"domain"`
+	// an address, or a domain name for CNAMEs
+	Answer string `json:"answer"`
+}
+
+type api struct {
+	url      string
+	user     string
+	password string
+}
+
+func newAPI(url string, user string, password string) *api {
+	return &api{
+		url:      url,
+		user:     user,
+		password: password,
+	}
+}
+
+func (a *api) request(path string) rest.Request {
+	return rest.Request{
+		URL:  a.url,
+		Path: path,
+
+		BasicUser: a.user,
+		BasicPass: a.password,
+	}
+}
+
+func (a *api) Rewrites(ctx context.Context) ([]rewrite, error) {
+	return rest.Get[[]rewrite](ctx, a.request("/control/rewrite/list"))
+}
+
+func (a *api) Add(ctx context.Context, r rewrite) error {
+	req := a.request("/control/rewrite/add")
+	req.ExpectEmptyResponse = true
+
+	_, err := rest.Post[any](ctx, r, req)
+	return err
+}
+
+func (a *api) Delete(ctx context.Context, r rewrite) error {
+	req := a.request("/control/rewrite/delete")
+	req.ExpectEmptyResponse = true
+
+	_, err := rest.Post[any](ctx, r, req)
+	return err
+}
@@ -0,0 +1,15 @@
+package adguard
+
+import "github.com/ShimmerGlass/shimdns/lib/exp"
+
+type Config struct {
+	URL      string `yaml:"url"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+
+	// file the owned rewrites are kept in across restarts, required.
+	// Rewrites not created by shimdns are never removed.
+	StateFile string `yaml:"state_file"`
+
+	Filter exp.Filter `yaml:"filter"`
+}
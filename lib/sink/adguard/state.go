@@ -0,0 +1,25 @@
+package adguard
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/ShimmerGlass/shimdns/lib/statefile"
+)
+
+func (a *AdGuard) loadState() error {
+	keys, err := statefile.Load[string](a.cfg.StateFile)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range keys {
+		a.owned[k] = struct{}{}
+	}
+
+	return nil
+}
+
+func (a *AdGuard) saveState() error {
+	return statefile.Save(a.cfg.StateFile, slices.Sorted(maps.Keys(a.owned)))
+}
@@ -0,0 +1,176 @@
+package cloudflare
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ShimmerGlass/shimdns/lib/rest"
+)
+
+const perPage = 100
+
+type response[T any] struct {
+	Success    bool       `json:"success"`
+	Errors     []apiError `json:"errors"`
+	Result     T          `json:"result"`
+	ResultInfo resultInfo `json:"result_info"`
+}
+
+type apiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type resultInfo struct {
+	Page       int `json:"page"`
+	TotalPages int `json:"total_pages"`
+}
+
+type zone struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type record struct {
+	ID       string   `json:"id,omitempty"`
+	Type     string   `json:"type"`
+	Name     string   `json:"name"`
+	Content  string   `json:"content,omitempty"`
+	TTL      int      `json:"ttl"`
+	Proxied  *bool    `json:"proxied,omitempty"`
+	Priority *uint16  `json:"priority,omitempty"`
+	Data     *srvData `json:"data,omitempty"`
+	Comment  string   `json:"comment"`
+	Tags     []string `json:"tags"`
+}
+
+type srvData struct {
+	Priority uint16 `json:"priority"`
+	Weight   uint16 `json:"weight"`
+	Port     uint16 `json:"port"`
+	Target   string `json:"target"`
+}
+
+// key identifies a record by its name, type and value.
+func (r record) key() string {
+	parts := []string{strings.ToLower(r.Name), r.Type}
+
+	switch {
+	case r.Data != nil:
+		parts = append(parts,
+			strconv.Itoa(int(r.Data.Priority)), strconv.Itoa(int(r.Data.Weight)),
+			strconv.Itoa(int(r.Data.Port)), strings.ToLower(r.Data.Target))
+	case r.Priority != nil:
+		parts = append(parts, strconv.Itoa(int(*r.Priority)), strings.ToLower(r.Content))
+	default:
+		parts = append(parts, strings.ToLower(r.Content))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+type api struct {
+	url   string
+	token string
+}
+
+func newAPI(url string, token string) *api {
+	return &api{
+		url:   url,
+		token: token,
+	}
+}
+
+func (a *api) request(path string, query url.Values) rest.Request {
+	return rest.Request{
+		URL:     a.url,
+		Path:    path,
+		Query:   query,
+		Headers: map[string]string{"Authorization": "Bearer " + a.token},
+	}
+}
+
+func (a *api) ZoneID(ctx context.Context, name string) (string, error) {
+	res, err := rest.Get[response[[]zone]](ctx, a.request("/zones", url.Values{"name": {name}}))
+	if err != nil {
+		return "", err
+	}
+	if err := res.err(); err != nil {
+		return "", err
+	}
+
+	if len(res.Result) == 0 {
+		return "", fmt.Errorf("zone %s not found", name)
+	}
+
+	return res.Result[0].ID, nil
+}
+
+func (a *api) Records(ctx context.Context, zoneID string) ([]record, error) {
+	records := []record{}
+
+	for page := 1; ; page++ {
+		res, err := rest.Get[response[[]record]](ctx, a.request(
+			fmt.Sprintf("/zones/%s/dns_records", zoneID),
+			url.Values{
+				"page":     {strconv.Itoa(page)},
+				"per_page": {strconv.Itoa(perPage)},
+			},
+		))
+		if err != nil {
+			return nil, err
+		}
+		if err := res.err(); err != nil {
+			return nil, err
+		}
+
+		records = append(records, res.Result...)
+
+		if page >= res.ResultInfo.TotalPages {
+			return records, nil
+		}
+	}
+}
+
+func (a *api) Create(ctx context.Context, zoneID string, r record) error {
+	res, err := rest.Post[response[record]](ctx, r, a.request(fmt.Sprintf("/zones/%s/dns_records", zoneID), nil))
+	if err != nil {
+		return err
+	}
+
+	return res.err()
+}
+
+func (a *api) Update(ctx context.Context, zoneID string, r record) error {
+	res, err := rest.Put[response[record]](ctx, r, a.request(fmt.Sprintf("/zones/%s/dns_records/%s", zoneID, r.ID), nil))
+	if err != nil {
+		return err
+	}
+
+	return res.err()
+}
+
+func (a *api) Delete(ctx context.Context, zoneID string, id string) error {
+	res, err := rest.Delete[response[any]](ctx, nil, a.request(fmt.Sprintf("/zones/%s/dns_records/%s", zoneID, id), nil))
+	if err != nil {
+		return err
+	}
+
+	return res.err()
+}
+
+func (r response[T]) err() error {
+	if r.Success {
+		return nil
+	}
+
+	msgs := make([]string, 0, len(r.Errors))
+	for _, e := range r.Errors {
+		msgs = append(msgs, fmt.Sprintf("%d: %s", e.Code, e.Message))
+	}
+
+	return fmt.Errorf("api error: %s", strings.Join(msgs, ", "))
+}
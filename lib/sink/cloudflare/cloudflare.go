@@ -0,0 +1,277 @@
+package cloudflare
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	"github.com/ShimmerGlass/shimdns/lib/exp"
+	dnssrv "github.com/miekg/dns"
+	"github.com/samber/lo"
+)
+
+type Cloudflare struct {
+	log *slog.Logger
+	cfg Config
+	api *api
+
+	zone    string
+	zoneID  string
+	proxied *exp.Prog[bool]
+	ttl     *exp.Prog[int]
+}
+
+func New(log *slog.Logger, cfg Config) (*Cloudflare, error) {
+	if cfg.APIToken == "" {
+		return nil, fmt.Errorf("missing api_token")
+	}
+
+	if cfg.Zone == "" {
+		return nil, fmt.Errorf("missing zone")
+	}
+
+	if cfg.URL == "" {
+		cfg.URL = defaultURL
+	}
+
+	if cfg.Comment == "" {
+		cfg.Comment = defaultComment
+	}
+
+	c := &Cloudflare{
+		log:    log.With("sink", "cloudflare", "zone", cfg.Zone),
+		cfg:    cfg,
+		api:    newAPI(cfg.URL, cfg.APIToken),
+		zone:   strings.ToLower(dnssrv.CanonicalName(cfg.Zone)),
+		zoneID: cfg.ZoneID,
+	}
+
+	var err error
+	if cfg.Proxied != "" {
+		c.proxied, err = exp.Compile[bool](cfg.Proxied)
+		if err != nil {
+			return nil, fmt.Errorf("proxied: %w", err)
+		}
+	}
+
+	if cfg.TTL != "" {
+		c.ttl, err = exp.Compile[int](cfg.TTL)
+		if err != nil {
+			return nil, fmt.Errorf("ttl: %w", err)
+		}
+	}
+
+	return c, nil
+}
+
+func (c *Cloudflare) Write(ctx context.Context, records []dns.Record) error {
+	err := c.write(ctx, records)
+	if err != nil {
+		return fmt.Errorf("cloudflare sink: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Cloudflare) write(ctx context.Context, records []dns.Record) error {
+	records, err := c.cfg.Filter.Filter(records)
+	if err != nil {
+		return err
+	}
+
+	if c.zoneID == "" {
+		c.zoneID, err = c.api.ZoneID(ctx, strings.TrimSuffix(c.zone, "."))
+		if err != nil {
+			return err
+		}
+	}
+
+	desired, err := c.desired(records)
+	if err != nil {
+		return err
+	}
+
+	current, err := c.api.Records(ctx, c.zoneID)
+	if err != nil {
+		return err
+	}
+
+	changes := c.changes(desired, current)
+
+	for _, r := range changes.create {
+		err := c.api.Create(ctx, c.zoneID, r)
+		if err != nil {
+			return fmt.Errorf("create %s: %w", r.key(), err)
+		}
+		c.log.Info("record created", "record", r.key())
+	}
+
+	for _, r := range changes.update {
+		err := c.api.Update(ctx, c.zoneID, r)
+		if err != nil {
+			return fmt.Errorf("update %s: %w", r.key(), err)
+		}
+		c.log.Info("record updated", "record", r.key())
+	}
+
+	for _, r := range changes.delete {
+		err := c.api.Delete(ctx, c.zoneID, r.ID)
+		if err != nil {
+			return fmt.Errorf("delete %s: %w", r.key(), err)
+		}
+		c.log.Info("record deleted", "record", r.key())
+	}
+
+	return nil
+}
+
+// desired returns the records of the zone to write, by key.
+func (c *Cloudflare) desired(records []dns.Record) (map[string]record, error) {
+	desired := map[string]record{}
+	for _, rec := range records {
+		if !dnssrv.IsSubDomain(c.zone, strings.ToLower(dnssrv.CanonicalName(rec.Name))) {
+			continue
+		}
+
+		r, ok, err := c.toRecord(rec)
+		if err != nil {
+			return nil, fmt.Errorf("record %s: %w", rec, err)
+		}
+		if !ok {
+			continue
+		}
+
+		desired[r.key()] = r
+	}
+
+	return desired, nil
+}
+
+type changes struct {
+	create []record
+	update []record
+	delete []record
+}
+
+// changes returns the API calls turning current into desired, leaving the
+// records not created by this sink untouched.
+func (c *Cloudflare) changes(desired map[string]record, current []record) changes {
+	res := changes{}
+
+	currentByKey := map[string]record{}
+	for _, r := range current {
+		currentByKey[r.key()] = r
+	}
+
+	// sorted to keep the order of API calls stable
+	for _, key := range slices.Sorted(maps.Keys(desired)) {
+		want := desired[key]
+
+		cur, ok := currentByKey[key]
+		switch {
+		case !ok:
+			res.create = append(res.create, want)
+
+		case !c.owned(cur):
+			c.log.Warn("record exists and is not managed by shimdns, skipping", "record", key)
+
+		case cur.TTL != want.TTL || lo.FromPtr(cur.Proxied) != lo.FromPtr(want.Proxied):
+			want.ID = cur.ID
+			res.update = append(res.update, want)
+		}
+	}
+
+	for _, cur := range current {
+		if _, ok := desired[cur.key()]; ok || !c.owned(cur) {
+			continue
+		}
+
+		res.delete = append(res.delete, cur)
+	}
+
+	return res
+}
+
+// toRecord returns the Cloudflare record for rec, or false if its type is
+// not supported.
+func (c *Cloudflare) toRecord(rec dns.Record) (record, bool, error) {
+	r := record{
+		Type: string(rec.Type),
+		Name: strings.ToLower(strings.TrimSuffix(rec.Name, ".")),
+		TTL:  autoTTL,
+		Tags: []string{},
+	}
+
+	if c.cfg.Tag != "" {
+		r.Tags = []string{c.cfg.Tag}
+	} else {
+		r.Comment = c.cfg.Comment
+	}
+
+	proxiable := false
+
+	switch rec.Type {
+	case dns.A, dns.AAAA:
+		r.Content = rec.Address.String()
+		proxiable = true
+	case dns.CNAME:
+		r.Content = strings.TrimSuffix(rec.Target, ".")
+		proxiable = true
+	case dns.PTR:
+		r.Content = strings.TrimSuffix(rec.Ptr, ".")
+	case dns.MX:
+		r.Content = strings.TrimSuffix(rec.Mx, ".")
+		r.Priority = lo.ToPtr(rec.Preference)
+	case dns.SRV:
+		r.Data = &srvData{
+			Priority: rec.Priority,
+			Weight:   rec.Weight,
+			Port:     rec.Port,
+			Target:   strings.TrimSuffix(rec.Target, "."),
+		}
+	default:
+		return r, false, nil
+	}
+
+	if proxiable {
+		proxied := false
+		if c.proxied != nil {
+			var err error
+			proxied, err = c.proxied.Run(rec)
+			if err != nil {
+				return r, false, fmt.Errorf("proxied: %w", err)
+			}
+		}
+		r.Proxied = &proxied
+
+		// proxied records always use the automatic TTL
+		if proxied {
+			return r, true, nil
+		}
+	}
+
+	if c.ttl != nil {
+		ttl, err := c.ttl.Run(rec)
+		if err != nil {
+			return r, false, fmt.Errorf("ttl: %w", err)
+		}
+		if ttl > 0 {
+			r.TTL = ttl
+		}
+	}
+
+	return r, true, nil
+}
+
+// owned returns whether the record was created by this sink.
+func (c *Cloudflare) owned(r record) bool {
+	if c.cfg.Tag != "" {
+		return slices.Contains(r.Tags, c.cfg.Tag)
+	}
+
+	return r.Comment == c.cfg.Comment
+}
@@ -0,0 +1,168 @@
+package cloudflare
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"testing"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/require"
+)
+
+type testCase struct {
+	Cfg     Config
+	Current []record
+	Records []dns.Record
+	Changes changes
+}
+
+var testCases = []testCase{
+	{
+		// proxied records use the automatic TTL, records outside of the
+		// zone are ignored
+		Cfg: Config{Proxied: `record.name startsWith "app."`, TTL: `record.mx != "" ? 3600 : 600`},
+		Records: []dns.Record{
+			{Type: dns.A, Name: "app.example.com.", Address: netip.MustParseAddr("192.168.1.1")},
+			{Type: dns.A, Name: "db.example.com.", Address: netip.MustParseAddr("192.168.1.2")},
+			{Type: dns.MX, Name: "example.com.", Mx: "mail.example.com.", Preference: 10},
+			{Type: dns.SRV, Name: "_sip._udp.example.com.", Target: "sip.example.com.", Priority: 1, Weight: 2, Port: 5060},
+			{Type: dns.A, Name: "foo.other.", Address: netip.MustParseAddr("192.168.2.1")},
+		},
+		Changes: changes{create: []record{
+			{Type: "SRV", Name: "_sip._udp.example.com", TTL: 600, Data: &srvData{Priority: 1, Weight: 2, Port: 5060, Target: "sip.example.com"}, Comment: defaultComment, Tags: []string{}},
+			{Type: "A", Name: "app.example.com", Content: "192.168.1.1", TTL: autoTTL, Proxied: lo.ToPtr(true), Comment: defaultComment, Tags: []string{}},
+			{Type: "A", Name: "db.example.com", Content: "192.168.1.2", TTL: 600, Proxied: lo.ToPtr(false), Comment: defaultComment, Tags: []string{}},
+			{Type: "MX", Name: "example.com", Content: "mail.example.com", TTL: 3600, Priority: lo.ToPtr[uint16](10), Comment: defaultComment, Tags: []string{}},
+		}},
+	},
+	{
+		// owned records are updated in place, others are left untouched
+		Cfg: Config{Proxied: `true`},
+		Current: []record{
+			{ID: "s1", Type: "A", Name: "app.example.com", Content: "192.168.1.1", TTL: 600, Proxied: lo.ToPtr(false), Comment: defaultComment},
+			{ID: "m1", Type: "A", Name: "www.example.com", Content: "10.0.0.2", TTL: 600, Proxied: lo.ToPtr(false)},
+			{ID: "m2", Type: "A", Name: "manual.example.com", Content: "10.0.0.1", TTL: autoTTL, Proxied: lo.ToPtr(false), Comment: "someone else"},
+		},
+		Records: []dns.Record{
+			{Type: dns.A, Name: "app.example.com.", Address: netip.MustParseAddr("192.168.1.1")},
+			{Type: dns.A, Name: "www.example.com.", Address: netip.MustParseAddr("10.0.0.2")},
+		},
+		Changes: changes{update: []record{
+			{ID: "s1", Type: "A", Name: "app.example.com", Content: "192.168.1.1", TTL: autoTTL, Proxied: lo.ToPtr(true), Comment: defaultComment, Tags: []string{}},
+		}},
+	},
+	{
+		// with a tag, ownership ignores the comment
+		Cfg: Config{Tag: "shimdns"},
+		Current: []record{
+			{ID: "s1", Type: "A", Name: "stale.example.com", Content: "10.0.0.3", TTL: autoTTL, Proxied: lo.ToPtr(false), Tags: []string{"shimdns"}},
+			{ID: "m1", Type: "A", Name: "manual.example.com", Content: "10.0.0.1", TTL: autoTTL, Proxied: lo.ToPtr(false), Comment: defaultComment},
+		},
+		Records: []dns.Record{
+			{Type: dns.A, Name: "foo.example.com.", Address: netip.MustParseAddr("192.168.1.1")},
+		},
+		Changes: changes{
+			create: []record{{Type: "A", Name: "foo.example.com", Content: "192.168.1.1", TTL: autoTTL, Proxied: lo.ToPtr(false), Tags: []string{"shimdns"}}},
+			delete: []record{{ID: "s1", Type: "A", Name: "stale.example.com", Content: "10.0.0.3", TTL: autoTTL, Proxied: lo.ToPtr(false), Tags: []string{"shimdns"}}},
+		},
+	},
+	{
+		// unchanged
+		Current: []record{
+			{ID: "s1", Type: "CNAME", Name: "www.example.com", Content: "example.com", TTL: autoTTL, Proxied: lo.ToPtr(false), Comment: defaultComment},
+		},
+		Records: []dns.Record{
+			{Type: dns.CNAME, Name: "www.example.com.", Target: "example.com."},
+		},
+	},
+}
+
+func TestChanges(t *testing.T) {
+	for i, tc := range testCases {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			tc.Cfg.APIToken = "token"
+			tc.Cfg.Zone = "example.com"
+
+			c, err := New(slog.Default(), tc.Cfg)
+			require.NoError(t, err)
+
+			desired, err := c.desired(tc.Records)
+			require.NoError(t, err)
+
+			require.Equal(t, tc.Changes, c.changes(desired, tc.Current))
+		})
+	}
+}
+
+type request struct {
+	Method string
+	Path   string
+	Body   record
+}
+
+func TestWrite(t *testing.T) {
+	// listed one record per page, whatever per_page asks for
+	current := []record{
+		{ID: "s1", Type: "A", Name: "foo.example.com", Content: "192.168.1.1", TTL: autoTTL, Proxied: lo.ToPtr(false), Comment: defaultComment},
+		{ID: "s2", Type: "A", Name: "stale.example.com", Content: "10.0.0.3", TTL: autoTTL, Proxied: lo.ToPtr(false), Comment: defaultComment},
+	}
+
+	requests := []request{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusForbidden)
+			_ = json.NewEncoder(w).Encode(response[any]{Errors: []apiError{{Code: 9109, Message: "Invalid access token"}}})
+			return
+		}
+
+		switch {
+		case r.URL.Path == "/zones":
+			zones := []zone{}
+			if r.URL.Query().Get("name") == "example.com" {
+				zones = append(zones, zone{ID: "z1", Name: "example.com"})
+			}
+			_ = json.NewEncoder(w).Encode(response[[]zone]{Success: true, Result: zones})
+
+		case r.Method == http.MethodGet:
+			page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+			_ = json.NewEncoder(w).Encode(response[[]record]{
+				Success:    true,
+				Result:     current[page-1 : page],
+				ResultInfo: resultInfo{Page: page, TotalPages: len(current)},
+			})
+
+		default:
+			req := request{Method: r.Method, Path: r.URL.Path}
+			_ = json.NewDecoder(r.Body).Decode(&req.Body)
+			requests = append(requests, req)
+			_ = json.NewEncoder(w).Encode(response[any]{Success: true})
+		}
+	}))
+	defer srv.Close()
+
+	c, err := New(slog.Default(), Config{URL: srv.URL, APIToken: "token", Zone: "example.com"})
+	require.NoError(t, err)
+
+	require.NoError(t, c.Write(context.Background(), []dns.Record{
+		{Type: dns.A, Name: "foo.example.com.", Address: netip.MustParseAddr("192.168.1.1")},
+		{Type: dns.A, Name: "bar.example.com.", Address: netip.MustParseAddr("192.168.1.2")},
+	}))
+
+	require.Equal(t, []request{
+		{Method: http.MethodPost, Path: "/zones/z1/dns_records", Body: record{
+			Type: "A", Name: "bar.example.com", Content: "192.168.1.2", TTL: autoTTL, Proxied: lo.ToPtr(false), Comment: defaultComment, Tags: []string{},
+		}},
+		{Method: http.MethodDelete, Path: "/zones/z1/dns_records/s2"},
+	}, requests)
+
+	c, err = New(slog.Default(), Config{URL: srv.URL, APIToken: "token", Zone: "example.org"})
+	require.NoError(t, err)
+	require.ErrorContains(t, c.Write(context.Background(), nil), "zone example.org not found")
+}
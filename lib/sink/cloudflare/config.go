@@ -0,0 +1,31 @@
+package cloudflare
+
+import "github.com/ShimmerGlass/shimdns/lib/exp"
+
+const (
+	defaultURL     = "https://api.cloudflare.com/client/v4"
+	defaultComment = "managed by shimdns"
+	// Cloudflare's "automatic" TTL
+	autoTTL = 1
+)
+
+type Config struct {
+	// API base URL, defaults to the public v4 API
+	URL      string `yaml:"url"`
+	APIToken string `yaml:"api_token"`
+
+	// zone name, looked up when ZoneID is not set
+	Zone   string `yaml:"zone"`
+	ZoneID string `yaml:"zone_id"`
+
+	// expressions evaluated for each record, e.g. `record.name endsWith ".pub."`
+	Proxied string `yaml:"proxied"`
+	TTL     string `yaml:"ttl"`
+
+	// records are owned when they carry this comment, or this tag when set.
+	// Tags require a paid plan.
+	Comment string `yaml:"comment"`
+	Tag     string `yaml:"tag"`
+
+	Filter exp.Filter `yaml:"filter"`
+}
@@ -15,8 +15,28 @@ type Dashboard struct {
 	log *slog.Logger
 	cfg Config
 
-	lock    sync.Mutex
-	records []dns.Record
+	lock     sync.Mutex
+	records  []dns.Record
+	counters []counterGroup
+}
+
+// Counter is a named value shown on the dashboard.
+type Counter struct {
+	Name  string
+	Value string
+}
+
+type counterGroup struct {
+	name string
+	fn   func() []Counter
+}
+
+// AddCounters shows a group of counters on the dashboard, fn is called on
+// each render.
+func (d *Dashboard) AddCounters(name string, fn func() []Counter) {
+	d.lock.Lock()
+	d.counters = append(d.counters, counterGroup{name: name, fn: fn})
+	d.lock.Unlock()
 }
 
 func New(log *slog.Logger, cfg Config, mux *http.ServeMux) (*Dashboard, error) {
@@ -51,8 +71,16 @@ func (d *Dashboard) register(mux *http.ServeMux) {
 	mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
 		d.lock.Lock()
 		recs := d.records
+		groups := d.counters
 		d.lock.Unlock()
 
-		_ = index(recs).Render(r.Context(), w)
+		counters := map[string][]Counter{}
+		names := []string{}
+		for _, g := range groups {
+			counters[g.name] = g.fn()
+			names = append(names, g.name)
+		}
+
+		_ = index(recs, names, counters).Render(r.Context(), w)
 	})
 }
@@ -0,0 +1,16 @@
+package dnsmasq
+
+import (
+	"github.com/ShimmerGlass/shimdns/lib/exp"
+	"github.com/ShimmerGlass/shimdns/lib/reload"
+)
+
+type Config struct {
+	// file included by dnsmasq, ie. with conf-file= or from conf-dir=
+	Path string `yaml:"path"`
+	// dnsmasq does not reread configuration files on SIGHUP, use a restart
+	// command
+	Reload reload.Config `yaml:"reload"`
+
+	Filter exp.Filter `yaml:"filter"`
+}
@@ -0,0 +1,105 @@
+package dnsmasq
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/ShimmerGlass/shimdns/lib/configfile"
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+)
+
+type Dnsmasq struct {
+	log *slog.Logger
+	cfg Config
+
+	file *configfile.Writer
+}
+
+func New(log *slog.Logger, cfg Config) (*Dnsmasq, error) {
+	log = log.With("sink", "dnsmasq")
+
+	file, err := configfile.New(log, cfg.Path, cfg.Reload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Dnsmasq{
+		log:  log,
+		cfg:  cfg,
+		file: file,
+	}, nil
+}
+
+func (d *Dnsmasq) Write(ctx context.Context, records []dns.Record) error {
+	records, err := d.cfg.Filter.Filter(records)
+	if err != nil {
+		return fmt.Errorf("dnsmasq sink: %w", err)
+	}
+
+	content, unsupported := render(records)
+	d.file.ReportUnsupported(unsupported)
+
+	err = d.file.Write(ctx, content)
+	if err != nil {
+		return fmt.Errorf("dnsmasq sink: %w", err)
+	}
+
+	return nil
+}
+
+// render returns the dnsmasq configuration for records, and the records it
+// cannot express.
+func render(records []dns.Record) ([]byte, []dns.Record) {
+	lines := []string{}
+	unsupported := []dns.Record{}
+
+	for _, rec := range records {
+		// dnsmasq has no wildcard records outside of address=, which would
+		// also match the parent name
+		if strings.HasPrefix(rec.Name, "*.") {
+			unsupported = append(unsupported, rec)
+			continue
+		}
+
+		name := strings.TrimSuffix(rec.Name, ".")
+
+		switch rec.Type {
+		case dns.A, dns.AAAA:
+			lines = append(lines, fmt.Sprintf("host-record=%s,%s", name, rec.Address))
+
+		case dns.CNAME:
+			lines = append(lines, fmt.Sprintf("cname=%s,%s", name, strings.TrimSuffix(rec.Target, ".")))
+
+		case dns.SRV:
+			lines = append(lines, fmt.Sprintf("srv-host=%s,%s,%d,%d,%d",
+				name, strings.TrimSuffix(rec.Target, "."), rec.Port, rec.Priority, rec.Weight))
+
+		case dns.PTR:
+			lines = append(lines, fmt.Sprintf("ptr-record=%s,%s", name, strings.TrimSuffix(rec.Ptr, ".")))
+
+		case dns.MX:
+			lines = append(lines, fmt.Sprintf("mx-host=%s,%s,%d", name, strings.TrimSuffix(rec.Mx, "."), rec.Preference))
+
+		default:
+			unsupported = append(unsupported, rec)
+		}
+	}
+
+	// sources do not guarantee ordering, keep the output stable to avoid
+	// needless reloads
+	slices.Sort(lines)
+	lines = slices.Compact(lines)
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("# generated by shimdns, do not edit\n")
+	for _, l := range lines {
+		buf.WriteString(l)
+		buf.WriteByte('\n')
+	}
+
+	return buf.Bytes(), unsupported
+}
@@ -0,0 +1,42 @@
+package dnsmasq
+
+import (
+	"context"
+	"log/slog"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shimdns.conf")
+
+	d, err := New(slog.Default(), Config{Path: path})
+	require.NoError(t, err)
+
+	err = d.Write(context.Background(), []dns.Record{
+		{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+		{Type: dns.AAAA, Name: "foo.lan.", Address: netip.MustParseAddr("fd00::1")},
+		{Type: dns.CNAME, Name: "www.lan.", Target: "foo.lan."},
+		{Type: dns.SRV, Name: "_http._tcp.foo.lan.", Target: "foo.lan.", Port: 80, Priority: 1, Weight: 2},
+		{Type: dns.PTR, Name: "1.1.168.192.in-addr.arpa.", Ptr: "foo.lan."},
+		{Type: dns.MX, Name: "lan.", Mx: "mail.lan.", Preference: 10},
+		{Type: dns.A, Name: "*.apps.lan.", Address: netip.MustParseAddr("192.168.1.2")},
+	})
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, `# generated by shimdns, do not edit
+cname=www.lan,foo.lan
+host-record=foo.lan,192.168.1.1
+host-record=foo.lan,fd00::1
+mx-host=lan,mail.lan,10
+ptr-record=1.1.168.192.in-addr.arpa,foo.lan
+srv-host=_http._tcp.foo.lan,foo.lan,80,1,2
+`, string(content))
+}
@@ -0,0 +1,171 @@
+package dnsserver
+
+import (
+	"context"
+	"log/slog"
+	"net/netip"
+	"testing"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	dnssrv "github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func testServer(t *testing.T, recs []dns.Record) *DNSServer {
+	d := &DNSServer{
+		log:      slog.Default(),
+		notifier: newNotifier(slog.Default(), NotifyConfig{}),
+	}
+
+	err := d.Write(context.Background(), recs)
+	require.NoError(t, err)
+
+	return d
+}
+
+func query(d *DNSServer, name string, qtype uint16) *dnssrv.Msg {
+	req := new(dnssrv.Msg)
+	req.SetQuestion(name, qtype)
+
+	res := new(dnssrv.Msg)
+	res.SetReply(req)
+	d.answer(d.store.Load(), req.Question[0], res)
+
+	return res
+}
+
+func TestAnswerCNAMEChain(t *testing.T) {
+	d := testServer(t, []dns.Record{
+		{Type: dns.CNAME, Name: "a.lan.", Target: "b.lan."},
+		{Type: dns.CNAME, Name: "b.lan.", Target: "c.lan."},
+		{Type: dns.A, Name: "c.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+		{Type: dns.SRV, Name: "c.lan.", Target: "c.lan.", Port: 80},
+	})
+
+	res := query(d, "a.lan.", dnssrv.TypeA)
+	require.Len(t, res.Answer, 3)
+	require.Equal(t, dnssrv.TypeCNAME, res.Answer[0].Header().Rrtype)
+	require.Equal(t, "a.lan.", res.Answer[0].Header().Name)
+	require.Equal(t, dnssrv.TypeCNAME, res.Answer[1].Header().Rrtype)
+	require.Equal(t, "c.lan.", res.Answer[2].Header().Name)
+
+	// chains are followed for all types
+	res = query(d, "a.lan.", dnssrv.TypeSRV)
+	require.Len(t, res.Answer, 3)
+	require.Equal(t, dnssrv.TypeSRV, res.Answer[2].Header().Rrtype)
+
+	// CNAME queries are not followed
+	res = query(d, "a.lan.", dnssrv.TypeCNAME)
+	require.Len(t, res.Answer, 1)
+}
+
+func TestAnswerCNAMELoop(t *testing.T) {
+	d := testServer(t, []dns.Record{
+		{Type: dns.CNAME, Name: "a.lan.", Target: "b.lan."},
+		{Type: dns.CNAME, Name: "b.lan.", Target: "a.lan."},
+	})
+
+	res := query(d, "a.lan.", dnssrv.TypeA)
+	require.Len(t, res.Answer, 2)
+}
+
+func TestAnswerCNAMEMaxDepth(t *testing.T) {
+	recs := []dns.Record{}
+	for i := range 2 * maxCNAMEDepth {
+		recs = append(recs, dns.Record{
+			Type:   dns.CNAME,
+			Name:   string(rune('a'+i)) + ".lan.",
+			Target: string(rune('a'+i+1)) + ".lan.",
+		})
+	}
+
+	d := testServer(t, recs)
+
+	res := query(d, "a.lan.", dnssrv.TypeA)
+	require.Len(t, res.Answer, maxCNAMEDepth+1)
+}
+
+func TestAnswerGlue(t *testing.T) {
+	d := testServer(t, []dns.Record{
+		{Type: dns.SRV, Name: "_http._tcp.lan.", Target: "web.lan.", Port: 80},
+		{Type: dns.SRV, Name: "_http._tcp.lan.", Target: "web.lan.", Port: 8080},
+		{Type: dns.MX, Name: "lan.", Mx: "mail.lan.", Preference: 10},
+		{Type: dns.A, Name: "web.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+		{Type: dns.AAAA, Name: "web.lan.", Address: netip.MustParseAddr("fd00::1")},
+		{Type: dns.A, Name: "mail.lan.", Address: netip.MustParseAddr("192.168.1.2")},
+	})
+
+	res := query(d, "_http._tcp.lan.", dnssrv.TypeSRV)
+	require.Len(t, res.Answer, 2)
+	require.Len(t, res.Extra, 2)
+
+	res = query(d, "lan.", dnssrv.TypeMX)
+	require.Len(t, res.Answer, 1)
+	require.Len(t, res.Extra, 1)
+	require.Equal(t, "192.168.1.2", res.Extra[0].(*dnssrv.A).A.String())
+}
+
+func TestHandlerACL(t *testing.T) {
+	d := testServer(t, []dns.Record{
+		{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+	})
+	d.cfg.ACL = ACLConfig{
+		Query: ACL{
+			Allow: []netip.Prefix{netip.MustParsePrefix("192.168.0.0/16")},
+			Deny:  []netip.Prefix{netip.MustParsePrefix("192.168.66.0/24")},
+		},
+		Recursion: ACL{
+			Deny: []netip.Prefix{netip.MustParsePrefix("0.0.0.0/0")},
+		},
+	}
+
+	testCases := []struct {
+		client string
+		name   string
+		rcode  int
+	}{
+		{client: "192.168.1.10", name: "foo.lan.", rcode: dnssrv.RcodeSuccess},
+		{client: "192.168.66.10", name: "foo.lan.", rcode: dnssrv.RcodeRefused},
+		{client: "10.0.0.1", name: "foo.lan.", rcode: dnssrv.RcodeRefused},
+		// we would need to recurse for this one
+		{client: "192.168.1.10", name: "example.com.", rcode: dnssrv.RcodeRefused},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.client+" "+tc.name, func(t *testing.T) {
+			req := new(dnssrv.Msg)
+			req.SetQuestion(tc.name, dnssrv.TypeA)
+
+			w := newTestWriter(tc.client)
+			d.handler(w, req)
+
+			require.Len(t, w.msgs, 1)
+			require.Equal(t, tc.rcode, w.msgs[0].Rcode)
+		})
+	}
+
+	require.EqualValues(t, 3, d.Stats().Refused)
+}
+
+func TestHandlerNegativeAnswer(t *testing.T) {
+	d := &DNSServer{
+		log:      slog.Default(),
+		zones:    []*zone{newZone(ZoneConfig{Name: "lan"})},
+		notifier: newNotifier(slog.Default(), NotifyConfig{}),
+	}
+	require.NoError(t, d.Write(context.Background(), nil))
+	d.cfg.ACL.Recursion.Deny = []netip.Prefix{netip.MustParsePrefix("0.0.0.0/0")}
+
+	req := new(dnssrv.Msg)
+	req.SetQuestion("nope.lan.", dnssrv.TypeA)
+
+	w := newTestWriter("192.168.1.10")
+	d.handler(w, req)
+
+	// names of served zones are not recursed for, the zone SOA allows
+	// caching the negative answer
+	require.Equal(t, dnssrv.RcodeSuccess, w.msgs[0].Rcode)
+	require.Empty(t, w.msgs[0].Answer)
+	require.Len(t, w.msgs[0].Ns, 1)
+	require.Equal(t, dnssrv.TypeSOA, w.msgs[0].Ns[0].Header().Rrtype)
+}
@@ -0,0 +1,277 @@
+package dnsserver
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	dnssrv "github.com/miekg/dns"
+)
+
+const (
+	blockNXDomain = "nxdomain"
+	blockNull     = "null"
+	blockRedirect = "redirect"
+
+	defaultBlocklistRefresh = 24 * time.Hour
+	defaultBlocklistTimeout = 30 * time.Second
+)
+
+// names commonly found in hosts files that must not be blocked
+var hostsFileReserved = map[string]bool{
+	"localhost.":             true,
+	"localhost.localdomain.": true,
+	"local.":                 true,
+	"broadcasthost.":         true,
+	"ip6-localhost.":         true,
+	"ip6-loopback.":          true,
+	"ip6-localnet.":          true,
+	"ip6-mcastprefix.":       true,
+	"ip6-allnodes.":          true,
+	"ip6-allrouters.":        true,
+	"ip6-allhosts.":          true,
+	"0.0.0.0.":               true,
+}
+
+// domainSet matches names and their subdomains.
+type domainSet map[string]struct{}
+
+func (s domainSet) match(name string) bool {
+	name = strings.ToLower(dnssrv.CanonicalName(name))
+
+	for {
+		if _, ok := s[name]; ok {
+			return true
+		}
+
+		i := strings.IndexByte(name, '.')
+		if i < 0 || i == len(name)-1 {
+			return false
+		}
+
+		name = name[i+1:]
+	}
+}
+
+type blocklist struct {
+	log *slog.Logger
+	cfg BlocklistConfig
+
+	// last successful load of each list, only used by refresh
+	loaded map[string][]string
+
+	blocked atomic.Pointer[domainSet]
+	allowed atomic.Pointer[domainSet]
+}
+
+func newBlocklist(log *slog.Logger, cfg BlocklistConfig) (*blocklist, error) {
+	if cfg.Refresh == 0 {
+		cfg.Refresh = defaultBlocklistRefresh
+	}
+
+	if cfg.Timeout == 0 {
+		cfg.Timeout = defaultBlocklistTimeout
+	}
+
+	switch cfg.Response {
+	case "":
+		cfg.Response = blockNXDomain
+	case blockNXDomain, blockNull:
+	case blockRedirect:
+		if len(cfg.Redirect) == 0 {
+			return nil, fmt.Errorf("redirect response requires redirect addresses")
+		}
+	default:
+		return nil, fmt.Errorf("unknown response %q", cfg.Response)
+	}
+
+	b := &blocklist{
+		log:    log.With("component", "blocklist"),
+		cfg:    cfg,
+		loaded: map[string][]string{},
+	}
+
+	b.blocked.Store(&domainSet{})
+	b.allowed.Store(&domainSet{})
+
+	return b, nil
+}
+
+func (b *blocklist) run(ctx context.Context) {
+	b.refresh(ctx)
+
+	ticker := time.NewTicker(b.cfg.Refresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			b.refresh(ctx)
+		}
+	}
+}
+
+// refresh reloads all lists. Lists failing to load keep their previous
+// content.
+func (b *blocklist) refresh(ctx context.Context) {
+	blocked := b.load(ctx, b.cfg.Lists)
+
+	allowed := b.load(ctx, b.cfg.Allowlists)
+	for _, name := range b.cfg.Allow {
+		allowed[strings.ToLower(dnssrv.CanonicalName(name))] = struct{}{}
+	}
+
+	b.blocked.Store(&blocked)
+	b.allowed.Store(&allowed)
+
+	b.log.Info("blocklist loaded", "blocked", len(blocked), "allowed", len(allowed))
+}
+
+func (b *blocklist) load(ctx context.Context, lists []string) domainSet {
+	set := domainSet{}
+
+	for _, list := range lists {
+		names, err := b.fetch(ctx, list)
+		if err != nil {
+			b.log.Warn("blocklist load failed, keeping previous content", "list", list, "err", err)
+			names = b.loaded[list]
+		} else {
+			b.loaded[list] = names
+		}
+
+		for _, name := range names {
+			set[name] = struct{}{}
+		}
+	}
+
+	return set
+}
+
+func (b *blocklist) fetch(ctx context.Context, list string) ([]string, error) {
+	if !strings.HasPrefix(list, "http://") && !strings.HasPrefix(list, "https://") {
+		f, err := os.Open(list)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = f.Close() }()
+
+		return parseDomainList(f)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, b.cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, list, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	if res.StatusCode >= 400 {
+		return nil, fmt.Errorf("bad status code: %d", res.StatusCode)
+	}
+
+	return parseDomainList(res.Body)
+}
+
+// parseDomainList reads hosts file ("0.0.0.0 ads.example.com") or plain
+// domain ("ads.example.com") formatted lists.
+func parseDomainList(r io.Reader) ([]string, error) {
+	names := []string{}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if _, err := netip.ParseAddr(fields[0]); err == nil {
+			fields = fields[1:]
+		} else {
+			fields = fields[:1]
+		}
+
+		for _, name := range fields {
+			name = strings.ToLower(dnssrv.CanonicalName(name))
+			if hostsFileReserved[name] {
+				continue
+			}
+
+			if _, ok := dnssrv.IsDomainName(name); !ok {
+				continue
+			}
+
+			names = append(names, name)
+		}
+	}
+
+	return names, scanner.Err()
+}
+
+func (b *blocklist) blocks(name string) bool {
+	if b.allowed.Load().match(name) {
+		return false
+	}
+
+	return b.blocked.Load().match(name)
+}
+
+// answer adds the configured blocked response for q to res.
+func (b *blocklist) answer(q dnssrv.Question, res *dnssrv.Msg) {
+	var addrs []netip.Addr
+
+	switch b.cfg.Response {
+	case blockNXDomain:
+		res.Rcode = dnssrv.RcodeNameError
+		return
+
+	case blockNull:
+		addrs = []netip.Addr{netip.IPv4Unspecified(), netip.IPv6Unspecified()}
+
+	case blockRedirect:
+		addrs = b.cfg.Redirect
+	}
+
+	for _, addr := range addrs {
+		hdr := dnssrv.RR_Header{
+			Name:  q.Name,
+			Class: dnssrv.ClassINET,
+			Ttl:   ttl,
+		}
+
+		switch {
+		case q.Qtype == dnssrv.TypeA && addr.Is4():
+			hdr.Rrtype = dnssrv.TypeA
+			res.Answer = append(res.Answer, &dnssrv.A{Hdr: hdr, A: addrNetipToNetDotIP(addr)})
+
+		case q.Qtype == dnssrv.TypeAAAA && addr.Is6():
+			hdr.Rrtype = dnssrv.TypeAAAA
+			res.Answer = append(res.Answer, &dnssrv.AAAA{Hdr: hdr, AAAA: addrNetipToNetDotIP(addr)})
+		}
+	}
+}
+
+func (b *blocklist) size() int {
+	return len(*b.blocked.Load())
+}
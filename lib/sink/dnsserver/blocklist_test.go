@@ -0,0 +1,130 @@
+package dnsserver
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	dnssrv "github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDomainList(t *testing.T) {
+	names, err := parseDomainList(strings.NewReader(`
+# hosts file format
+127.0.0.1 localhost
+0.0.0.0 ads.example.com tracker.example.com # inline comment
+:: ads6.example.com
+
+# plain format
+Plain.Example.org
+not_a..domain
+`))
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"ads.example.com.",
+		"tracker.example.com.",
+		"ads6.example.com.",
+		"plain.example.org.",
+	}, names)
+}
+
+func testBlocklist(t *testing.T, cfg BlocklistConfig) *blocklist {
+	hosts := filepath.Join(t.TempDir(), "hosts")
+	require.NoError(t, os.WriteFile(hosts, []byte("0.0.0.0 ads.example.com\n"), 0o600))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("tracker.example.com\nfoo.lan\n"))
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg.Lists = []string{hosts, srv.URL}
+	cfg.Allow = []string{"ok.ads.example.com"}
+
+	b, err := newBlocklist(slog.Default(), cfg)
+	require.NoError(t, err)
+	b.refresh(context.Background())
+
+	return b
+}
+
+func TestBlocklistMatch(t *testing.T) {
+	b := testBlocklist(t, BlocklistConfig{})
+
+	require.True(t, b.blocks("ads.example.com."))
+	require.True(t, b.blocks("SUB.ads.example.com."))
+	require.True(t, b.blocks("tracker.example.com."))
+	require.False(t, b.blocks("example.com."))
+	require.False(t, b.blocks("ok.ads.example.com."))
+	require.False(t, b.blocks("x.ok.ads.example.com."))
+	require.Equal(t, 3, b.size())
+
+	// lists failing to load keep their previous content
+	b.cfg.Lists[0] = filepath.Join(t.TempDir(), "missing")
+	b.loaded[b.cfg.Lists[0]] = b.loaded[b.cfg.Lists[1]]
+	b.refresh(context.Background())
+	require.True(t, b.blocks("tracker.example.com."))
+}
+
+func TestBlocklistResponses(t *testing.T) {
+	testCases := []struct {
+		Name     string
+		Cfg      BlocklistConfig
+		Qtype    uint16
+		Rcode    int
+		Expected []string
+	}{
+		{Name: "nxdomain", Qtype: dnssrv.TypeA, Rcode: dnssrv.RcodeNameError},
+		{Name: "null A", Cfg: BlocklistConfig{Response: blockNull}, Qtype: dnssrv.TypeA, Expected: []string{"0.0.0.0"}},
+		{Name: "null AAAA", Cfg: BlocklistConfig{Response: blockNull}, Qtype: dnssrv.TypeAAAA, Expected: []string{"::"}},
+		{Name: "null MX", Cfg: BlocklistConfig{Response: blockNull}, Qtype: dnssrv.TypeMX},
+		{
+			Name:     "redirect",
+			Cfg:      BlocklistConfig{Response: blockRedirect, Redirect: []netip.Addr{netip.MustParseAddr("192.168.1.100")}},
+			Qtype:    dnssrv.TypeA,
+			Expected: []string{"192.168.1.100"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			d := testServer(t, []dns.Record{
+				// served records are never blocked
+				{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+			})
+			d.blocklist = testBlocklist(t, tc.Cfg)
+
+			req := new(dnssrv.Msg)
+			req.SetQuestion("ads.example.com.", tc.Qtype)
+			w := newTestWriter("192.168.1.10")
+			d.handler(w, req)
+
+			res := w.msgs[0]
+			require.Equal(t, tc.Rcode, res.Rcode)
+
+			answers := []string{}
+			for _, rr := range res.Answer {
+				switch rr := rr.(type) {
+				case *dnssrv.A:
+					answers = append(answers, rr.A.String())
+				case *dnssrv.AAAA:
+					answers = append(answers, rr.AAAA.String())
+				}
+			}
+			require.ElementsMatch(t, tc.Expected, answers)
+
+			req.SetQuestion("foo.lan.", dnssrv.TypeA)
+			d.handler(w, req)
+			require.Len(t, w.msgs[1].Answer, 1)
+
+			require.EqualValues(t, 1, d.Stats().Blocked)
+		})
+	}
+}
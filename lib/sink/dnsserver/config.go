@@ -1,9 +1,183 @@
 package dnsserver
 
-import "github.com/ShimmerGlass/shimdns/lib/exp"
+import (
+	"net/netip"
+	"time"
+
+	"github.com/ShimmerGlass/shimdns/lib/exp"
+	"github.com/ShimmerGlass/shimdns/lib/modifier/rewrite"
+)
 
 type Config struct {
 	ListenAddr string `yaml:"listen_addr"`
 
+	TLS TLSConfig `yaml:"tls"`
+	DoT DoTConfig `yaml:"dot"`
+	DoH DoHConfig `yaml:"doh"`
+
+	// views apply to queries only, zone transfers and NOTIFY messages use
+	// the records without views
+	Views []ViewConfig `yaml:"views"`
+	// select views using the EDNS client subnet option when present
+	ViewsECS bool `yaml:"views_ecs"`
+
+	Zones  []ZoneConfig `yaml:"zones"`
+	Notify NotifyConfig `yaml:"notify"`
+	// http path serving the DS records of signed zones
+	DSPath string `yaml:"ds_path"`
+
+	QueryLog QueryLogConfig `yaml:"query_log"`
+
+	ACL       ACLConfig       `yaml:"acl"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+
+	Blocklist BlocklistConfig `yaml:"blocklist"`
+
 	Filter exp.Filter `yaml:"filter"`
 }
+
+type ViewConfig struct {
+	Name    string         `yaml:"name"`
+	Subnets []netip.Prefix `yaml:"subnets"`
+
+	Filter   exp.Filter       `yaml:"filter"`
+	Rewrites []rewrite.Config `yaml:"rewrites"`
+}
+
+type ZoneConfig struct {
+	Name string   `yaml:"name"`
+	NS   []string `yaml:"ns"`
+	Mbox string   `yaml:"mbox"`
+
+	// secondaries to send NOTIFY messages to when the zone changes, they
+	// are allowed to transfer the zone
+	Secondaries []string `yaml:"secondaries"`
+
+	DNSSEC *DNSSECConfig `yaml:"dnssec"`
+}
+
+type DNSSECConfig struct {
+	// BIND style key files prefixes, "<prefix>.key" and "<prefix>.private"
+	// are read. The KSK is used for all records when no ZSK is set.
+	KSK string `yaml:"ksk"`
+	ZSK string `yaml:"zsk"`
+
+	// use NSEC3 instead of NSEC for negative answers
+	NSEC3 bool `yaml:"nsec3"`
+	// validity period of signatures
+	Validity time.Duration `yaml:"validity"`
+}
+
+type NotifyConfig struct {
+	Timeout       time.Duration `yaml:"timeout"`
+	RetryInterval time.Duration `yaml:"retry_interval"`
+}
+
+type TLSConfig struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+}
+
+type DoTConfig struct {
+	ListenAddr string `yaml:"listen_addr"`
+}
+
+type DoHConfig struct {
+	// when empty, the handler is registered on the shared http listener
+	ListenAddr string `yaml:"listen_addr"`
+	Path       string `yaml:"path"`
+}
+
+func (c DoHConfig) enabled() bool {
+	return c.ListenAddr != "" || c.Path != ""
+}
+
+type QueryLogConfig struct {
+	// dnstap frame-streams output, to a file or a unix socket
+	DnstapFile   string `yaml:"dnstap_file"`
+	DnstapSocket string `yaml:"dnstap_socket"`
+	// json lines output, "-" for stdout
+	JSONFile string `yaml:"json_file"`
+
+	// fraction of queries to log, all of them when unset
+	SampleRate float64 `yaml:"sample_rate"`
+	// only log queries for names under these domains
+	Names []string `yaml:"names"`
+	// only log queries from clients in these subnets
+	Subnets []netip.Prefix `yaml:"subnets"`
+}
+
+func (c QueryLogConfig) enabled() bool {
+	return c.DnstapFile != "" || c.DnstapSocket != "" || c.JSONFile != ""
+}
+
+type ACLConfig struct {
+	Query ACL `yaml:"query"`
+	// zone transfers are only allowed to the zone secondaries and to the
+	// clients in the allow list, an empty allow list allows no other client
+	Transfer ACL `yaml:"transfer"`
+	// applies to recursive queries for names outside of the served data
+	Recursion ACL `yaml:"recursion"`
+}
+
+// ACL denies clients in Deny, then allows clients in Allow, or all clients
+// when Allow is empty.
+type ACL struct {
+	Allow []netip.Prefix `yaml:"allow"`
+	Deny  []netip.Prefix `yaml:"deny"`
+}
+
+func (a ACL) allows(addr netip.Addr) bool {
+	for _, subnet := range a.Deny {
+		if subnet.Contains(addr) {
+			return false
+		}
+	}
+
+	if len(a.Allow) == 0 {
+		return true
+	}
+
+	for _, subnet := range a.Allow {
+		if subnet.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type RateLimitConfig struct {
+	// identical responses allowed per second and per client prefix, rate
+	// limiting is disabled when unset
+	ResponsesPerSecond float64 `yaml:"responses_per_second"`
+	// every nth limited response is sent truncated instead of dropped so
+	// legitimate clients can retry over TCP, 0 always drops
+	Slip int `yaml:"slip"`
+
+	IPv4PrefixLen int `yaml:"ipv4_prefix_len"`
+	IPv6PrefixLen int `yaml:"ipv6_prefix_len"`
+}
+
+type BlocklistConfig struct {
+	// files or http(s) URLs in hosts file or plain domain format. Listed
+	// domains are blocked along with their subdomains.
+	Lists []string `yaml:"lists"`
+	// same format as lists, allowed domains and their subdomains are never
+	// blocked
+	Allowlists []string `yaml:"allowlists"`
+	Allow      []string `yaml:"allow"`
+
+	// interval at which lists are reloaded
+	Refresh time.Duration `yaml:"refresh"`
+	Timeout time.Duration `yaml:"timeout"`
+
+	// nxdomain, null (0.0.0.0 and ::) or redirect
+	Response string `yaml:"response"`
+	// addresses returned by the redirect response
+	Redirect []netip.Addr `yaml:"redirect"`
+}
+
+func (c BlocklistConfig) enabled() bool {
+	return len(c.Lists) > 0
+}
@@ -0,0 +1,569 @@
+package dnsserver
+
+import (
+	"crypto"
+	"encoding/base32"
+	"fmt"
+	"hash/fnv"
+	"math/big"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	dnssrv "github.com/miekg/dns"
+)
+
+const (
+	defaultSignatureValidity = 7 * 24 * time.Hour
+	signatureInceptionOffset = time.Hour
+	maxCachedSignatures      = 10000
+)
+
+// signer signs the records of a zone on the fly.
+type signer struct {
+	zone *zone
+	cfg  DNSSECConfig
+
+	ksk     *dnssrv.DNSKEY
+	kskPriv crypto.Signer
+	zsk     *dnssrv.DNSKEY
+	zskPriv crypto.Signer
+
+	lock   sync.Mutex
+	serial uint32
+	cache  map[string]*dnssrv.RRSIG
+}
+
+func newSigner(z *zone, cfg DNSSECConfig) (*signer, error) {
+	if cfg.Validity == 0 {
+		cfg.Validity = defaultSignatureValidity
+	}
+
+	s := &signer{
+		zone:  z,
+		cfg:   cfg,
+		cache: map[string]*dnssrv.RRSIG{},
+	}
+
+	var err error
+
+	if cfg.KSK == "" {
+		return nil, fmt.Errorf("missing ksk")
+	}
+
+	s.ksk, s.kskPriv, err = loadKey(z.cfg.Name, cfg.KSK)
+	if err != nil {
+		return nil, fmt.Errorf("ksk: %w", err)
+	}
+
+	s.zsk, s.zskPriv = s.ksk, s.kskPriv
+	if cfg.ZSK != "" {
+		s.zsk, s.zskPriv, err = loadKey(z.cfg.Name, cfg.ZSK)
+		if err != nil {
+			return nil, fmt.Errorf("zsk: %w", err)
+		}
+	}
+
+	return s, nil
+}
+
+func loadKey(zone string, prefix string) (*dnssrv.DNSKEY, crypto.Signer, error) {
+	pubFile, err := os.Open(prefix + ".key")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() { _ = pubFile.Close() }()
+
+	rr, err := dnssrv.ReadRR(pubFile, pubFile.Name())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, ok := rr.(*dnssrv.DNSKEY)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s: not a DNSKEY record", pubFile.Name())
+	}
+
+	if dnssrv.CanonicalName(key.Hdr.Name) != zone {
+		return nil, nil, fmt.Errorf("%s: key is for %s", pubFile.Name(), key.Hdr.Name)
+	}
+
+	privFile, err := os.Open(prefix + ".private")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() { _ = privFile.Close() }()
+
+	priv, err := key.ReadPrivateKey(privFile, privFile.Name())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	privSigner, ok := priv.(crypto.Signer)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s: unsupported private key", privFile.Name())
+	}
+
+	key.Hdr.Name = zone
+	key.Hdr.Ttl = ttl
+
+	return key, privSigner, nil
+}
+
+func (s *signer) dnskeys() []dnssrv.RR {
+	if s.ksk == s.zsk {
+		return []dnssrv.RR{s.ksk}
+	}
+
+	return []dnssrv.RR{s.ksk, s.zsk}
+}
+
+func (s *signer) ds() *dnssrv.DS {
+	return s.ksk.ToDS(dnssrv.SHA256)
+}
+
+// sign returns the signature of rrset. name is the owner used for signing,
+// which is the wildcard name for synthesized records.
+func (s *signer) sign(name string, rrset []dnssrv.RR) (*dnssrv.RRSIG, error) {
+	rrtype := rrset[0].Header().Rrtype
+
+	signed := make([]dnssrv.RR, len(rrset))
+	for i, rr := range rrset {
+		signed[i] = dnssrv.Copy(rr)
+		signed[i].Header().Name = name
+	}
+
+	key := rrsetKey(name, signed)
+	now := time.Now()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if serial := s.zone.serial.Load(); serial != s.serial || len(s.cache) > maxCachedSignatures {
+		s.serial = serial
+		clear(s.cache)
+	}
+
+	if sig, ok := s.cache[key]; ok && time.Unix(int64(sig.Expiration), 0).Sub(now) > s.cfg.Validity/2 {
+		return sig, nil
+	}
+
+	k, priv := s.zsk, s.zskPriv
+	if rrtype == dnssrv.TypeDNSKEY {
+		k, priv = s.ksk, s.kskPriv
+	}
+
+	sig := &dnssrv.RRSIG{
+		Hdr: dnssrv.RR_Header{
+			Ttl: rrset[0].Header().Ttl,
+		},
+		Algorithm:  k.Algorithm,
+		KeyTag:     k.KeyTag(),
+		SignerName: s.zone.cfg.Name,
+		Inception:  uint32(now.Add(-signatureInceptionOffset).Unix()),
+		Expiration: uint32(now.Add(s.cfg.Validity).Unix()),
+	}
+
+	err := sig.Sign(priv, signed)
+	if err != nil {
+		return nil, err
+	}
+
+	s.cache[key] = sig
+
+	return sig, nil
+}
+
+// denial returns the records proving that name has none of the requested
+// type. Answers are generated on the fly so name is always claimed to exist
+// with the given types, which avoids enumerating the zone to prove that a
+// name does not exist.
+func (s *signer) denial(name string, types []uint16) []dnssrv.RR {
+	hdr := func(owner string, t uint16) dnssrv.RR_Header {
+		return dnssrv.RR_Header{
+			Name:   owner,
+			Rrtype: t,
+			Class:  dnssrv.ClassINET,
+			Ttl:    ttl,
+		}
+	}
+
+	if !s.cfg.NSEC3 {
+		types = append(types, dnssrv.TypeRRSIG, dnssrv.TypeNSEC)
+		slices.Sort(types)
+
+		return []dnssrv.RR{&dnssrv.NSEC{
+			Hdr:        hdr(name, dnssrv.TypeNSEC),
+			NextDomain: "\\000." + name,
+			TypeBitMap: slices.Compact(types),
+		}}
+	}
+
+	types = append(types, dnssrv.TypeRRSIG)
+	slices.Sort(types)
+
+	hash := dnssrv.HashName(name, dnssrv.SHA1, 0, "")
+
+	return []dnssrv.RR{&dnssrv.NSEC3{
+		Hdr:        hdr(strings.ToLower(hash)+"."+s.zone.cfg.Name, dnssrv.TypeNSEC3),
+		Hash:       dnssrv.SHA1,
+		Iterations: 0,
+		SaltLength: 0,
+		HashLength: 20,
+		NextDomain: nextHash(hash),
+		TypeBitMap: slices.Compact(types),
+	}}
+}
+
+// noCloserMatch returns the record proving that no name closer than wildcard
+// matches name, which validators require for answers synthesized from a
+// wildcard, as per RFC 4035 section 5.3.4.
+func (s *signer) noCloserMatch(name string, wildcard string) dnssrv.RR {
+	if !s.cfg.NSEC3 {
+		return &dnssrv.NSEC{
+			Hdr: dnssrv.RR_Header{
+				Name:   prevName(name),
+				Rrtype: dnssrv.TypeNSEC,
+				Class:  dnssrv.ClassINET,
+				Ttl:    ttl,
+			},
+			NextDomain: "\\000." + name,
+			TypeBitMap: []uint16{dnssrv.TypeRRSIG, dnssrv.TypeNSEC},
+		}
+	}
+
+	// the next closer name is one label below the closest encloser, the
+	// parent of the wildcard
+	labels := dnssrv.SplitDomainName(name)
+	encloser := dnssrv.CountLabel(wildcard) - 1
+	nextCloser := dnssrv.Fqdn(strings.Join(labels[len(labels)-encloser-1:], "."))
+
+	hash := dnssrv.HashName(nextCloser, dnssrv.SHA1, 0, "")
+
+	return &dnssrv.NSEC3{
+		Hdr: dnssrv.RR_Header{
+			Name:   strings.ToLower(prevHash(hash)) + "." + s.zone.cfg.Name,
+			Rrtype: dnssrv.TypeNSEC3,
+			Class:  dnssrv.ClassINET,
+			Ttl:    ttl,
+		},
+		Hash:       dnssrv.SHA1,
+		Iterations: 0,
+		SaltLength: 0,
+		HashLength: 20,
+		NextDomain: nextHash(hash),
+	}
+}
+
+func (s *signer) nsec3param() *dnssrv.NSEC3PARAM {
+	return &dnssrv.NSEC3PARAM{
+		Hdr: dnssrv.RR_Header{
+			Name:   s.zone.cfg.Name,
+			Rrtype: dnssrv.TypeNSEC3PARAM,
+			Class:  dnssrv.ClassINET,
+			Ttl:    ttl,
+		},
+		Hash:       dnssrv.SHA1,
+		Iterations: 0,
+		SaltLength: 0,
+	}
+}
+
+// nextHash returns the base32hex encoded hash immediately following hash.
+func nextHash(hash string) string {
+	return offsetHash(hash, 1)
+}
+
+// prevHash returns the base32hex encoded hash immediately preceding hash.
+func prevHash(hash string) string {
+	return offsetHash(hash, -1)
+}
+
+func offsetHash(hash string, offset int64) string {
+	enc := base32.HexEncoding.WithPadding(base32.NoPadding)
+
+	buf, err := enc.DecodeString(strings.ToUpper(hash))
+	if err != nil {
+		return hash
+	}
+
+	n := new(big.Int).SetBytes(buf)
+	n.Add(n, big.NewInt(offset))
+
+	// wrap around
+	n.Mod(n, new(big.Int).Lsh(big.NewInt(1), uint(len(buf)*8)))
+
+	res := make([]byte, len(buf))
+	n.FillBytes(res)
+
+	return enc.EncodeToString(res)
+}
+
+// prevName returns a name immediately preceding name in canonical order, as
+// per RFC 4471 section 3.1.2: the last octet of the first label is removed
+// if it is zero, or decremented and the label filled with \255 octets.
+func prevName(name string) string {
+	labels := dnssrv.SplitDomainName(name)
+	if len(labels) == 0 {
+		return name
+	}
+
+	first := unescapeLabel(labels[0])
+
+	// wire length of name, the filled name must not exceed 255 octets
+	size := 1
+	for _, l := range labels {
+		size += len(unescapeLabel(l)) + 1
+	}
+
+	last := first[len(first)-1]
+	first = first[:len(first)-1]
+	if last == 0 {
+		if len(first) == 0 {
+			return dnssrv.Fqdn(strings.Join(labels[1:], "."))
+		}
+	} else {
+		first = append(first, last-1)
+		for range min(63-len(first), 255-size) {
+			first = append(first, 0xff)
+		}
+	}
+
+	return dnssrv.Fqdn(strings.Join(append([]string{escapeLabel(first)}, labels[1:]...), "."))
+}
+
+// unescapeLabel returns the octets of a label in presentation format.
+func unescapeLabel(label string) []byte {
+	res := []byte{}
+	for i := 0; i < len(label); i++ {
+		c := label[i]
+		if c == '\\' && i+1 < len(label) {
+			i++
+			c = label[i]
+			if i+2 < len(label) && isDigit(label[i]) && isDigit(label[i+1]) && isDigit(label[i+2]) {
+				c = (label[i]-'0')*100 + (label[i+1]-'0')*10 + (label[i+2] - '0')
+				i += 2
+			}
+		}
+		res = append(res, c)
+	}
+
+	return res
+}
+
+// escapeLabel returns label in presentation format.
+func escapeLabel(label []byte) string {
+	b := strings.Builder{}
+	for _, c := range label {
+		if isDigit(c) || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '-' || c == '_' || c == '*' {
+			b.WriteByte(c)
+			continue
+		}
+
+		fmt.Fprintf(&b, "\\%03d", c)
+	}
+
+	return b.String()
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func rrsetKey(name string, rrset []dnssrv.RR) string {
+	rdata := make([]string, len(rrset))
+	for i, rr := range rrset {
+		rdata[i] = rr.String()
+	}
+	slices.Sort(rdata)
+
+	h := fnv.New64a()
+	for _, r := range rdata {
+		_, _ = h.Write([]byte(r))
+	}
+
+	return fmt.Sprintf("%s/%d/%x", dnssrv.CanonicalName(name), rrset[0].Header().Rrtype, h.Sum64())
+}
+
+// dnssecOK reports whether the client asked for DNSSEC records.
+func dnssecOK(req *dnssrv.Msg) bool {
+	opt := req.IsEdns0()
+	return opt != nil && opt.Do()
+}
+
+// sign adds signatures and denial of existence records for signed zones to
+// res.
+func (d *DNSServer) sign(st *store, req *dnssrv.Msg, res *dnssrv.Msg) {
+	res.Answer = d.signSection(st, res.Answer)
+
+	if len(req.Question) > 0 {
+		d.deny(st, req.Question[0], res)
+	}
+
+	d.proveWildcards(st, res)
+
+	res.Ns = d.signSection(st, res.Ns)
+}
+
+func (d *DNSServer) signSection(st *store, rrs []dnssrv.RR) []dnssrv.RR {
+	type rrsetID struct {
+		name  string
+		rtype uint16
+	}
+
+	ids := []rrsetID{}
+	rrsets := map[rrsetID][]dnssrv.RR{}
+
+	for _, rr := range rrs {
+		id := rrsetID{
+			name:  dnssrv.CanonicalName(rr.Header().Name),
+			rtype: rr.Header().Rrtype,
+		}
+
+		if id.rtype == dnssrv.TypeRRSIG {
+			continue
+		}
+
+		if _, ok := rrsets[id]; !ok {
+			ids = append(ids, id)
+		}
+		rrsets[id] = append(rrsets[id], rr)
+	}
+
+	for _, id := range ids {
+		z := st.zoneFor(id.name)
+		if z == nil || z.signer == nil {
+			continue
+		}
+
+		rrset := rrsets[id]
+
+		// synthesized records are signed with their wildcard owner
+		signName := id.name
+		if wildcard := wildcardOwner(st, id.name, id.rtype); wildcard != "" {
+			signName = wildcard
+		}
+
+		sig, err := z.signer.sign(signName, rrset)
+		if err != nil {
+			d.log.Warn("dnssec: sign", "name", id.name, "type", dnssrv.TypeToString[id.rtype], "err", err)
+			continue
+		}
+
+		sig = dnssrv.Copy(sig).(*dnssrv.RRSIG)
+		sig.Hdr.Name = rrset[0].Header().Name
+		rrs = append(rrs, sig)
+	}
+
+	return rrs
+}
+
+// deny adds a denial of existence to res if it has no answer for q.
+func (d *DNSServer) deny(st *store, q dnssrv.Question, res *dnssrv.Msg) {
+	name := dnssrv.CanonicalName(q.Name)
+
+	for _, rr := range res.Answer {
+		hdr := rr.Header()
+		if dnssrv.CanonicalName(hdr.Name) != name {
+			continue
+		}
+
+		if hdr.Rrtype == q.Qtype {
+			return
+		}
+
+		if cname, ok := rr.(*dnssrv.CNAME); ok {
+			name = dnssrv.CanonicalName(cname.Target)
+		}
+	}
+
+	z := st.zoneFor(name)
+	if z == nil || z.signer == nil {
+		return
+	}
+
+	types := []uint16{}
+	for t := range st.lookup(name) {
+		if rtype, ok := dnssrv.StringToType[string(t)]; ok {
+			types = append(types, rtype)
+		}
+	}
+
+	if name == z.cfg.Name {
+		types = append(types, dnssrv.TypeSOA, dnssrv.TypeDNSKEY)
+		if len(z.cfg.NS) > 0 {
+			types = append(types, dnssrv.TypeNS)
+		}
+		if z.signer.cfg.NSEC3 {
+			types = append(types, dnssrv.TypeNSEC3PARAM)
+		}
+	}
+
+	// signed negative answers carry the zone SOA, as per RFC 4035 section
+	// 3.1.3, answer already added it unless the CNAME chain was cut short
+	if !slices.ContainsFunc(res.Ns, func(rr dnssrv.RR) bool { return rr.Header().Rrtype == dnssrv.TypeSOA }) {
+		res.Ns = append(res.Ns, z.soa())
+	}
+	res.Ns = append(res.Ns, z.signer.denial(name, types)...)
+}
+
+// proveWildcards adds to res the proof that answers synthesized from a
+// wildcard had no closer match.
+func (d *DNSServer) proveWildcards(st *store, res *dnssrv.Msg) {
+	seen := map[string]bool{}
+
+	for _, rr := range res.Answer {
+		hdr := rr.Header()
+		name := dnssrv.CanonicalName(hdr.Name)
+		if hdr.Rrtype == dnssrv.TypeRRSIG || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		wildcard := wildcardOwner(st, name, hdr.Rrtype)
+		if wildcard == "" {
+			continue
+		}
+
+		z := st.zoneFor(name)
+		if z == nil || z.signer == nil {
+			continue
+		}
+
+		res.Ns = append(res.Ns, z.signer.noCloserMatch(name, wildcard))
+	}
+}
+
+// wildcardOwner returns the wildcard the records of type rtype at name are
+// synthesized from, or an empty string if name owns them.
+func wildcardOwner(st *store, name string, rtype uint16) string {
+	recs := st.get(name, dns.Type(dnssrv.TypeToString[rtype]))
+	if len(recs) == 0 {
+		return ""
+	}
+
+	owner := dnssrv.CanonicalName(recs[0].Name)
+	if owner == name {
+		return ""
+	}
+
+	return owner
+}
+
+// serveDS lists the DS records of the signed zones, to be published in their
+// parent zones.
+func (d *DNSServer) serveDS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+
+	for _, z := range d.zones {
+		if z.signer == nil {
+			continue
+		}
+
+		_, _ = fmt.Fprintln(w, z.signer.ds().String())
+	}
+}
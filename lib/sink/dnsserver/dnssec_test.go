@@ -0,0 +1,241 @@
+package dnsserver
+
+import (
+	"context"
+	"log/slog"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	dnssrv "github.com/miekg/dns"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/require"
+)
+
+func testSignedServer(t *testing.T, nsec3 bool, recs []dns.Record) (*DNSServer, *dnssrv.DNSKEY) {
+	key := &dnssrv.DNSKEY{
+		Hdr:       dnssrv.RR_Header{Name: "lan.", Rrtype: dnssrv.TypeDNSKEY, Class: dnssrv.ClassINET, Ttl: ttl},
+		Flags:     257,
+		Protocol:  3,
+		Algorithm: dnssrv.ECDSAP256SHA256,
+	}
+	priv, err := key.Generate(256)
+	require.NoError(t, err)
+
+	prefix := filepath.Join(t.TempDir(), "Klan")
+	require.NoError(t, os.WriteFile(prefix+".key", []byte(key.String()+"\n"), 0o600))
+	require.NoError(t, os.WriteFile(prefix+".private", []byte(key.PrivateKeyString(priv)), 0o600))
+
+	z := newZone(ZoneConfig{Name: "lan", NS: []string{"ns.lan"}})
+	z.signer, err = newSigner(z, DNSSECConfig{KSK: prefix, NSEC3: nsec3})
+	require.NoError(t, err)
+
+	d := &DNSServer{
+		log:      slog.Default(),
+		zones:    []*zone{z},
+		notifier: newNotifier(slog.Default(), NotifyConfig{}),
+	}
+	require.NoError(t, d.Write(context.Background(), recs))
+
+	return d, z.signer.ksk
+}
+
+func signedQuery(d *DNSServer, name string, qtype uint16) *dnssrv.Msg {
+	req := new(dnssrv.Msg)
+	req.SetQuestion(name, qtype)
+	req.SetEdns0(dnssrv.DefaultMsgSize, true)
+
+	w := newTestWriter("192.168.1.10")
+	d.handler(w, req)
+
+	return w.msgs[0]
+}
+
+// verify checks that every RRset of rrs is covered by a valid signature.
+func verify(t *testing.T, key *dnssrv.DNSKEY, rrs []dnssrv.RR) {
+	rrsets := map[string][]dnssrv.RR{}
+	sigs := map[string]*dnssrv.RRSIG{}
+
+	for _, rr := range rrs {
+		if sig, ok := rr.(*dnssrv.RRSIG); ok {
+			sigs[sig.Hdr.Name+dnssrv.TypeToString[sig.TypeCovered]] = sig
+			continue
+		}
+
+		k := rr.Header().Name + dnssrv.TypeToString[rr.Header().Rrtype]
+		rrsets[k] = append(rrsets[k], rr)
+	}
+
+	require.NotEmpty(t, rrsets)
+
+	for k, rrset := range rrsets {
+		sig, ok := sigs[k]
+		require.True(t, ok, "missing signature for %s", k)
+		require.NoError(t, sig.Verify(key, rrset), k)
+		require.True(t, sig.ValidityPeriod(time.Now()), k)
+	}
+}
+
+func TestDNSSECSignAnswers(t *testing.T) {
+	d, key := testSignedServer(t, false, []dns.Record{
+		{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+		{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.2")},
+		{Type: dns.A, Name: "*.apps.lan.", Address: netip.MustParseAddr("192.168.1.3")},
+		{Type: dns.CNAME, Name: "www.lan.", Target: "foo.lan."},
+	})
+
+	for _, tc := range []struct {
+		Name string
+		Type uint16
+	}{
+		{Name: "foo.lan.", Type: dnssrv.TypeA},
+		{Name: "www.lan.", Type: dnssrv.TypeA},
+		{Name: "bar.apps.lan.", Type: dnssrv.TypeA},
+		{Name: "lan.", Type: dnssrv.TypeSOA},
+		{Name: "lan.", Type: dnssrv.TypeNS},
+		{Name: "lan.", Type: dnssrv.TypeDNSKEY},
+	} {
+		t.Run(tc.Name+dnssrv.TypeToString[tc.Type], func(t *testing.T) {
+			res := signedQuery(d, tc.Name, tc.Type)
+			require.Equal(t, dnssrv.RcodeSuccess, res.Rcode)
+			require.True(t, res.IsEdns0().Do())
+			verify(t, key, res.Answer)
+
+			// synthesized from the wildcard, proven to have no closer match
+			if tc.Name == "bar.apps.lan." {
+				verify(t, key, res.Ns)
+
+				nsec := []*dnssrv.NSEC{}
+				for _, rr := range res.Ns {
+					if rr, ok := rr.(*dnssrv.NSEC); ok {
+						nsec = append(nsec, rr)
+					}
+				}
+				require.Len(t, nsec, 1)
+				require.Equal(t, prevName("bar.apps.lan."), nsec[0].Hdr.Name)
+				require.Equal(t, "\\000.bar.apps.lan.", nsec[0].NextDomain)
+			}
+		})
+	}
+
+	// clients not asking for DNSSEC get no signatures
+	res := query(d, "foo.lan.", dnssrv.TypeA)
+	require.Len(t, res.Answer, 2)
+}
+
+func TestDNSSECDenial(t *testing.T) {
+	for _, nsec3 := range []bool{false, true} {
+		d, key := testSignedServer(t, nsec3, []dns.Record{
+			{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+		})
+
+		res := signedQuery(d, "foo.lan.", dnssrv.TypeAAAA)
+		require.Empty(t, res.Answer)
+		verify(t, key, res.Ns)
+
+		var types []uint16
+		for _, rr := range res.Ns {
+			switch rr := rr.(type) {
+			case *dnssrv.NSEC:
+				require.False(t, nsec3)
+				require.Equal(t, "foo.lan.", rr.Hdr.Name)
+				types = rr.TypeBitMap
+			case *dnssrv.NSEC3:
+				require.True(t, nsec3)
+				require.True(t, rr.Match("foo.lan."))
+				types = rr.TypeBitMap
+			}
+		}
+
+		require.Contains(t, types, dnssrv.TypeA)
+		require.NotContains(t, types, dnssrv.TypeAAAA)
+
+		_, ok := res.Ns[0].(*dnssrv.SOA)
+		require.True(t, ok)
+
+		soas := lo.CountBy(res.Ns, func(rr dnssrv.RR) bool { return rr.Header().Rrtype == dnssrv.TypeSOA })
+		require.Equal(t, 1, soas)
+	}
+}
+
+func TestDNSSECWildcardNSEC3(t *testing.T) {
+	d, key := testSignedServer(t, true, []dns.Record{
+		{Type: dns.A, Name: "*.apps.lan.", Address: netip.MustParseAddr("192.168.1.3")},
+	})
+
+	res := signedQuery(d, "foo.bar.apps.lan.", dnssrv.TypeA)
+	require.Len(t, res.Answer, 2)
+	verify(t, key, res.Ns)
+
+	nsec3 := []*dnssrv.NSEC3{}
+	for _, rr := range res.Ns {
+		if rr, ok := rr.(*dnssrv.NSEC3); ok {
+			nsec3 = append(nsec3, rr)
+		}
+	}
+	require.Len(t, nsec3, 1)
+	// the next closer name, below the closest encloser apps.lan.
+	require.True(t, nsec3[0].Cover("bar.apps.lan."))
+	require.False(t, nsec3[0].Cover("apps.lan."))
+	require.False(t, nsec3[0].Cover("*.apps.lan."))
+}
+
+func TestDNSSECNSEC3Param(t *testing.T) {
+	d, key := testSignedServer(t, true, nil)
+
+	res := signedQuery(d, "lan.", dnssrv.TypeNSEC3PARAM)
+	require.Len(t, res.Answer, 2)
+	verify(t, key, res.Answer)
+
+	param, ok := res.Answer[0].(*dnssrv.NSEC3PARAM)
+	require.True(t, ok)
+	require.Equal(t, dnssrv.SHA1, param.Hash)
+	require.Zero(t, param.Iterations)
+
+	// the apex type bitmap lists it
+	res = signedQuery(d, "lan.", dnssrv.TypeA)
+	var types []uint16
+	for _, rr := range res.Ns {
+		if rr, ok := rr.(*dnssrv.NSEC3); ok {
+			types = rr.TypeBitMap
+		}
+	}
+	require.Contains(t, types, dnssrv.TypeNSEC3PARAM)
+
+	// not served without NSEC3
+	d, _ = testSignedServer(t, false, nil)
+	res = signedQuery(d, "lan.", dnssrv.TypeNSEC3PARAM)
+	require.Empty(t, res.Answer)
+}
+
+func TestNextHash(t *testing.T) {
+	require.Equal(t, "00000001", nextHash("00000000"))
+	require.Equal(t, "00000010", nextHash("0000000V"))
+	require.Equal(t, "00000000", nextHash("VVVVVVVV"))
+}
+
+func TestPrevHash(t *testing.T) {
+	require.Equal(t, "00000000", prevHash("00000001"))
+	require.Equal(t, "0000000V", prevHash("00000010"))
+	require.Equal(t, "VVVVVVVV", prevHash("00000000"))
+}
+
+func TestPrevName(t *testing.T) {
+	require.Equal(t, "bar.lan.", prevName("\\000.bar.lan."))
+	require.Equal(t, "ba\\000.lan.", prevName("ba\\000\\000.lan."))
+
+	prev := prevName("bar.lan.")
+	require.True(t, strings.HasPrefix(prev, "baq\\255\\255"))
+	require.Equal(t, 63, len(unescapeLabel(dnssrv.SplitDomainName(prev)[0])))
+
+	// the filled name does not exceed 255 octets
+	long := strings.Repeat(strings.Repeat("a", 63)+".", 3) + "lan."
+	prev = prevName("b." + long)
+	n, err := dnssrv.PackDomainName(prev, make([]byte, 255), 0, nil, false)
+	require.NoError(t, err)
+	require.Equal(t, 255, n)
+}
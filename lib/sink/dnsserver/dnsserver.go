@@ -2,11 +2,16 @@ package dnsserver
 
 import (
 	"context"
+	"crypto/tls"
+	"fmt"
 	"log"
 	"log/slog"
 	"net"
+	"net/http"
 	"net/netip"
+	"slices"
 	"sync"
+	"sync/atomic"
 
 	"github.com/ShimmerGlass/shimdns/lib/dns"
 	dnssrv "github.com/miekg/dns"
@@ -16,29 +21,134 @@ type DNSServer struct {
 	log *slog.Logger
 	cfg Config
 
-	lock  sync.RWMutex
-	store *store
+	// serializes writes, queries read the current store without locking
+	lock  sync.Mutex
+	store atomic.Pointer[store]
+	views []*view
+	zones []*zone
+
+	notifier    *notifier
+	queryLog    *queryLogger
+	rateLimiter *rateLimiter
+	blocklist   *blocklist
+
+	counters counters
 }
 
-func New(log *slog.Logger, cfg Config) (*DNSServer, error) {
+func New(log *slog.Logger, cfg Config, mux *http.ServeMux) (*DNSServer, error) {
+	if cfg.DoH.enabled() && cfg.DoH.Path == "" {
+		cfg.DoH.Path = defaultDoHPath
+	}
+
+	if cfg.DoH.enabled() && cfg.DoH.ListenAddr == "" && mux == nil {
+		return nil, fmt.Errorf("doh: no listen_addr and no shared http listener configured")
+	}
+
 	d := &DNSServer{
-		log:   log.With("sink", "dnsserver"),
-		cfg:   cfg,
-		store: &store{},
+		log: log.With("sink", "dnsserver"),
+		cfg: cfg,
+	}
+
+	for i, vcfg := range cfg.Views {
+		v, err := newView(d.log, vcfg)
+		if err != nil {
+			return nil, fmt.Errorf("view %q #%d: %w", vcfg.Name, i, err)
+		}
+
+		d.views = append(d.views, v)
+	}
+
+	for _, zcfg := range cfg.Zones {
+		if zcfg.Name == "" {
+			return nil, fmt.Errorf("zone: missing name")
+		}
+
+		z := newZone(zcfg)
+
+		if zcfg.DNSSEC != nil {
+			var err error
+			z.signer, err = newSigner(z, *zcfg.DNSSEC)
+			if err != nil {
+				return nil, fmt.Errorf("zone %s: dnssec: %w", z.cfg.Name, err)
+			}
+
+			d.log.Info("zone signed", "zone", z.cfg.Name, "ds", z.signer.ds().String())
+		}
+
+		d.zones = append(d.zones, z)
+	}
+
+	d.store.Store(newStore(nil, d.zones))
+	d.notifier = newNotifier(d.log, cfg.Notify)
+
+	if cfg.QueryLog.enabled() {
+		var err error
+		d.queryLog, err = newQueryLogger(d.log, cfg.QueryLog)
+		if err != nil {
+			return nil, fmt.Errorf("query log: %w", err)
+		}
+	}
+
+	if cfg.RateLimit.ResponsesPerSecond > 0 {
+		d.rateLimiter = newRateLimiter(cfg.RateLimit)
+	}
+
+	if cfg.Blocklist.enabled() {
+		var err error
+		d.blocklist, err = newBlocklist(d.log, cfg.Blocklist)
+		if err != nil {
+			return nil, fmt.Errorf("blocklist: %w", err)
+		}
+
+		go d.blocklist.run(context.Background())
+	}
+
+	var certs *certReloader
+	if cfg.DoT.ListenAddr != "" || cfg.DoH.ListenAddr != "" {
+		var err error
+		certs, err = newCertReloader(d.log, cfg.TLS)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	go d.start("udp", cfg.ListenAddr, nil)
+	go d.start("tcp", cfg.ListenAddr, nil)
+
+	if cfg.DoT.ListenAddr != "" {
+		go d.start("tcp-tls", cfg.DoT.ListenAddr, certs.tlsConfig())
+	}
+
+	if cfg.DSPath != "" && mux != nil {
+		mux.HandleFunc("GET "+cfg.DSPath, d.serveDS)
+	}
+
+	if cfg.DoH.enabled() {
+		dohMux := mux
+		if cfg.DoH.ListenAddr != "" {
+			dohMux = http.NewServeMux()
+		}
+
+		dohMux.HandleFunc("GET "+cfg.DoH.Path, d.serveDoH)
+		dohMux.HandleFunc("POST "+cfg.DoH.Path, d.serveDoH)
+
+		if cfg.DoH.ListenAddr != "" {
+			go d.startDoH(dohMux, certs.tlsConfig())
+		}
 	}
-	go d.start()
 
 	return d, nil
 }
 
-func (d *DNSServer) start() {
+func (d *DNSServer) start(network string, addr string, tlsCfg *tls.Config) {
 	srv := dnssrv.Server{
-		Net:     "udp",
-		Addr:    d.cfg.ListenAddr,
-		Handler: dnssrv.HandlerFunc(d.handler),
+		Net:       network,
+		Addr:      addr,
+		TLSConfig: tlsCfg,
+		Handler:   dnssrv.HandlerFunc(d.handler),
 	}
 
-	d.log.Info("listening", "addr", d.cfg.ListenAddr)
+	d.log.Info("listening", "addr", addr, "net", network)
 
 	err := srv.ListenAndServe()
 	if err != nil {
@@ -46,35 +156,137 @@ func (d *DNSServer) start() {
 	}
 }
 
-func (d *DNSServer) Write(ctx context.Context, records []dns.Record) error {
-	d.lock.Lock()
-	defer d.lock.Unlock()
+func (d *DNSServer) startDoH(mux *http.ServeMux, tlsCfg *tls.Config) {
+	srv := http.Server{
+		Addr:      d.cfg.DoH.ListenAddr,
+		Handler:   mux,
+		TLSConfig: tlsCfg,
+	}
+
+	d.log.Info("listening", "addr", d.cfg.DoH.ListenAddr, "net", "https", "path", d.cfg.DoH.Path)
+
+	err := srv.ListenAndServeTLS("", "")
+	if err != nil {
+		log.Fatal(err)
+	}
+}
 
-	d.store.reset()
+func (d *DNSServer) Write(ctx context.Context, records []dns.Record) error {
+	records, err := d.cfg.Filter.Filter(records)
+	if err != nil {
+		return err
+	}
 
-	for _, rec := range records {
-		ok, err := d.cfg.Filter.Match(rec)
+	viewRecords := make([][]dns.Record, len(d.views))
+	for i, v := range d.views {
+		viewRecords[i], err = v.records(ctx, records)
 		if err != nil {
-			return err
+			return fmt.Errorf("view %q: %w", v.cfg.Name, err)
 		}
+	}
 
-		if !ok {
-			continue
+	changed := []*zone{}
+
+	d.lock.Lock()
+
+	st := newStore(records, d.zones)
+	d.store.Store(st)
+
+	for i, v := range d.views {
+		v.store.Store(newStore(viewRecords[i], d.zones))
+	}
+
+	for _, z := range d.zones {
+		if z.update(st.zone(z)) {
+			d.log.Info("zone changed", "zone", z.cfg.Name, "serial", z.serial.Load())
+			changed = append(changed, z)
 		}
+	}
 
-		d.store.add(rec)
+	d.lock.Unlock()
+
+	for _, z := range changed {
+		d.notifier.notify(z.cfg.Name, z.serial.Load(), z.cfg.Secondaries)
 	}
 
 	return nil
 }
 
 func (d *DNSServer) handler(w dnssrv.ResponseWriter, req *dnssrv.Msg) {
+	d.counters.queries.Add(1)
+
+	if d.queryLog != nil {
+		w = d.queryLog.wrap(w, req)
+	}
+
+	client := remoteAddrPort(w).Addr()
+	if !d.cfg.ACL.Query.allows(client) {
+		d.refuse(w, req)
+		return
+	}
+
+	if len(req.Question) == 1 && req.Question[0].Qtype == dnssrv.TypeAXFR {
+		d.transfer(w, req)
+		return
+	}
+
 	res := new(dnssrv.Msg)
 	res.SetReply(req)
 	res.Authoritative = true
 
+	do := dnssecOK(req)
+	if reqOpt := req.IsEdns0(); reqOpt != nil {
+		res.SetEdns0(dnssrv.DefaultMsgSize, do)
+	}
+
+	addr, ecs := d.clientAddr(w, req)
+	if ecs != nil {
+		opt := res.IsEdns0()
+		opt.Option = append(opt.Option, &dnssrv.EDNS0_SUBNET{
+			Code:          dnssrv.EDNS0SUBNET,
+			Family:        ecs.Family,
+			SourceNetmask: ecs.SourceNetmask,
+			SourceScope:   ecs.SourceNetmask,
+			Address:       slices.Clone(ecs.Address),
+		})
+	}
+
+	st := d.storeFor(addr)
+	blocked := false
+
 	for _, q := range req.Question {
-		d.answer(q, res)
+		// served records take precedence over blocklists
+		if d.blocklist != nil && st.lookup(q.Name) == nil && d.blocklist.blocks(q.Name) {
+			d.counters.blocked.Add(1)
+			d.blocklist.answer(q, res)
+			blocked = true
+			continue
+		}
+
+		d.answer(st, q, res)
+	}
+
+	if do {
+		d.sign(st, req, res)
+	}
+
+	if req.RecursionDesired && !blocked && !d.authoritative(st, req, res) && !d.cfg.ACL.Recursion.allows(client) {
+		d.refuse(w, req)
+		return
+	}
+
+	res, ok := d.rateLimit(w, req, res)
+	if !ok {
+		return
+	}
+
+	if transport(w) == transportUDP {
+		size := dnssrv.MinMsgSize
+		if opt := req.IsEdns0(); opt != nil {
+			size = int(max(opt.UDPSize(), dnssrv.MinMsgSize))
+		}
+
+		res.Truncate(size)
 	}
 
 	err := w.WriteMsg(res)
@@ -83,104 +295,145 @@ func (d *DNSServer) handler(w dnssrv.ResponseWriter, req *dnssrv.Msg) {
 	}
 }
 
-func (d *DNSServer) answer(q dnssrv.Question, res *dnssrv.Msg) {
-	d.lock.RLock()
-	defer d.lock.RUnlock()
+// authoritative reports whether res answers from the served data, as opposed
+// to a query we would need to recurse for.
+func (d *DNSServer) authoritative(st *store, req *dnssrv.Msg, res *dnssrv.Msg) bool {
+	if len(res.Answer) > 0 || len(res.Ns) > 0 {
+		return true
+	}
+
+	for _, q := range req.Question {
+		if st.lookup(q.Name) != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (d *DNSServer) answer(st *store, q dnssrv.Question, res *dnssrv.Msg) {
+	name := dnssrv.CanonicalName(q.Name)
+	owner := q.Name
+	seen := map[string]bool{}
 
 	// CNAME handling
-	cnames := d.store.get(q.Name, dns.CNAME)
-	if (q.Qtype == dnssrv.TypeA || q.Qtype == dnssrv.TypeAAAA) && len(cnames) > 0 {
-		target := cnames[0].Target
-
-		res.Answer = append(res.Answer, &dnssrv.CNAME{
-			Hdr: dnssrv.RR_Header{
-				Name:   q.Name,
-				Rrtype: dnssrv.TypeA,
-				Class:  dnssrv.ClassINET,
-				Ttl:    30,
-			},
-			Target: target,
-		})
+	for depth := 0; q.Qtype != dnssrv.TypeCNAME; depth++ {
+		cnames := st.get(name, dns.CNAME)
+		if len(cnames) == 0 {
+			break
+		}
+
+		seen[name] = true
+		if rr, ok := ownedRR(cnames[0], owner); ok {
+			res.Answer = append(res.Answer, rr)
+		}
 
-		d.answer(dnssrv.Question{
-			Name:   target,
-			Qtype:  q.Qtype,
-			Qclass: q.Qclass,
-		}, res)
+		target := dnssrv.CanonicalName(cnames[0].Target)
+		if seen[target] || depth >= maxCNAMEDepth {
+			d.log.Debug("cname chain not followed", "name", q.Name, "target", target, "depth", depth)
+			return
+		}
 
-		return
+		name = target
+		owner = target
 	}
 
+	answers := len(res.Answer)
+
 	switch q.Qtype {
-	case dnssrv.TypeA:
-		for _, rec := range d.store.get(q.Name, dns.A) {
-			res.Answer = append(res.Answer, &dnssrv.A{
-				Hdr: dnssrv.RR_Header{
-					Name:   q.Name,
-					Rrtype: dnssrv.TypeA,
-					Class:  dnssrv.ClassINET,
-					Ttl:    30,
-				},
-				A: addrNetipToNetDotIP(rec.Address),
-			})
-		}
-
-	case dnssrv.TypeAAAA:
-		for _, rec := range d.store.get(q.Name, dns.AAAA) {
-			res.Answer = append(res.Answer, &dnssrv.AAAA{
-				Hdr: dnssrv.RR_Header{
-					Name:   q.Name,
-					Rrtype: dnssrv.TypeAAAA,
-					Class:  dnssrv.ClassINET,
-					Ttl:    30,
-				},
-				AAAA: addrNetipToNetDotIP(rec.Address),
-			})
-		}
-
-	case dnssrv.TypePTR:
-		for _, rec := range d.store.get(q.Name, dns.PTR) {
-			res.Answer = append(res.Answer, &dnssrv.PTR{
-				Hdr: dnssrv.RR_Header{
-					Name:   q.Name,
-					Rrtype: dnssrv.TypePTR,
-					Class:  dnssrv.ClassINET,
-					Ttl:    30,
-				},
-				Ptr: rec.Ptr,
-			})
-		}
-
-	case dnssrv.TypeSRV:
-		for _, rec := range d.store.get(q.Name, dns.SRV) {
-			res.Answer = append(res.Answer, &dnssrv.SRV{
-				Hdr: dnssrv.RR_Header{
-					Name:   q.Name,
-					Rrtype: dnssrv.TypePTR,
-					Class:  dnssrv.ClassINET,
-					Ttl:    30,
-				},
-				Priority: rec.Priority,
-				Weight:   rec.Weight,
-				Port:     rec.Port,
-				Target:   rec.Target,
-			})
-		}
-
-	case dnssrv.TypeMX:
-		for _, rec := range d.store.get(q.Name, dns.MX) {
-			res.Answer = append(res.Answer, &dnssrv.MX{
-				Hdr: dnssrv.RR_Header{
-					Name:   q.Name,
-					Rrtype: dnssrv.TypePTR,
-					Class:  dnssrv.ClassINET,
-					Ttl:    30,
-				},
-				Preference: rec.Preference,
-				Mx:         rec.Mx,
-			})
+	case dnssrv.TypeSOA:
+		if z := st.zoneAt(name); z != nil {
+			res.Answer = append(res.Answer, z.soa())
+		}
+
+	case dnssrv.TypeNS:
+		if z := st.zoneAt(name); z != nil {
+			res.Answer = append(res.Answer, z.ns()...)
+		}
+
+	case dnssrv.TypeDNSKEY:
+		if z := st.zoneAt(name); z != nil && z.signer != nil {
+			res.Answer = append(res.Answer, z.signer.dnskeys()...)
+		}
+
+	case dnssrv.TypeNSEC3PARAM:
+		if z := st.zoneAt(name); z != nil && z.signer != nil && z.signer.cfg.NSEC3 {
+			res.Answer = append(res.Answer, z.signer.nsec3param())
+		}
+
+	default:
+		recs := st.get(name, dns.Type(dnssrv.TypeToString[q.Qtype]))
+		for _, rec := range recs {
+			if rr, ok := ownedRR(rec, owner); ok {
+				res.Answer = append(res.Answer, rr)
+			}
+		}
+
+		d.glue(st, recs, res)
+	}
+
+	// negative answers carry the zone SOA for caching, as per RFC 2308
+	if len(res.Answer) == answers {
+		if z := st.zoneFor(name); z != nil {
+			res.Ns = append(res.Ns, z.soa())
+		}
+	}
+}
+
+// glue adds the addresses of SRV and MX targets to the additional section.
+func (d *DNSServer) glue(st *store, recs []dns.Record, res *dnssrv.Msg) {
+	for _, rec := range recs {
+		var target string
+
+		switch rec.Type {
+		case dns.SRV:
+			target = rec.Target
+		case dns.MX:
+			target = rec.Mx
+		default:
+			continue
 		}
+
+		target = dnssrv.CanonicalName(target)
+
+		for _, t := range []dns.Type{dns.A, dns.AAAA} {
+			for _, addr := range st.get(target, t) {
+				rr, ok := ownedRR(addr, target)
+				if !ok || slices.ContainsFunc(res.Extra, func(e dnssrv.RR) bool { return dnssrv.IsDuplicate(e, rr) }) {
+					continue
+				}
+
+				res.Extra = append(res.Extra, rr)
+			}
+		}
+	}
+}
+
+const (
+	transportUDP = "udp"
+	transportTCP = "tcp"
+	transportDoT = "dot"
+	transportDoH = "doh"
+)
+
+// transport returns the protocol a query was received over.
+func transport(w dnssrv.ResponseWriter) string {
+	switch w := w.(type) {
+	case *loggedWriter:
+		return transport(w.ResponseWriter)
+	case *dohWriter:
+		return transportDoH
 	}
+
+	if cs, ok := w.(dnssrv.ConnectionStater); ok && cs.ConnectionState() != nil {
+		return transportDoT
+	}
+
+	if _, ok := w.RemoteAddr().(*net.UDPAddr); ok {
+		return transportUDP
+	}
+
+	return transportTCP
 }
 
 func addrNetipToNetDotIP(addr netip.Addr) net.IP {
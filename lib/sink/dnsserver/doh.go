@@ -0,0 +1,102 @@
+package dnsserver
+
+import (
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+
+	dnssrv "github.com/miekg/dns"
+)
+
+const (
+	defaultDoHPath = "/dns-query"
+	dohMediaType   = "application/dns-message"
+	dohMaxSize     = 65535
+)
+
+// serveDoH implements RFC 8484 DNS queries over HTTPS.
+func (d *DNSServer) serveDoH(w http.ResponseWriter, r *http.Request) {
+	var buf []byte
+	var err error
+
+	switch r.Method {
+	case http.MethodGet:
+		buf, err = base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+
+	case http.MethodPost:
+		if r.Header.Get("Content-Type") != dohMediaType {
+			http.Error(w, "unsupported media type", http.StatusUnsupportedMediaType)
+			return
+		}
+
+		buf, err = io.ReadAll(io.LimitReader(r.Body, dohMaxSize))
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req := new(dnssrv.Msg)
+	err = req.Unpack(buf)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	d.handler(newDoHWriter(w, r), req)
+}
+
+// dohWriter adapts an HTTP response to a dns ResponseWriter so DoH
+// queries go through the regular handler.
+type dohWriter struct {
+	w      http.ResponseWriter
+	local  net.Addr
+	remote net.Addr
+}
+
+func newDoHWriter(w http.ResponseWriter, r *http.Request) *dohWriter {
+	dw := &dohWriter{
+		w:      w,
+		remote: &net.TCPAddr{},
+	}
+
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		dw.local = addr
+	}
+
+	if addrPort, err := netip.ParseAddrPort(r.RemoteAddr); err == nil {
+		dw.remote = net.TCPAddrFromAddrPort(addrPort)
+	}
+
+	return dw
+}
+
+func (w *dohWriter) LocalAddr() net.Addr  { return w.local }
+func (w *dohWriter) RemoteAddr() net.Addr { return w.remote }
+
+func (w *dohWriter) WriteMsg(m *dnssrv.Msg) error {
+	buf, err := m.Pack()
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(buf)
+	return err
+}
+
+func (w *dohWriter) Write(buf []byte) (int, error) {
+	w.w.Header().Set("Content-Type", dohMediaType)
+	return w.w.Write(buf)
+}
+
+func (w *dohWriter) Close() error        { return nil }
+func (w *dohWriter) TsigStatus() error   { return nil }
+func (w *dohWriter) TsigTimersOnly(bool) {}
+func (w *dohWriter) Hijack()             {}
@@ -0,0 +1,57 @@
+package dnsserver
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	dnssrv "github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDoH(t *testing.T) {
+	d := testServer(t, []dns.Record{
+		{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+	})
+
+	srv := httptest.NewServer(http.HandlerFunc(d.serveDoH))
+	defer srv.Close()
+
+	query := new(dnssrv.Msg)
+	query.SetQuestion("foo.lan.", dnssrv.TypeA)
+	buf, err := query.Pack()
+	require.NoError(t, err)
+
+	requests := map[string]func() (*http.Response, error){
+		"get": func() (*http.Response, error) {
+			return http.Get(srv.URL + "?dns=" + base64.RawURLEncoding.EncodeToString(buf))
+		},
+		"post": func() (*http.Response, error) {
+			return http.Post(srv.URL, dohMediaType, bytes.NewReader(buf))
+		},
+	}
+
+	for name, do := range requests {
+		t.Run(name, func(t *testing.T) {
+			res, err := do()
+			require.NoError(t, err)
+			defer func() { _ = res.Body.Close() }()
+
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			require.Equal(t, dohMediaType, res.Header.Get("Content-Type"))
+
+			body, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+
+			msg := new(dnssrv.Msg)
+			require.NoError(t, msg.Unpack(body))
+			require.Len(t, msg.Answer, 1)
+			require.Equal(t, "192.168.1.1", msg.Answer[0].(*dnssrv.A).A.String())
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package dnsserver
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	dnssrv "github.com/miekg/dns"
+)
+
+const (
+	defaultNotifyTimeout       = 5 * time.Second
+	defaultNotifyRetryInterval = 30 * time.Second
+)
+
+// NotifyStatus is the state of the last NOTIFY sent to a secondary.
+type NotifyStatus struct {
+	Zone      string
+	Secondary string
+	Serial    uint32
+
+	Acknowledged bool
+	Attempts     int
+	// error of the last attempt
+	Err string
+}
+
+// notifier sends RFC 1996 NOTIFY messages to secondaries, retrying until
+// they are acknowledged or superseded by a newer serial.
+type notifier struct {
+	log *slog.Logger
+	cfg NotifyConfig
+
+	lock    sync.Mutex
+	pending map[string]context.CancelFunc
+	status  map[string]NotifyStatus
+}
+
+func newNotifier(log *slog.Logger, cfg NotifyConfig) *notifier {
+	if cfg.Timeout == 0 {
+		cfg.Timeout = defaultNotifyTimeout
+	}
+
+	if cfg.RetryInterval == 0 {
+		cfg.RetryInterval = defaultNotifyRetryInterval
+	}
+
+	return &notifier{
+		log:     log,
+		cfg:     cfg,
+		pending: map[string]context.CancelFunc{},
+		status:  map[string]NotifyStatus{},
+	}
+}
+
+func (n *notifier) notify(zone string, serial uint32, secondaries []string) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	for _, secondary := range secondaries {
+		addr := secondaryAddr(secondary)
+		key := zone + " " + addr
+
+		if cancel, ok := n.pending[key]; ok {
+			cancel()
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		n.pending[key] = cancel
+		n.status[key] = NotifyStatus{Zone: zone, Secondary: addr, Serial: serial}
+
+		go func() {
+			n.run(ctx, key, zone, serial, addr)
+
+			n.lock.Lock()
+			if ctx.Err() == nil {
+				delete(n.pending, key)
+			}
+			n.lock.Unlock()
+			cancel()
+		}()
+	}
+}
+
+func (n *notifier) run(ctx context.Context, key string, zone string, serial uint32, addr string) {
+	log := n.log.With("zone", zone, "serial", serial, "secondary", addr)
+
+	for attempt := 1; ; attempt++ {
+		err := n.send(ctx, zone, addr)
+		if ctx.Err() != nil {
+			log.Debug("notify superseded", "attempts", attempt)
+			return
+		}
+
+		n.setStatus(ctx, key, attempt, err)
+
+		if err == nil {
+			log.Info("notify acknowledged", "attempts", attempt)
+			return
+		}
+
+		log.Warn("notify failed", "attempts", attempt, "retry_in", n.cfg.RetryInterval, "err", err)
+
+		select {
+		case <-ctx.Done():
+			log.Debug("notify superseded", "attempts", attempt)
+			return
+		case <-time.After(n.cfg.RetryInterval):
+		}
+	}
+}
+
+// setStatus records the result of an attempt, unless the notify was
+// superseded.
+func (n *notifier) setStatus(ctx context.Context, key string, attempt int, err error) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	st := n.status[key]
+	st.Attempts = attempt
+	st.Acknowledged = err == nil
+	st.Err = ""
+	if err != nil {
+		st.Err = err.Error()
+	}
+	n.status[key] = st
+}
+
+// statuses returns the state of the last NOTIFY sent to each secondary.
+func (n *notifier) statuses() []NotifyStatus {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	return slices.SortedFunc(maps.Values(n.status), func(a, b NotifyStatus) int {
+		return cmp.Or(cmp.Compare(a.Zone, b.Zone), cmp.Compare(a.Secondary, b.Secondary))
+	})
+}
+
+func (n *notifier) send(ctx context.Context, zone string, addr string) error {
+	msg := new(dnssrv.Msg)
+	msg.SetNotify(zone)
+
+	client := dnssrv.Client{
+		Net:     "udp",
+		Timeout: n.cfg.Timeout,
+	}
+
+	res, _, err := client.ExchangeContext(ctx, msg, addr)
+	if err != nil {
+		return err
+	}
+
+	if res.Opcode != dnssrv.OpcodeNotify {
+		return fmt.Errorf("unexpected opcode %s", dnssrv.OpcodeToString[res.Opcode])
+	}
+
+	if res.Rcode != dnssrv.RcodeSuccess {
+		return fmt.Errorf("rcode %s", dnssrv.RcodeToString[res.Rcode])
+	}
+
+	return nil
+}
+
+func secondaryAddr(secondary string) string {
+	if _, _, err := net.SplitHostPort(secondary); err == nil {
+		return secondary
+	}
+
+	return net.JoinHostPort(secondary, "53")
+}
@@ -0,0 +1,122 @@
+package dnsserver
+
+import (
+	"log/slog"
+	"net"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	dnssrv "github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotifyRetriesUntilAcknowledged(t *testing.T) {
+	var received atomic.Int32
+	acked := make(chan struct{})
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := &dnssrv.Server{
+		PacketConn: pc,
+		Handler: dnssrv.HandlerFunc(func(w dnssrv.ResponseWriter, req *dnssrv.Msg) {
+			res := new(dnssrv.Msg)
+			res.SetReply(req)
+
+			// refuse the first notify to exercise retries
+			if received.Add(1) == 1 {
+				res.Rcode = dnssrv.RcodeRefused
+			} else {
+				close(acked)
+			}
+
+			_ = w.WriteMsg(res)
+		}),
+	}
+	go func() { _ = srv.ActivateAndServe() }()
+	defer func() { _ = srv.Shutdown() }()
+
+	n := newNotifier(slog.Default(), NotifyConfig{
+		Timeout:       time.Second,
+		RetryInterval: 10 * time.Millisecond,
+	})
+	n.notify("lan.", 1, []string{pc.LocalAddr().String()})
+
+	select {
+	case <-acked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("notify not acknowledged")
+	}
+
+	require.EqualValues(t, 2, received.Load())
+
+	require.Eventually(t, func() bool {
+		st := n.statuses()
+		return len(st) == 1 && st[0].Acknowledged
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, NotifyStatus{
+		Zone:         "lan.",
+		Secondary:    pc.LocalAddr().String(),
+		Serial:       1,
+		Acknowledged: true,
+		Attempts:     2,
+	}, n.statuses()[0])
+}
+
+func TestNotifyStatusFailed(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := &dnssrv.Server{
+		PacketConn: pc,
+		Handler: dnssrv.HandlerFunc(func(w dnssrv.ResponseWriter, req *dnssrv.Msg) {
+			res := new(dnssrv.Msg)
+			res.SetRcode(req, dnssrv.RcodeRefused)
+			_ = w.WriteMsg(res)
+		}),
+	}
+	go func() { _ = srv.ActivateAndServe() }()
+	defer func() { _ = srv.Shutdown() }()
+
+	n := newNotifier(slog.Default(), NotifyConfig{
+		Timeout:       time.Second,
+		RetryInterval: time.Hour,
+	})
+	n.notify("lan.", 1, []string{pc.LocalAddr().String()})
+
+	require.Eventually(t, func() bool { return n.statuses()[0].Attempts == 1 }, 5*time.Second, 10*time.Millisecond)
+	st := n.statuses()[0]
+	require.False(t, st.Acknowledged)
+	require.Equal(t, "rcode REFUSED", st.Err)
+
+	// a newer serial supersedes the failed notify
+	n.notify("lan.", 2, []string{pc.LocalAddr().String()})
+	require.EqualValues(t, 2, n.statuses()[0].Serial)
+}
+
+func TestZoneUpdate(t *testing.T) {
+	z := newZone(ZoneConfig{Name: "lan"})
+	zones := []*zone{z}
+
+	recs := []dns.Record{
+		{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+		{Type: dns.A, Name: "foo.other.", Address: netip.MustParseAddr("192.168.1.2")},
+	}
+
+	require.True(t, z.update(newStore(recs, zones).zone(z)))
+	serial := z.serial.Load()
+
+	require.False(t, z.update(newStore(recs, zones).zone(z)))
+	require.Equal(t, serial, z.serial.Load())
+
+	// changes outside of the zone do not bump the serial
+	recs[1].Address = netip.MustParseAddr("192.168.1.3")
+	require.False(t, z.update(newStore(recs, zones).zone(z)))
+
+	recs[0].Address = netip.MustParseAddr("192.168.1.4")
+	require.True(t, z.update(newStore(recs, zones).zone(z)))
+	require.Greater(t, z.serial.Load(), serial)
+}
@@ -0,0 +1,281 @@
+package dnsserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	dnssrv "github.com/miekg/dns"
+	"github.com/samber/lo"
+	"google.golang.org/protobuf/proto"
+)
+
+// queryLogger records queries and their responses as dnstap frames and/or
+// json lines.
+type queryLogger struct {
+	log *slog.Logger
+	cfg QueryLogConfig
+
+	dnstap dnstap.Output
+
+	lock sync.Mutex
+	json *json.Encoder
+}
+
+type queryLogEntry struct {
+	Time     time.Time `json:"time"`
+	Client   string    `json:"client"`
+	Protocol string    `json:"protocol"`
+	Name     string    `json:"name"`
+	Type     string    `json:"type"`
+	Rcode    string    `json:"rcode"`
+	Answers  []string  `json:"answers"`
+	Duration float64   `json:"duration_ms"`
+}
+
+func newQueryLogger(log *slog.Logger, cfg QueryLogConfig) (*queryLogger, error) {
+	if cfg.SampleRate == 0 {
+		cfg.SampleRate = 1
+	}
+
+	cfg.Names = lo.Map(cfg.Names, func(name string, _ int) string {
+		return dnssrv.CanonicalName(name)
+	})
+
+	l := &queryLogger{
+		log: log,
+		cfg: cfg,
+	}
+
+	var err error
+
+	switch {
+	case cfg.DnstapFile != "" && cfg.DnstapSocket != "":
+		return nil, fmt.Errorf("dnstap_file and dnstap_socket are mutually exclusive")
+
+	case cfg.DnstapFile != "":
+		l.dnstap, err = dnstap.NewFrameStreamOutputFromFilename(cfg.DnstapFile)
+
+	case cfg.DnstapSocket != "":
+		l.dnstap, err = dnstap.NewFrameStreamSockOutput(&net.UnixAddr{Name: cfg.DnstapSocket, Net: "unix"})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dnstap: %w", err)
+	}
+
+	if l.dnstap != nil {
+		go l.dnstap.RunOutputLoop()
+	}
+
+	if cfg.JSONFile != "" {
+		var w io.Writer = os.Stdout
+		if cfg.JSONFile != "-" {
+			w, err = os.OpenFile(cfg.JSONFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+			if err != nil {
+				return nil, fmt.Errorf("json: %w", err)
+			}
+		}
+
+		l.json = json.NewEncoder(w)
+	}
+
+	return l, nil
+}
+
+// wrap returns a ResponseWriter logging the responses written for req.
+func (l *queryLogger) wrap(w dnssrv.ResponseWriter, req *dnssrv.Msg) dnssrv.ResponseWriter {
+	if len(req.Question) == 0 || !l.match(w, req) {
+		return w
+	}
+
+	return &loggedWriter{
+		ResponseWriter: w,
+		logger:         l,
+		req:            req,
+		start:          time.Now(),
+	}
+}
+
+func (l *queryLogger) match(w dnssrv.ResponseWriter, req *dnssrv.Msg) bool {
+	if l.cfg.SampleRate < 1 && rand.Float64() >= l.cfg.SampleRate {
+		return false
+	}
+
+	if len(l.cfg.Names) > 0 {
+		name := dnssrv.CanonicalName(req.Question[0].Name)
+		found := false
+
+		for _, n := range l.cfg.Names {
+			if dnssrv.IsSubDomain(n, name) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	if len(l.cfg.Subnets) > 0 {
+		addr := remoteAddrPort(w).Addr()
+		found := false
+
+		for _, subnet := range l.cfg.Subnets {
+			if subnet.Contains(addr) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (l *queryLogger) record(w dnssrv.ResponseWriter, req *dnssrv.Msg, res *dnssrv.Msg, start time.Time) {
+	if l.dnstap != nil {
+		l.recordDnstap(w, req, res, start)
+	}
+
+	if l.json != nil {
+		l.recordJSON(w, req, res, start)
+	}
+}
+
+func (l *queryLogger) recordDnstap(w dnssrv.ResponseWriter, req *dnssrv.Msg, res *dnssrv.Msg, start time.Time) {
+	now := time.Now()
+	client := remoteAddrPort(w)
+
+	family := dnstap.SocketFamily_INET
+	if client.Addr().Is6() {
+		family = dnstap.SocketFamily_INET6
+	}
+
+	var protocol dnstap.SocketProtocol
+	switch transport(w) {
+	case transportUDP:
+		protocol = dnstap.SocketProtocol_UDP
+	case transportTCP:
+		protocol = dnstap.SocketProtocol_TCP
+	case transportDoT:
+		protocol = dnstap.SocketProtocol_DOT
+	case transportDoH:
+		protocol = dnstap.SocketProtocol_DOH
+	}
+
+	queryBuf, err := req.Pack()
+	if err != nil {
+		l.log.Warn("dnstap: pack query", "err", err)
+		return
+	}
+
+	resBuf, err := res.Pack()
+	if err != nil {
+		l.log.Warn("dnstap: pack response", "err", err)
+		return
+	}
+
+	msg := func(t dnstap.Message_Type) *dnstap.Message {
+		return &dnstap.Message{
+			Type:           &t,
+			SocketFamily:   &family,
+			SocketProtocol: &protocol,
+			QueryAddress:   client.Addr().AsSlice(),
+			QueryPort:      proto.Uint32(uint32(client.Port())),
+			QueryTimeSec:   proto.Uint64(uint64(start.Unix())),
+			QueryTimeNsec:  proto.Uint32(uint32(start.Nanosecond())),
+		}
+	}
+
+	query := msg(dnstap.Message_CLIENT_QUERY)
+	query.QueryMessage = queryBuf
+
+	response := msg(dnstap.Message_CLIENT_RESPONSE)
+	response.ResponseMessage = resBuf
+	response.ResponseTimeSec = proto.Uint64(uint64(now.Unix()))
+	response.ResponseTimeNsec = proto.Uint32(uint32(now.Nanosecond()))
+
+	for _, m := range []*dnstap.Message{query, response} {
+		frame, err := proto.Marshal(&dnstap.Dnstap{
+			Type:    dnstap.Dnstap_MESSAGE.Enum(),
+			Version: []byte("shimdns"),
+			Message: m,
+		})
+		if err != nil {
+			l.log.Warn("dnstap: marshal", "err", err)
+			return
+		}
+
+		// never block queries on a slow dnstap consumer
+		select {
+		case l.dnstap.GetOutputChannel() <- frame:
+		default:
+			l.log.Debug("dnstap: output full, dropping frame")
+		}
+	}
+}
+
+func (l *queryLogger) recordJSON(w dnssrv.ResponseWriter, req *dnssrv.Msg, res *dnssrv.Msg, start time.Time) {
+	q := req.Question[0]
+
+	entry := queryLogEntry{
+		Time:     start,
+		Client:   remoteAddrPort(w).Addr().String(),
+		Protocol: transport(w),
+		Name:     q.Name,
+		Type:     dnssrv.TypeToString[q.Qtype],
+		Rcode:    dnssrv.RcodeToString[res.Rcode],
+		Answers:  []string{},
+		Duration: float64(time.Since(start).Microseconds()) / 1000,
+	}
+
+	for _, rr := range res.Answer {
+		entry.Answers = append(entry.Answers, rr.String())
+	}
+
+	l.lock.Lock()
+	err := l.json.Encode(entry)
+	l.lock.Unlock()
+
+	if err != nil {
+		l.log.Warn("query log", "err", err)
+	}
+}
+
+type loggedWriter struct {
+	dnssrv.ResponseWriter
+
+	logger *queryLogger
+	req    *dnssrv.Msg
+	start  time.Time
+}
+
+func (w *loggedWriter) WriteMsg(res *dnssrv.Msg) error {
+	w.logger.record(w.ResponseWriter, w.req, res, w.start)
+	return w.ResponseWriter.WriteMsg(res)
+}
+
+func remoteAddrPort(w dnssrv.ResponseWriter) netip.AddrPort {
+	var addrPort netip.AddrPort
+
+	switch addr := w.RemoteAddr().(type) {
+	case *net.UDPAddr:
+		addrPort = addr.AddrPort()
+	case *net.TCPAddr:
+		addrPort = addr.AddrPort()
+	}
+
+	return netip.AddrPortFrom(addrPort.Addr().Unmap(), addrPort.Port())
+}
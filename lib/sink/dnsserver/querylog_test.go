@@ -0,0 +1,127 @@
+package dnsserver
+
+import (
+	"bufio"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	dnstap "github.com/dnstap/golang-dnstap"
+	dnssrv "github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+// testWriter is a ResponseWriter recording the messages written to it.
+type testWriter struct {
+	remote net.Addr
+	msgs   []*dnssrv.Msg
+}
+
+func newTestWriter(addr string) *testWriter {
+	return &testWriter{
+		remote: net.UDPAddrFromAddrPort(netip.AddrPortFrom(netip.MustParseAddr(addr), 5353)),
+	}
+}
+
+func (w *testWriter) LocalAddr() net.Addr  { return &net.UDPAddr{} }
+func (w *testWriter) RemoteAddr() net.Addr { return w.remote }
+func (w *testWriter) WriteMsg(m *dnssrv.Msg) error {
+	w.msgs = append(w.msgs, m)
+	return nil
+}
+func (w *testWriter) Write(buf []byte) (int, error) { return len(buf), nil }
+func (w *testWriter) Close() error                  { return nil }
+func (w *testWriter) TsigStatus() error             { return nil }
+func (w *testWriter) TsigTimersOnly(bool)           {}
+func (w *testWriter) Hijack()                       {}
+
+func TestQueryLogJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queries.jsonl")
+
+	d := testServer(t, []dns.Record{
+		{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+	})
+
+	var err error
+	d.queryLog, err = newQueryLogger(slog.Default(), QueryLogConfig{
+		JSONFile: path,
+		Names:    []string{"lan"},
+		Subnets:  []netip.Prefix{netip.MustParsePrefix("192.168.0.0/16")},
+	})
+	require.NoError(t, err)
+
+	for _, q := range []struct {
+		client string
+		name   string
+	}{
+		{client: "192.168.1.10", name: "foo.lan."},
+		{client: "192.168.1.10", name: "foo.other."},
+		{client: "10.0.0.1", name: "foo.lan."},
+	} {
+		req := new(dnssrv.Msg)
+		req.SetQuestion(q.name, dnssrv.TypeA)
+		d.handler(newTestWriter(q.client), req)
+	}
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+
+	entries := []queryLogEntry{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		entry := queryLogEntry{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+
+	require.Len(t, entries, 1)
+	require.Equal(t, "192.168.1.10", entries[0].Client)
+	require.Equal(t, "foo.lan.", entries[0].Name)
+	require.Equal(t, "A", entries[0].Type)
+	require.Equal(t, transportUDP, entries[0].Protocol)
+	require.Len(t, entries[0].Answers, 1)
+}
+
+func TestQueryLogDnstap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queries.dnstap")
+
+	d := testServer(t, []dns.Record{
+		{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+	})
+
+	var err error
+	d.queryLog, err = newQueryLogger(slog.Default(), QueryLogConfig{DnstapFile: path})
+	require.NoError(t, err)
+
+	req := new(dnssrv.Msg)
+	req.SetQuestion("foo.lan.", dnssrv.TypeA)
+	d.handler(newTestWriter("192.168.1.10"), req)
+
+	d.queryLog.dnstap.Close()
+
+	input, err := dnstap.NewFrameStreamInputFromFilename(path)
+	require.NoError(t, err)
+
+	frames := make(chan []byte, 10)
+	go func() {
+		input.ReadInto(frames)
+		close(frames)
+	}()
+
+	types := []dnstap.Message_Type{}
+	for frame := range frames {
+		m := &dnstap.Dnstap{}
+		require.NoError(t, proto.Unmarshal(frame, m))
+		require.Equal(t, []byte{192, 168, 1, 10}, m.Message.QueryAddress)
+		types = append(types, m.Message.GetType())
+	}
+
+	require.Equal(t, []dnstap.Message_Type{dnstap.Message_CLIENT_QUERY, dnstap.Message_CLIENT_RESPONSE}, types)
+}
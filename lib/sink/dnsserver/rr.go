@@ -0,0 +1,27 @@
+package dnsserver
+
+import (
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	dnssrv "github.com/miekg/dns"
+)
+
+const (
+	ttl           = 30
+	maxCNAMEDepth = 8
+)
+
+// ownedRR converts rec to a resource record owned by name, which differs from
+// the record name for wildcard matches.
+func ownedRR(rec dns.Record, name string) (dnssrv.RR, bool) {
+	rr, ok := recordToRR(rec)
+	if !ok {
+		return nil, false
+	}
+
+	rr.Header().Name = name
+	return rr, true
+}
+
+func recordToRR(rec dns.Record) (dnssrv.RR, bool) {
+	return rec.RR(ttl)
+}
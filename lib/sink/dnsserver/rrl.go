@@ -0,0 +1,164 @@
+package dnsserver
+
+import (
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	dnssrv "github.com/miekg/dns"
+)
+
+const (
+	defaultRRLIPv4PrefixLen = 24
+	defaultRRLIPv6PrefixLen = 56
+	rrlSweepInterval        = time.Minute
+)
+
+type rrlAction int
+
+const (
+	rrlAllow rrlAction = iota
+	rrlDrop
+	rrlSlip
+)
+
+type rrlKey struct {
+	prefix netip.Prefix
+	name   string
+	rtype  uint16
+	rcode  int
+}
+
+type rrlBucket struct {
+	tokens  float64
+	last    time.Time
+	limited int
+}
+
+// rateLimiter implements response rate limiting: identical responses sent to
+// a client prefix are limited using a token bucket.
+type rateLimiter struct {
+	cfg RateLimitConfig
+
+	lock      sync.Mutex
+	buckets   map[rrlKey]*rrlBucket
+	lastSweep time.Time
+}
+
+func newRateLimiter(cfg RateLimitConfig) *rateLimiter {
+	if cfg.IPv4PrefixLen == 0 {
+		cfg.IPv4PrefixLen = defaultRRLIPv4PrefixLen
+	}
+
+	if cfg.IPv6PrefixLen == 0 {
+		cfg.IPv6PrefixLen = defaultRRLIPv6PrefixLen
+	}
+
+	return &rateLimiter{
+		cfg:       cfg,
+		buckets:   map[rrlKey]*rrlBucket{},
+		lastSweep: time.Now(),
+	}
+}
+
+// responseKey returns the name and type identifying res: those of the
+// answer RRset, or the zone of negative answers so that queries for random
+// names in a zone share a budget. Responses from no zone, e.g. refusals,
+// have no name.
+func responseKey(res *dnssrv.Msg) (string, uint16) {
+	if len(res.Answer) > 0 {
+		hdr := res.Answer[0].Header()
+		return strings.ToLower(hdr.Name), hdr.Rrtype
+	}
+
+	for _, rr := range res.Ns {
+		if rr.Header().Rrtype == dnssrv.TypeSOA {
+			return strings.ToLower(rr.Header().Name), 0
+		}
+	}
+
+	return "", 0
+}
+
+func (r *rateLimiter) check(addr netip.Addr, res *dnssrv.Msg, now time.Time) rrlAction {
+	bits := r.cfg.IPv4PrefixLen
+	if addr.Is6() {
+		bits = r.cfg.IPv6PrefixLen
+	}
+
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return rrlAllow
+	}
+
+	name, rtype := responseKey(res)
+	key := rrlKey{
+		prefix: prefix,
+		name:   name,
+		rtype:  rtype,
+		rcode:  res.Rcode,
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.sweep(now)
+
+	b, ok := r.buckets[key]
+	if !ok {
+		b = &rrlBucket{tokens: r.cfg.ResponsesPerSecond, last: now}
+		r.buckets[key] = b
+	}
+
+	b.tokens = min(r.cfg.ResponsesPerSecond, b.tokens+now.Sub(b.last).Seconds()*r.cfg.ResponsesPerSecond)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return rrlAllow
+	}
+
+	b.limited++
+	if r.cfg.Slip > 0 && b.limited%r.cfg.Slip == 0 {
+		return rrlSlip
+	}
+
+	return rrlDrop
+}
+
+// sweep removes the buckets that are full again.
+func (r *rateLimiter) sweep(now time.Time) {
+	if now.Sub(r.lastSweep) < rrlSweepInterval {
+		return
+	}
+	r.lastSweep = now
+
+	for key, b := range r.buckets {
+		if now.Sub(b.last).Seconds()*r.cfg.ResponsesPerSecond >= r.cfg.ResponsesPerSecond {
+			delete(r.buckets, key)
+		}
+	}
+}
+
+// rateLimit applies response rate limiting to res sent over UDP. It
+// returns the response to send, or false when it is dropped.
+func (d *DNSServer) rateLimit(w dnssrv.ResponseWriter, req *dnssrv.Msg, res *dnssrv.Msg) (*dnssrv.Msg, bool) {
+	if d.rateLimiter == nil || transport(w) != transportUDP {
+		return res, true
+	}
+
+	switch d.rateLimiter.check(remoteAddrPort(w).Addr(), res, time.Now()) {
+	case rrlDrop:
+		d.counters.dropped.Add(1)
+		return nil, false
+
+	case rrlSlip:
+		d.counters.truncated.Add(1)
+		res = new(dnssrv.Msg)
+		res.SetReply(req)
+		res.Truncated = true
+	}
+
+	return res, true
+}
@@ -0,0 +1,122 @@
+package dnsserver
+
+import (
+	"context"
+	"log/slog"
+	"net/netip"
+	"testing"
+	"time"
+
+	dnssrv "github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func testResponse(t *testing.T, rr string, rcode int) *dnssrv.Msg {
+	t.Helper()
+
+	res := new(dnssrv.Msg)
+	res.Rcode = rcode
+
+	parsed, err := dnssrv.NewRR(rr)
+	require.NoError(t, err)
+
+	if rcode == dnssrv.RcodeSuccess && parsed.Header().Rrtype != dnssrv.TypeSOA {
+		res.Answer = []dnssrv.RR{parsed}
+	} else {
+		res.Ns = []dnssrv.RR{parsed}
+	}
+
+	return res
+}
+
+func TestRateLimiter(t *testing.T) {
+	r := newRateLimiter(RateLimitConfig{
+		ResponsesPerSecond: 2,
+		Slip:               2,
+	})
+
+	now := time.Now()
+	client := netip.MustParseAddr("192.0.2.1")
+	sameNet := netip.MustParseAddr("192.0.2.200")
+	res := testResponse(t, "foo.lan. 300 IN A 192.168.1.1", dnssrv.RcodeSuccess)
+
+	require.Equal(t, rrlAllow, r.check(client, res, now))
+	require.Equal(t, rrlAllow, r.check(sameNet, testResponse(t, "FOO.lan. 300 IN A 192.168.1.1", dnssrv.RcodeSuccess), now))
+
+	// the client prefix has exhausted its budget
+	require.Equal(t, rrlDrop, r.check(client, res, now))
+	require.Equal(t, rrlSlip, r.check(client, res, now))
+	require.Equal(t, rrlDrop, r.check(client, res, now))
+
+	// other responses and prefixes are not affected
+	require.Equal(t, rrlAllow, r.check(client, testResponse(t, "foo.lan. 300 IN AAAA fd00::1", dnssrv.RcodeSuccess), now))
+	require.Equal(t, rrlAllow, r.check(netip.MustParseAddr("198.51.100.1"), res, now))
+
+	// tokens are refilled over time
+	require.Equal(t, rrlAllow, r.check(client, res, now.Add(time.Second)))
+}
+
+func TestResponseKey(t *testing.T) {
+	soa := "lan. 300 IN SOA ns.lan. hostmaster.lan. 1 3600 600 86400 300"
+
+	cases := []struct {
+		desc  string
+		res   *dnssrv.Msg
+		name  string
+		rtype uint16
+	}{
+		{"answer", testResponse(t, "Foo.lan. 300 IN A 192.168.1.1", dnssrv.RcodeSuccess), "foo.lan.", dnssrv.TypeA},
+		{"cname", testResponse(t, "www.lan. 300 IN CNAME foo.lan.", dnssrv.RcodeSuccess), "www.lan.", dnssrv.TypeCNAME},
+		{"nxdomain", testResponse(t, soa, dnssrv.RcodeNameError), "lan.", 0},
+		{"nodata", testResponse(t, soa, dnssrv.RcodeSuccess), "lan.", 0},
+		{"no zone", new(dnssrv.Msg), "", 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			name, rtype := responseKey(c.res)
+			require.Equal(t, c.name, name)
+			require.Equal(t, c.rtype, rtype)
+		})
+	}
+}
+
+func TestRateLimitNegative(t *testing.T) {
+	d := &DNSServer{
+		log:         slog.Default(),
+		zones:       []*zone{newZone(ZoneConfig{Name: "lan"})},
+		notifier:    newNotifier(slog.Default(), NotifyConfig{}),
+		rateLimiter: newRateLimiter(RateLimitConfig{ResponsesPerSecond: 1}),
+	}
+	require.NoError(t, d.Write(context.Background(), nil))
+
+	w := newTestWriter("192.0.2.1")
+	for _, name := range []string{"a.lan.", "b.lan.", "c.lan."} {
+		req := new(dnssrv.Msg)
+		req.SetQuestion(name, dnssrv.TypeA)
+		d.handler(w, req)
+	}
+
+	// negative answers for random names share the zone budget
+	require.Len(t, w.msgs, 1)
+	require.Equal(t, "lan.", w.msgs[0].Ns[0].Header().Name)
+	require.EqualValues(t, 2, d.Stats().Dropped)
+}
+
+func TestRateLimitRefused(t *testing.T) {
+	d := testServer(t, nil)
+	d.cfg.ACL.Query.Deny = []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")}
+	d.rateLimiter = newRateLimiter(RateLimitConfig{ResponsesPerSecond: 1})
+
+	w := newTestWriter("192.0.2.1")
+	for _, name := range []string{"a.lan.", "b.lan.", "c.lan."} {
+		req := new(dnssrv.Msg)
+		req.SetQuestion(name, dnssrv.TypeA)
+		d.handler(w, req)
+	}
+
+	// refusals share a budget whatever the question
+	require.Len(t, w.msgs, 1)
+	require.Equal(t, dnssrv.RcodeRefused, w.msgs[0].Rcode)
+	require.EqualValues(t, 2, d.Stats().Dropped)
+}
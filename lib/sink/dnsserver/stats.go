@@ -0,0 +1,44 @@
+package dnsserver
+
+import "sync/atomic"
+
+type Stats struct {
+	Queries uint64
+	// refused by an ACL, or invalid transfer requests
+	Refused uint64
+	// dropped or truncated by rate limiting
+	Dropped   uint64
+	Truncated uint64
+
+	// answered from blocklists
+	Blocked uint64
+	// number of blocked domains
+	BlocklistSize int
+
+	Notify []NotifyStatus
+}
+
+type counters struct {
+	queries   atomic.Uint64
+	refused   atomic.Uint64
+	dropped   atomic.Uint64
+	truncated atomic.Uint64
+	blocked   atomic.Uint64
+}
+
+func (d *DNSServer) Stats() Stats {
+	s := Stats{
+		Queries:   d.counters.queries.Load(),
+		Refused:   d.counters.refused.Load(),
+		Dropped:   d.counters.dropped.Load(),
+		Truncated: d.counters.truncated.Load(),
+		Blocked:   d.counters.blocked.Load(),
+		Notify:    d.notifier.statuses(),
+	}
+
+	if d.blocklist != nil {
+		s.BlocklistSize = d.blocklist.size()
+	}
+
+	return s
+}
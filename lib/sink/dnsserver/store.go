@@ -1,32 +1,190 @@
 package dnsserver
 
 import (
+	"iter"
+	"strings"
+
 	"github.com/ShimmerGlass/shimdns/lib/dns"
 )
 
+// store is an immutable tree of records keyed by lowercased labels, starting
+// from the rightmost one, so that the ancestors of a name are on the path from
+// the root to its node. It is built once per write and never modified after,
+// which allows queries to read it without locking.
 type store struct {
-	recs map[string]map[dns.Type][]dns.Record
+	root *node
 }
 
-func (s *store) reset() {
-	s.recs = map[string]map[dns.Type][]dns.Record{}
+type node struct {
+	children map[string]*node
+	recs     map[dns.Type][]dns.Record
+	// set on zone apexes
+	zone *zone
 }
 
-func (s *store) add(rec dns.Record) {
-	nameRecs, ok := s.recs[rec.Name]
-	if !ok {
-		nameRecs = map[dns.Type][]dns.Record{}
-		s.recs[rec.Name] = nameRecs
+func newStore(recs []dns.Record, zones []*zone) *store {
+	s := &store{root: &node{}}
+
+	for _, z := range zones {
+		s.insert(z.cfg.Name).zone = z
 	}
 
-	nameRecs[rec.Type] = append(nameRecs[rec.Type], rec)
+	for _, rec := range recs {
+		n := s.insert(rec.Name)
+		if n.recs == nil {
+			n.recs = map[dns.Type][]dns.Record{}
+		}
+
+		n.recs[rec.Type] = append(n.recs[rec.Type], rec)
+	}
+
+	return s
+}
+
+func (s *store) insert(name string) *node {
+	n := s.root
+
+	for label := range reversedLabels(name) {
+		child, ok := n.children[label]
+		if !ok {
+			if n.children == nil {
+				n.children = map[string]*node{}
+			}
+
+			child = &node{}
+			n.children[label] = child
+		}
+
+		n = child
+	}
+
+	return n
 }
 
 func (s *store) get(name string, t dns.Type) []dns.Record {
-	recs, ok := s.recs[name]
-	if !ok {
+	return s.lookup(name)[t]
+}
+
+// lookup returns the records owned by name. If name does not exist, records
+// are taken from the wildcard at its closest encloser, as per RFC 4592.
+// Empty non-terminals exist and thus block wildcard matching.
+func (s *store) lookup(name string) map[dns.Type][]dns.Record {
+	n := s.root
+
+	for label := range reversedLabels(name) {
+		child, ok := n.children[label]
+		if !ok {
+			if wildcard, ok := n.children["*"]; ok {
+				return wildcard.recs
+			}
+
+			return nil
+		}
+
+		n = child
+	}
+
+	return n.recs
+}
+
+// zoneAt returns the zone whose apex is name, if any.
+func (s *store) zoneAt(name string) *zone {
+	n := s.find(name)
+	if n == nil {
 		return nil
 	}
 
-	return recs[t]
+	return n.zone
+}
+
+// zoneFor returns the closest zone enclosing name, if any.
+func (s *store) zoneFor(name string) *zone {
+	n := s.root
+	z := n.zone
+
+	for label := range reversedLabels(name) {
+		child, ok := n.children[label]
+		if !ok {
+			break
+		}
+
+		n = child
+		if n.zone != nil {
+			z = n.zone
+		}
+	}
+
+	return z
+}
+
+// zone returns the records at and below the apex of z, stopping at the apexes
+// of other zones.
+func (s *store) zone(z *zone) iter.Seq[dns.Record] {
+	return func(yield func(dns.Record) bool) {
+		n := s.find(z.cfg.Name)
+		if n == nil {
+			return
+		}
+
+		n.walk(n, yield)
+	}
+}
+
+func (s *store) find(name string) *node {
+	n := s.root
+
+	for label := range reversedLabels(name) {
+		child, ok := n.children[label]
+		if !ok {
+			return nil
+		}
+
+		n = child
+	}
+
+	return n
+}
+
+func (n *node) walk(start *node, yield func(dns.Record) bool) bool {
+	if n != start && n.zone != nil {
+		return true
+	}
+
+	for _, recs := range n.recs {
+		for _, rec := range recs {
+			if !yield(rec) {
+				return false
+			}
+		}
+	}
+
+	for _, child := range n.children {
+		if !child.walk(start, yield) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// reversedLabels yields the lowercased labels of a fully qualified name,
+// starting with the rightmost one.
+func reversedLabels(name string) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		name = strings.TrimSuffix(name, ".")
+
+		for name != "" {
+			i := strings.LastIndexByte(name, '.')
+
+			if !yield(strings.ToLower(name[i+1:])) {
+				return
+			}
+
+			if i < 0 {
+				return
+			}
+
+			name = name[:i]
+		}
+	}
 }
@@ -0,0 +1,137 @@
+package dnsserver
+
+import (
+	"fmt"
+	"net/netip"
+	"testing"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreWildcard(t *testing.T) {
+	s := newStore([]dns.Record{
+		{Type: dns.A, Name: "*.apps.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+		{Type: dns.A, Name: "explicit.apps.lan.", Address: netip.MustParseAddr("192.168.1.2")},
+		{Type: dns.CNAME, Name: "cname.apps.lan.", Target: "explicit.apps.lan."},
+		{Type: dns.A, Name: "host.ent.apps.lan.", Address: netip.MustParseAddr("192.168.1.3")},
+	}, nil)
+
+	testCases := []struct {
+		Name    string
+		Type    dns.Type
+		Address string
+	}{
+		// synthesized from the wildcard
+		{Name: "foo.apps.lan.", Type: dns.A, Address: "192.168.1.1"},
+		// wildcard also matches deeper names when no closer name exists
+		{Name: "foo.bar.apps.lan.", Type: dns.A, Address: "192.168.1.1"},
+		// explicit names take precedence
+		{Name: "explicit.apps.lan.", Type: dns.A, Address: "192.168.1.2"},
+		// an existing name without the type is not synthesized
+		{Name: "cname.apps.lan.", Type: dns.A},
+		// empty non-terminals block the wildcard
+		{Name: "ent.apps.lan.", Type: dns.A},
+		// the closest encloser is ent.apps.lan. which has no wildcard
+		{Name: "foo.ent.apps.lan.", Type: dns.A},
+		// the wildcard does not match its parent
+		{Name: "apps.lan.", Type: dns.A},
+		// the wildcard can be queried directly
+		{Name: "*.apps.lan.", Type: dns.A, Address: "192.168.1.1"},
+		{Name: "foo.other.", Type: dns.A},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			recs := s.get(tc.Name, tc.Type)
+			if tc.Address == "" {
+				require.Empty(t, recs)
+				return
+			}
+
+			require.Len(t, recs, 1)
+			require.Equal(t, tc.Address, recs[0].Address.String())
+		})
+	}
+}
+
+func TestStoreCaseInsensitive(t *testing.T) {
+	s := newStore([]dns.Record{
+		{Type: dns.A, Name: "Foo.LAN.", Address: netip.MustParseAddr("192.168.1.1")},
+	}, nil)
+
+	require.Len(t, s.get("foo.lan.", dns.A), 1)
+	require.Len(t, s.get("FOO.lan.", dns.A), 1)
+}
+
+func TestStoreZones(t *testing.T) {
+	lan := newZone(ZoneConfig{Name: "lan."})
+	sub := newZone(ZoneConfig{Name: "sub.lan."})
+
+	s := newStore([]dns.Record{
+		{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+		{Type: dns.A, Name: "foo.sub.lan.", Address: netip.MustParseAddr("192.168.1.2")},
+		{Type: dns.A, Name: "foo.other.", Address: netip.MustParseAddr("192.168.1.3")},
+	}, []*zone{lan, sub})
+
+	require.Equal(t, lan, s.zoneAt("lan."))
+	require.Nil(t, s.zoneAt("foo.lan."))
+
+	require.Equal(t, lan, s.zoneFor("foo.lan."))
+	require.Equal(t, lan, s.zoneFor("missing.lan."))
+	require.Equal(t, sub, s.zoneFor("bar.foo.sub.lan."))
+	require.Nil(t, s.zoneFor("foo.other."))
+
+	// records below a zone cut belong to the child zone
+	names := []string{}
+	for rec := range s.zone(lan) {
+		names = append(names, rec.Name)
+	}
+	require.Equal(t, []string{"foo.lan."}, names)
+}
+
+func benchmarkRecords(n int) []dns.Record {
+	recs := make([]dns.Record, 0, n)
+	for i := range n {
+		recs = append(recs, dns.Record{
+			Type:    dns.A,
+			Name:    fmt.Sprintf("host-%d.rack-%d.dc.lan.", i, i%100),
+			Address: netip.AddrFrom4([4]byte{10, byte(i >> 16), byte(i >> 8), byte(i)}),
+		})
+	}
+
+	return recs
+}
+
+func BenchmarkStoreBuild(b *testing.B) {
+	recs := benchmarkRecords(100_000)
+
+	for b.Loop() {
+		newStore(recs, nil)
+	}
+}
+
+func BenchmarkStoreLookup(b *testing.B) {
+	recs := benchmarkRecords(100_000)
+	s := newStore(recs, nil)
+
+	i := 0
+	for b.Loop() {
+		s.get(recs[i%len(recs)].Name, dns.A)
+		i++
+	}
+}
+
+func BenchmarkStoreLookupParallel(b *testing.B) {
+	recs := benchmarkRecords(100_000)
+	s := newStore(recs, nil)
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			s.get(recs[i%len(recs)].Name, dns.A)
+			i++
+		}
+	})
+}
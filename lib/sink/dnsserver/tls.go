@@ -0,0 +1,107 @@
+package dnsserver
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+const certCheckInterval = 10 * time.Second
+
+// certReloader serves a certificate loaded from files and reloads it when
+// the files are modified.
+type certReloader struct {
+	log *slog.Logger
+	cfg TLSConfig
+
+	lock    sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+	checked time.Time
+}
+
+func newCertReloader(log *slog.Logger, cfg TLSConfig) (*certReloader, error) {
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, fmt.Errorf("tls: cert_file and key_file are required")
+	}
+
+	c := &certReloader{
+		log: log,
+		cfg: cfg,
+	}
+
+	err := c.reload()
+	if err != nil {
+		return nil, fmt.Errorf("tls: %w", err)
+	}
+
+	return c, nil
+}
+
+func (c *certReloader) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: c.getCertificate,
+	}
+}
+
+func (c *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if time.Since(c.checked) > certCheckInterval {
+		err := c.reload()
+		if err != nil {
+			c.log.Warn("tls: reload certificate", "err", err)
+		}
+	}
+
+	return c.cert, nil
+}
+
+func (c *certReloader) reload() error {
+	c.checked = time.Now()
+
+	modTime, err := c.filesModTime()
+	if err != nil {
+		return err
+	}
+
+	if c.cert != nil && modTime.Equal(c.modTime) {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.cfg.CertFile, c.cfg.KeyFile)
+	if err != nil {
+		return err
+	}
+
+	if c.cert != nil {
+		c.log.Info("tls: certificate reloaded", "cert_file", c.cfg.CertFile)
+	}
+
+	c.cert = &cert
+	c.modTime = modTime
+
+	return nil
+}
+
+func (c *certReloader) filesModTime() (time.Time, error) {
+	res := time.Time{}
+
+	for _, path := range []string{c.cfg.CertFile, c.cfg.KeyFile} {
+		st, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		if st.ModTime().After(res) {
+			res = st.ModTime()
+		}
+	}
+
+	return res, nil
+}
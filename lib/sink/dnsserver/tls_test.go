@@ -0,0 +1,142 @@
+package dnsserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"log/slog"
+	"math/big"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	dnssrv "github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCert writes a self-signed certificate for dns.lan named cn, and
+// returns it.
+func writeCert(t *testing.T, cfg TLSConfig, cn string, modTime time.Time) *x509.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{"dns.lan"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(cfg.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(cfg.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+
+	for _, path := range []string{cfg.CertFile, cfg.KeyFile} {
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return cert
+}
+
+func testTLSConfig(t *testing.T) TLSConfig {
+	dir := t.TempDir()
+
+	return TLSConfig{
+		CertFile: filepath.Join(dir, "cert.pem"),
+		KeyFile:  filepath.Join(dir, "key.pem"),
+	}
+}
+
+func TestDoT(t *testing.T) {
+	d := testServer(t, []dns.Record{
+		{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+	})
+
+	cfg := testTLSConfig(t)
+	cert := writeCert(t, cfg, "dns.lan", time.Now())
+
+	certs, err := newCertReloader(slog.Default(), cfg)
+	require.NoError(t, err)
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", certs.tlsConfig())
+	require.NoError(t, err)
+
+	started := make(chan struct{})
+	srv := &dnssrv.Server{
+		Net:               "tcp-tls",
+		Listener:          l,
+		Handler:           dnssrv.HandlerFunc(d.handler),
+		NotifyStartedFunc: func() { close(started) },
+	}
+	go func() { _ = srv.ActivateAndServe() }()
+	defer func() { _ = srv.Shutdown() }()
+	<-started
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+
+	client := dnssrv.Client{
+		Net:       "tcp-tls",
+		TLSConfig: &tls.Config{RootCAs: roots, ServerName: "dns.lan"},
+	}
+
+	req := new(dnssrv.Msg)
+	req.SetQuestion("foo.lan.", dnssrv.TypeA)
+
+	res, _, err := client.Exchange(req, l.Addr().String())
+	require.NoError(t, err)
+	require.Len(t, res.Answer, 1)
+	require.Equal(t, "192.168.1.1", res.Answer[0].(*dnssrv.A).A.String())
+}
+
+func TestCertReloader(t *testing.T) {
+	cfg := testTLSConfig(t)
+	now := time.Now()
+	writeCert(t, cfg, "first", now.Add(-time.Minute))
+
+	c, err := newCertReloader(slog.Default(), cfg)
+	require.NoError(t, err)
+
+	commonName := func() string {
+		cert, err := c.getCertificate(nil)
+		require.NoError(t, err)
+
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		require.NoError(t, err)
+		return leaf.Subject.CommonName
+	}
+
+	require.Equal(t, "first", commonName())
+
+	// rotated files are picked up at the next check
+	writeCert(t, cfg, "rotated", now)
+	require.Equal(t, "first", commonName())
+
+	c.checked = time.Time{}
+	require.Equal(t, "rotated", commonName())
+
+	// invalid files keep the current certificate
+	require.NoError(t, os.WriteFile(cfg.CertFile, []byte("garbage"), 0o600))
+	require.NoError(t, os.Chtimes(cfg.CertFile, now.Add(time.Minute), now.Add(time.Minute)))
+
+	c.checked = time.Time{}
+	require.Equal(t, "rotated", commonName())
+}
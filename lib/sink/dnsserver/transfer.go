@@ -0,0 +1,146 @@
+package dnsserver
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	dnssrv "github.com/miekg/dns"
+)
+
+const (
+	transferChunkSize = 100
+	// timeout resolving the secondaries named by host name
+	secondaryLookupTimeout = 2 * time.Second
+)
+
+// transfer serves an AXFR of a zone. Views are not applied, the zone
+// content and serial are those of the default records.
+func (d *DNSServer) transfer(w dnssrv.ResponseWriter, req *dnssrv.Msg) {
+	q := req.Question[0]
+
+	if t := transport(w); t != transportTCP && t != transportDoT {
+		d.refuse(w, req)
+		return
+	}
+
+	st := d.store.Load()
+
+	z := st.zoneAt(q.Name)
+	if z == nil {
+		d.refuse(w, req)
+		return
+	}
+
+	client := remoteAddrPort(w).Addr()
+	if !d.transferAllowed(z, client) {
+		d.log.Warn("zone transfer refused", "zone", z.cfg.Name, "client", client)
+		d.refuse(w, req)
+		return
+	}
+
+	soa := z.soa()
+	rrs := []dnssrv.RR{soa}
+	rrs = append(rrs, z.ns()...)
+	for rec := range st.zone(z) {
+		rr, ok := recordToRR(rec)
+		if ok {
+			rrs = append(rrs, rr)
+		}
+	}
+	rrs = append(rrs, soa)
+
+	d.log.Info("zone transfer", "zone", z.cfg.Name, "serial", soa.Serial, "client", w.RemoteAddr().String())
+
+	ch := make(chan *dnssrv.Envelope)
+	tr := new(dnssrv.Transfer)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		err := tr.Out(w, req, ch)
+		if err != nil {
+			d.log.Warn("zone transfer", "zone", z.cfg.Name, "err", err)
+		}
+	}()
+
+	for len(rrs) > 0 {
+		n := min(transferChunkSize, len(rrs))
+		ch <- &dnssrv.Envelope{RR: rrs[:n]}
+		rrs = rrs[n:]
+	}
+	close(ch)
+
+	wg.Wait()
+}
+
+// transferAllowed reports whether client may transfer z. Transfers are
+// denied unless client is in the transfer ACL allow list or is one of the
+// zone secondaries.
+func (d *DNSServer) transferAllowed(z *zone, client netip.Addr) bool {
+	acl := d.cfg.ACL.Transfer
+
+	for _, subnet := range acl.Deny {
+		if subnet.Contains(client) {
+			return false
+		}
+	}
+
+	for _, subnet := range acl.Allow {
+		if subnet.Contains(client) {
+			return true
+		}
+	}
+
+	for _, secondary := range z.cfg.Secondaries {
+		host, _, err := net.SplitHostPort(secondaryAddr(secondary))
+		if err != nil {
+			continue
+		}
+
+		if addr, err := netip.ParseAddr(host); err == nil {
+			if addr.Unmap() == client {
+				return true
+			}
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), secondaryLookupTimeout)
+		addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		cancel()
+		if err != nil {
+			d.log.Warn("resolve secondary", "zone", z.cfg.Name, "secondary", secondary, "err", err)
+			continue
+		}
+
+		if slices.ContainsFunc(addrs, func(addr netip.Addr) bool { return addr.Unmap() == client }) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (d *DNSServer) refuse(w dnssrv.ResponseWriter, req *dnssrv.Msg) {
+	d.counters.refused.Add(1)
+
+	res := new(dnssrv.Msg)
+	res.SetRcode(req, dnssrv.RcodeRefused)
+
+	// refusals are limited per client prefix whatever the question, so
+	// they cannot be used for reflection
+	res, ok := d.rateLimit(w, req, res)
+	if !ok {
+		return
+	}
+
+	err := w.WriteMsg(res)
+	if err != nil {
+		d.log.Warn(err.Error())
+	}
+}
@@ -0,0 +1,61 @@
+package dnsserver
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	dnssrv "github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransferACL(t *testing.T) {
+	d := &DNSServer{
+		log: slog.Default(),
+		cfg: Config{ACL: ACLConfig{Transfer: ACL{
+			Allow: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/24")},
+			Deny:  []netip.Prefix{netip.MustParsePrefix("10.0.0.66/32")},
+		}}},
+		zones: []*zone{newZone(ZoneConfig{
+			Name:        "lan",
+			NS:          []string{"ns.lan"},
+			Secondaries: []string{"192.168.1.53", "[fd00::53]:5353"},
+		})},
+		notifier: newNotifier(slog.Default(), NotifyConfig{}),
+	}
+	require.NoError(t, d.Write(context.Background(), []dns.Record{
+		{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+	}))
+
+	for _, tc := range []struct {
+		client  string
+		allowed bool
+	}{
+		{client: "192.168.1.53", allowed: true},
+		{client: "fd00::53", allowed: true},
+		{client: "10.0.0.1", allowed: true},
+		{client: "10.0.0.66", allowed: false},
+		// not allowed by default
+		{client: "192.168.1.10", allowed: false},
+	} {
+		t.Run(tc.client, func(t *testing.T) {
+			req := new(dnssrv.Msg)
+			req.SetAxfr("lan.")
+
+			w := &testWriter{remote: net.TCPAddrFromAddrPort(netip.AddrPortFrom(netip.MustParseAddr(tc.client), 5353))}
+			d.handler(w, req)
+
+			require.NotEmpty(t, w.msgs)
+			if !tc.allowed {
+				require.Equal(t, dnssrv.RcodeRefused, w.msgs[0].Rcode)
+				return
+			}
+
+			require.Equal(t, dnssrv.RcodeSuccess, w.msgs[0].Rcode)
+			require.Equal(t, dnssrv.TypeSOA, w.msgs[0].Answer[0].Header().Rrtype)
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package dnsserver
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"slices"
+	"sync/atomic"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	"github.com/ShimmerGlass/shimdns/lib/modifier/rewrite"
+	dnssrv "github.com/miekg/dns"
+)
+
+// view is a client-subnet specific version of the record set.
+type view struct {
+	cfg ViewConfig
+
+	rewrites []*rewrite.Rewrite
+	store    atomic.Pointer[store]
+}
+
+func newView(log *slog.Logger, cfg ViewConfig) (*view, error) {
+	v := &view{cfg: cfg}
+	v.store.Store(newStore(nil, nil))
+
+	for i, rcfg := range cfg.Rewrites {
+		r, err := rewrite.New(log, rcfg)
+		if err != nil {
+			return nil, fmt.Errorf("rewrite #%d: %w", i, err)
+		}
+
+		v.rewrites = append(v.rewrites, r)
+	}
+
+	return v, nil
+}
+
+func (v *view) matches(addr netip.Addr) bool {
+	for _, subnet := range v.cfg.Subnets {
+		if subnet.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// records applies the view filter and rewrites to the record set.
+func (v *view) records(ctx context.Context, recs []dns.Record) ([]dns.Record, error) {
+	recs, err := v.cfg.Filter.Filter(recs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range v.rewrites {
+		recs, err = r.Modify(ctx, recs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return recs, nil
+}
+
+// clientAddr returns the address used to select a view for req, and the
+// client subnet option to echo in the response if it was used.
+func (d *DNSServer) clientAddr(w dnssrv.ResponseWriter, req *dnssrv.Msg) (netip.Addr, *dnssrv.EDNS0_SUBNET) {
+	if d.cfg.ViewsECS {
+		if opt := req.IsEdns0(); opt != nil {
+			for _, o := range opt.Option {
+				ecs, ok := o.(*dnssrv.EDNS0_SUBNET)
+				if !ok {
+					continue
+				}
+
+				addr, ok := netip.AddrFromSlice(ecs.Address)
+				if ok {
+					return addr.Unmap(), ecs
+				}
+			}
+		}
+	}
+
+	return remoteAddrPort(w).Addr(), nil
+}
+
+// storeFor returns the store of the first view matching addr, or the
+// default store.
+func (d *DNSServer) storeFor(addr netip.Addr) *store {
+	idx := slices.IndexFunc(d.views, func(v *view) bool {
+		return v.matches(addr)
+	})
+	if idx < 0 {
+		return d.store.Load()
+	}
+
+	return d.views[idx].store.Load()
+}
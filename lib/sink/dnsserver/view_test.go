@@ -0,0 +1,90 @@
+package dnsserver
+
+import (
+	"context"
+	"log/slog"
+	"net/netip"
+	"testing"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	"github.com/ShimmerGlass/shimdns/lib/modifier/rewrite"
+	dnssrv "github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestViews(t *testing.T) {
+	guest, err := newView(slog.Default(), ViewConfig{
+		Name:    "guest",
+		Subnets: []netip.Prefix{netip.MustParsePrefix("10.10.0.0/16")},
+		Rewrites: []rewrite.Config{
+			{Set: rewrite.SetConfig{Address: `ip("203.0.113.1")`}},
+		},
+	})
+	require.NoError(t, err)
+
+	d := &DNSServer{
+		log:   slog.Default(),
+		views: []*view{guest},
+	}
+
+	err = d.Write(context.Background(), []dns.Record{
+		{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+	})
+	require.NoError(t, err)
+
+	lan := d.storeFor(netip.MustParseAddr("192.168.1.20")).get("foo.lan.", dns.A)
+	require.Len(t, lan, 1)
+	require.Equal(t, "192.168.1.1", lan[0].Address.String())
+
+	ext := d.storeFor(netip.MustParseAddr("10.10.3.4")).get("foo.lan.", dns.A)
+	require.Len(t, ext, 1)
+	require.Equal(t, "203.0.113.1", ext[0].Address.String())
+}
+
+func TestViewsECS(t *testing.T) {
+	guest, err := newView(slog.Default(), ViewConfig{
+		Name:    "guest",
+		Subnets: []netip.Prefix{netip.MustParsePrefix("10.10.0.0/16")},
+		Rewrites: []rewrite.Config{
+			{Set: rewrite.SetConfig{Address: `ip("203.0.113.1")`}},
+		},
+	})
+	require.NoError(t, err)
+
+	d := &DNSServer{
+		log:   slog.Default(),
+		cfg:   Config{ViewsECS: true},
+		views: []*view{guest},
+	}
+
+	err = d.Write(context.Background(), []dns.Record{
+		{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+	})
+	require.NoError(t, err)
+
+	ecs := &dnssrv.EDNS0_SUBNET{
+		Code:          dnssrv.EDNS0SUBNET,
+		Family:        1,
+		SourceNetmask: 24,
+		Address:       netip.MustParseAddr("10.10.3.0").AsSlice(),
+	}
+
+	req := new(dnssrv.Msg)
+	req.SetQuestion("foo.lan.", dnssrv.TypeA)
+	req.SetEdns0(dnssrv.DefaultMsgSize, false)
+	opt := req.IsEdns0()
+	opt.Option = append(opt.Option, ecs)
+
+	w := newTestWriter("192.168.1.10")
+	d.handler(w, req)
+
+	res := w.msgs[0]
+	require.Len(t, res.Answer, 1)
+	require.Equal(t, "203.0.113.1", res.Answer[0].(*dnssrv.A).A.String())
+
+	// the reply carries its own option, the request is left untouched
+	reply := res.IsEdns0().Option[0].(*dnssrv.EDNS0_SUBNET)
+	require.NotSame(t, ecs, reply)
+	require.EqualValues(t, 24, reply.SourceScope)
+	require.Zero(t, ecs.SourceScope)
+}
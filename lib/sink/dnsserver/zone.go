@@ -0,0 +1,111 @@
+package dnsserver
+
+import (
+	"hash/fnv"
+	"iter"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	dnssrv "github.com/miekg/dns"
+	"github.com/samber/lo"
+)
+
+type zone struct {
+	cfg ZoneConfig
+
+	// read by queries while being updated by writes
+	serial atomic.Uint32
+	hash   uint64
+
+	// nil for unsigned zones
+	signer *signer
+}
+
+func newZone(cfg ZoneConfig) *zone {
+	cfg.Name = dnssrv.CanonicalName(cfg.Name)
+	cfg.NS = lo.Map(cfg.NS, func(ns string, _ int) string {
+		return dnssrv.CanonicalName(ns)
+	})
+
+	if cfg.Mbox == "" {
+		cfg.Mbox = "hostmaster." + cfg.Name
+	}
+
+	z := &zone{cfg: cfg}
+	z.serial.Store(uint32(time.Now().Unix()))
+
+	return z
+}
+
+// update records the zone content and bumps the serial if it differs from
+// the previous call. It reports whether the zone changed.
+func (z *zone) update(recs iter.Seq[dns.Record]) bool {
+	lines := []string{}
+	for rec := range recs {
+		lines = append(lines, rec.String())
+	}
+	slices.Sort(lines)
+
+	h := fnv.New64a()
+	for _, l := range lines {
+		_, _ = h.Write([]byte(l))
+		_, _ = h.Write([]byte{'\n'})
+	}
+
+	sum := h.Sum64()
+	if sum == z.hash {
+		return false
+	}
+
+	z.hash = sum
+
+	serial := uint32(time.Now().Unix())
+	if prev := z.serial.Load(); serial <= prev {
+		serial = prev + 1
+	}
+	z.serial.Store(serial)
+
+	return true
+}
+
+func (z *zone) soa() *dnssrv.SOA {
+	ns := z.cfg.Name
+	if len(z.cfg.NS) > 0 {
+		ns = z.cfg.NS[0]
+	}
+
+	return &dnssrv.SOA{
+		Hdr: dnssrv.RR_Header{
+			Name:   z.cfg.Name,
+			Rrtype: dnssrv.TypeSOA,
+			Class:  dnssrv.ClassINET,
+			Ttl:    ttl,
+		},
+		Ns:      ns,
+		Mbox:    z.cfg.Mbox,
+		Serial:  z.serial.Load(),
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  86400,
+		Minttl:  ttl,
+	}
+}
+
+func (z *zone) ns() []dnssrv.RR {
+	res := []dnssrv.RR{}
+	for _, ns := range z.cfg.NS {
+		res = append(res, &dnssrv.NS{
+			Hdr: dnssrv.RR_Header{
+				Name:   z.cfg.Name,
+				Rrtype: dnssrv.TypeNS,
+				Class:  dnssrv.ClassINET,
+				Ttl:    ttl,
+			},
+			Ns: ns,
+		})
+	}
+
+	return res
+}
@@ -0,0 +1,44 @@
+package etcd
+
+import (
+	"time"
+
+	"github.com/ShimmerGlass/shimdns/lib/exp"
+)
+
+const (
+	defaultPrefix      = "/skydns"
+	defaultOwner       = "shimdns"
+	defaultTTL         = 300
+	defaultDialTimeout = 5 * time.Second
+	// etcd's default --max-txn-ops
+	defaultMaxTxnOps = 128
+)
+
+type Config struct {
+	Endpoints   []string      `yaml:"endpoints"`
+	Username    string        `yaml:"username"`
+	Password    string        `yaml:"password"`
+	TLS         TLSConfig     `yaml:"tls"`
+	DialTimeout time.Duration `yaml:"dial_timeout"`
+
+	// path of the CoreDNS etcd plugin
+	Prefix string `yaml:"prefix"`
+	// records are written as keys named "<owner>-<hash>" below the name
+	// path, keys with other names are never modified
+	Owner string `yaml:"owner"`
+
+	// changes are applied in a single transaction, a sync with more
+	// changes than the server's --max-txn-ops fails
+	MaxTxnOps int `yaml:"max_txn_ops"`
+
+	TTL uint32 `yaml:"ttl"`
+
+	Filter exp.Filter `yaml:"filter"`
+}
+
+type TLSConfig struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	CAFile   string `yaml:"ca_file"`
+}
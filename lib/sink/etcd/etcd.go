@@ -0,0 +1,181 @@
+package etcd
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+type Etcd struct {
+	log    *slog.Logger
+	cfg    Config
+	client *clientv3.Client
+}
+
+func New(log *slog.Logger, cfg Config) (*Etcd, error) {
+	if len(cfg.Endpoints) == 0 {
+		return nil, fmt.Errorf("missing endpoints")
+	}
+
+	if cfg.Prefix == "" {
+		cfg.Prefix = defaultPrefix
+	}
+	if cfg.Owner == "" {
+		cfg.Owner = defaultOwner
+	}
+	if cfg.TTL == 0 {
+		cfg.TTL = defaultTTL
+	}
+	if cfg.DialTimeout == 0 {
+		cfg.DialTimeout = defaultDialTimeout
+	}
+	if cfg.MaxTxnOps == 0 {
+		cfg.MaxTxnOps = defaultMaxTxnOps
+	}
+
+	tlsCfg, err := cfg.TLS.config()
+	if err != nil {
+		return nil, fmt.Errorf("tls: %w", err)
+	}
+
+	// the client connects lazily, New does not fail when etcd is down
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   cfg.Endpoints,
+		Username:    cfg.Username,
+		Password:    cfg.Password,
+		TLS:         tlsCfg,
+		DialTimeout: cfg.DialTimeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Etcd{
+		log:    log.With("sink", "etcd"),
+		cfg:    cfg,
+		client: client,
+	}, nil
+}
+
+func (e *Etcd) Write(ctx context.Context, records []dns.Record) error {
+	err := e.write(ctx, records)
+	if err != nil {
+		return fmt.Errorf("etcd sink: %w", err)
+	}
+
+	return nil
+}
+
+func (e *Etcd) write(ctx context.Context, records []dns.Record) error {
+	records, err := e.cfg.Filter.Filter(records)
+	if err != nil {
+		return err
+	}
+
+	desired := map[string][]byte{}
+	for _, rec := range records {
+		s, ok := toService(rec, e.cfg.TTL)
+		if !ok {
+			continue
+		}
+
+		value, err := json.Marshal(s)
+		if err != nil {
+			return err
+		}
+
+		desired[recordKey(e.cfg.Prefix, e.cfg.Owner, rec, value)] = value
+	}
+
+	res, err := e.client.Get(ctx, e.cfg.Prefix+"/", clientv3.WithPrefix())
+	if err != nil {
+		return err
+	}
+
+	current := map[string][]byte{}
+	for _, kv := range res.Kvs {
+		if owned(string(kv.Key), e.cfg.Owner) {
+			current[string(kv.Key)] = kv.Value
+		}
+	}
+
+	ops := []clientv3.Op{}
+
+	for _, k := range slices.Sorted(maps.Keys(current)) {
+		if _, ok := desired[k]; !ok {
+			e.log.Info("removing key", "key", k)
+			ops = append(ops, clientv3.OpDelete(k))
+		}
+	}
+
+	for _, k := range slices.Sorted(maps.Keys(desired)) {
+		if cur, ok := current[k]; !ok || !bytes.Equal(cur, desired[k]) {
+			e.log.Info("adding key", "key", k, "value", string(desired[k]))
+			ops = append(ops, clientv3.OpPut(k, string(desired[k])))
+		}
+	}
+
+	if len(ops) == 0 {
+		return nil
+	}
+
+	// splitting the changes would leave etcd partially updated on failure
+	if len(ops) > e.cfg.MaxTxnOps {
+		return fmt.Errorf("%d changes exceed max_txn_ops (%d)", len(ops), e.cfg.MaxTxnOps)
+	}
+
+	// the changes are computed from the keys read above, they are only
+	// applied if none of them was modified since
+	txn, err := e.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(e.cfg.Prefix+"/"), "<", res.Header.Revision+1).WithPrefix()).
+		Then(ops...).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !txn.Succeeded {
+		return fmt.Errorf("keys below %s were modified concurrently", e.cfg.Prefix)
+	}
+
+	return nil
+}
+
+func (c TLSConfig) config() (*tls.Config, error) {
+	if c.CertFile == "" && c.CAFile == "" {
+		return nil, nil
+	}
+
+	res := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		res.Certificates = []tls.Certificate{cert}
+	}
+
+	if c.CAFile != "" {
+		ca, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		res.RootCAs = x509.NewCertPool()
+		if !res.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("%s: no certificates found", c.CAFile)
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,148 @@
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	"github.com/stretchr/testify/require"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+)
+
+func startEtcd(t *testing.T) string {
+	t.Helper()
+
+	freeURL := func() url.URL {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer func() { _ = l.Close() }()
+
+		u, err := url.Parse(fmt.Sprintf("http://%s", l.Addr()))
+		require.NoError(t, err)
+		return *u
+	}
+
+	cfg := embed.NewConfig()
+	cfg.Dir = t.TempDir()
+	cfg.LogLevel = "error"
+
+	client, peer := freeURL(), freeURL()
+	cfg.ListenClientUrls = []url.URL{client}
+	cfg.AdvertiseClientUrls = []url.URL{client}
+	cfg.ListenPeerUrls = []url.URL{peer}
+	cfg.AdvertisePeerUrls = []url.URL{peer}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+
+	e, err := embed.StartEtcd(cfg)
+	require.NoError(t, err)
+	t.Cleanup(e.Close)
+
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(10 * time.Second):
+		t.Fatal("etcd did not start")
+	}
+
+	return client.String()
+}
+
+func TestWrite(t *testing.T) {
+	endpoint := startEtcd(t)
+	ctx := context.Background()
+
+	client, err := clientv3.New(clientv3.Config{Endpoints: []string{endpoint}})
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+
+	// keys not written by the sink are never modified
+	_, err = client.Put(ctx, "/skydns/lan/manual", `{"host":"10.0.0.1"}`)
+	require.NoError(t, err)
+
+	e, err := New(slog.Default(), Config{Endpoints: []string{endpoint}})
+	require.NoError(t, err)
+
+	recs := []dns.Record{
+		{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+		{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.2")},
+		{Type: dns.SRV, Name: "_http._tcp.foo.lan.", Target: "foo.lan.", Port: 80, Weight: 10},
+		{Type: dns.MX, Name: "lan.", Mx: "mail.lan.", Preference: 10},
+		{Type: dns.PTR, Name: "1.1.168.192.in-addr.arpa.", Ptr: "foo.lan."},
+	}
+
+	require.NoError(t, e.Write(ctx, recs))
+
+	values := func(prefix string) []string {
+		res, err := client.Get(ctx, prefix, clientv3.WithPrefix())
+		require.NoError(t, err)
+
+		values := []string{}
+		for _, kv := range res.Kvs {
+			values = append(values, string(kv.Value))
+		}
+		return values
+	}
+
+	require.ElementsMatch(t, []string{
+		`{"host":"192.168.1.1","ttl":300}`,
+		`{"host":"192.168.1.2","ttl":300}`,
+	}, values("/skydns/lan/foo/shimdns-"))
+	require.Equal(t, []string{`{"host":"foo.lan.","port":80,"weight":10,"ttl":300}`}, values("/skydns/lan/foo/_tcp/_http/"))
+	require.Equal(t, []string{`{"host":"mail.lan.","priority":10,"mail":true,"ttl":300}`}, values("/skydns/lan/shimdns-"))
+	require.Equal(t, []string{`{"host":"foo.lan.","ttl":300}`}, values("/skydns/arpa/in-addr/192/168/1/1/"))
+
+	// unchanged records do not cause revisions
+	res, err := client.Get(ctx, "/skydns", clientv3.WithPrefix())
+	require.NoError(t, err)
+	rev := res.Header.Revision
+
+	require.NoError(t, e.Write(ctx, recs))
+	res, err = client.Get(ctx, "/skydns", clientv3.WithPrefix())
+	require.NoError(t, err)
+	require.Equal(t, rev, res.Header.Revision)
+
+	// stale keys are removed in one transaction
+	require.NoError(t, e.Write(ctx, recs[:1]))
+	res, err = client.Get(ctx, "/skydns", clientv3.WithPrefix())
+	require.NoError(t, err)
+	require.Equal(t, rev+1, res.Header.Revision)
+
+	require.Equal(t, []string{`{"host":"192.168.1.1","ttl":300}`}, values("/skydns/lan/foo/"))
+	require.Equal(t, []string{`{"host":"10.0.0.1"}`}, values("/skydns/lan/manual"))
+	require.Empty(t, values("/skydns/arpa/"))
+}
+
+func TestWriteMaxTxnOps(t *testing.T) {
+	endpoint := startEtcd(t)
+	ctx := context.Background()
+
+	e, err := New(slog.Default(), Config{Endpoints: []string{endpoint}, MaxTxnOps: 1})
+	require.NoError(t, err)
+
+	// changes are never split across transactions
+	require.Error(t, e.Write(ctx, []dns.Record{
+		{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+		{Type: dns.A, Name: "bar.lan.", Address: netip.MustParseAddr("192.168.1.2")},
+	}))
+
+	client, err := clientv3.New(clientv3.Config{Endpoints: []string{endpoint}})
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+
+	res, err := client.Get(ctx, "/skydns", clientv3.WithPrefix())
+	require.NoError(t, err)
+	require.Empty(t, res.Kvs)
+}
+
+func TestOwned(t *testing.T) {
+	require.True(t, owned("/skydns/lan/foo/shimdns-00a1b2c3d4e5f607", "shimdns"))
+	require.False(t, owned("/skydns/lan/foo/shimdns-other", "shimdns"))
+	require.False(t, owned("/skydns/lan/foo", "shimdns"))
+	require.False(t, owned("/skydns/lan/foo/other-00a1b2c3d4e5f607", "shimdns"))
+}
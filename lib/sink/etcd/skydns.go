@@ -0,0 +1,81 @@
+package etcd
+
+import (
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"strings"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	dnssrv "github.com/miekg/dns"
+)
+
+// service is a SkyDNS record value, as read by the CoreDNS etcd plugin.
+type service struct {
+	Host     string `json:"host,omitempty"`
+	Port     uint16 `json:"port,omitempty"`
+	Priority uint16 `json:"priority,omitempty"`
+	Weight   uint16 `json:"weight,omitempty"`
+	Mail     bool   `json:"mail,omitempty"`
+	TTL      uint32 `json:"ttl,omitempty"`
+}
+
+// namePath returns the SkyDNS path of name: its labels reversed, e.g.
+// /skydns/lan/foo for foo.lan.
+func namePath(prefix string, name string) string {
+	labels := dnssrv.SplitDomainName(strings.ToLower(name))
+	slices.Reverse(labels)
+
+	return strings.TrimSuffix(prefix, "/") + "/" + strings.Join(labels, "/")
+}
+
+// toService returns the SkyDNS value for rec, or false if its type is not
+// supported.
+func toService(rec dns.Record, ttl uint32) (service, bool) {
+	s := service{TTL: ttl}
+
+	switch rec.Type {
+	case dns.A, dns.AAAA:
+		s.Host = rec.Address.String()
+	case dns.CNAME:
+		s.Host = dnssrv.CanonicalName(rec.Target)
+	case dns.PTR:
+		// PTRs are served from the reverse name path when the plugin is
+		// authoritative for the reverse zone
+		s.Host = dnssrv.CanonicalName(rec.Ptr)
+	case dns.SRV:
+		s.Host = dnssrv.CanonicalName(rec.Target)
+		s.Port = rec.Port
+		s.Priority = rec.Priority
+		s.Weight = rec.Weight
+	case dns.MX:
+		s.Host = dnssrv.CanonicalName(rec.Mx)
+		s.Priority = rec.Preference
+		s.Mail = true
+	default:
+		return s, false
+	}
+
+	return s, true
+}
+
+// recordKey returns the key of rec, named after the owner and a hash of its
+// value so that it is stable across syncs.
+func recordKey(prefix string, owner string, rec dns.Record, value []byte) string {
+	h := fnv.New64a()
+	h.Write([]byte(rec.Type))
+	h.Write(value)
+
+	return fmt.Sprintf("%s/%s-%016x", namePath(prefix, rec.Name), owner, h.Sum64())
+}
+
+// owned returns whether key was written by owner.
+func owned(key string, owner string) bool {
+	leaf := key[strings.LastIndex(key, "/")+1:]
+	hash, ok := strings.CutPrefix(leaf, owner+"-")
+	if !ok || len(hash) != 16 {
+		return false
+	}
+
+	return strings.Trim(hash, "0123456789abcdef") == ""
+}
@@ -0,0 +1,23 @@
+package hostsfile
+
+import (
+	"github.com/ShimmerGlass/shimdns/lib/exp"
+	"github.com/ShimmerGlass/shimdns/lib/reload"
+)
+
+const defaultMarker = "shimdns"
+
+type Config struct {
+	Path string `yaml:"path"`
+	// replace the whole file instead of a block delimited by
+	// "# BEGIN <marker>" and "# END <marker>" lines
+	WholeFile bool   `yaml:"whole_file"`
+	Marker    string `yaml:"marker"`
+
+	// add the names of CNAME records to the lines of their targets
+	Aliases bool `yaml:"aliases"`
+
+	Reload reload.Config `yaml:"reload"`
+
+	Filter exp.Filter `yaml:"filter"`
+}
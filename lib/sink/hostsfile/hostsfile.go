@@ -0,0 +1,238 @@
+package hostsfile
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/ShimmerGlass/shimdns/lib/atomicfile"
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+)
+
+const maxCNAMEDepth = 8
+
+type HostsFile struct {
+	log *slog.Logger
+	cfg Config
+
+	// the file was written but the reload did not succeed yet
+	reloadPending bool
+	// records last reported as unsupported, to only log changes
+	lastUnsupported string
+}
+
+func New(log *slog.Logger, cfg Config) (*HostsFile, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("missing path")
+	}
+
+	if cfg.Marker == "" {
+		cfg.Marker = defaultMarker
+	}
+
+	err := cfg.Reload.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("reload: %w", err)
+	}
+
+	return &HostsFile{
+		log: log.With("sink", "hostsfile", "path", cfg.Path),
+		cfg: cfg,
+	}, nil
+}
+
+func (h *HostsFile) Write(ctx context.Context, records []dns.Record) error {
+	err := h.write(ctx, records)
+	if err != nil {
+		return fmt.Errorf("hostsfile sink: %w", err)
+	}
+
+	return nil
+}
+
+func (h *HostsFile) write(ctx context.Context, records []dns.Record) error {
+	records, err := h.cfg.Filter.Filter(records)
+	if err != nil {
+		return err
+	}
+
+	current, err := os.ReadFile(h.cfg.Path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	content, unsupported := h.render(records)
+	h.reportUnsupported(unsupported)
+
+	if !h.cfg.WholeFile {
+		content, err = h.replaceBlock(current, content)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !bytes.Equal(current, content) {
+		perm := os.FileMode(0o644)
+		if fi, err := os.Stat(h.cfg.Path); err == nil {
+			perm = fi.Mode().Perm()
+		}
+
+		err = atomicfile.Write(h.cfg.Path, content, perm)
+		if err != nil {
+			return err
+		}
+
+		h.log.Info("hosts file updated")
+		h.reloadPending = true
+	}
+
+	if !h.reloadPending {
+		return nil
+	}
+
+	err = h.cfg.Reload.Run(ctx)
+	if err != nil {
+		return err
+	}
+
+	h.reloadPending = false
+
+	return nil
+}
+
+// render returns one line per address listing its names, and the records
+// it cannot express.
+func (h *HostsFile) render(records []dns.Record) ([]byte, []dns.Record) {
+	names := map[netip.Addr][]string{}
+	aliases := map[netip.Addr][]string{}
+	byName := map[string][]netip.Addr{}
+	unsupported := []dns.Record{}
+
+	for _, rec := range records {
+		if rec.Type != dns.A && rec.Type != dns.AAAA {
+			continue
+		}
+
+		// resolvers would take the wildcard literally
+		if strings.HasPrefix(rec.Name, "*.") {
+			unsupported = append(unsupported, rec)
+			continue
+		}
+
+		name := strings.TrimSuffix(rec.Name, ".")
+		if !slices.Contains(names[rec.Address], name) {
+			names[rec.Address] = append(names[rec.Address], name)
+			byName[rec.Name] = append(byName[rec.Name], rec.Address)
+		}
+	}
+
+	if h.cfg.Aliases {
+		for _, rec := range records {
+			if rec.Type != dns.CNAME {
+				continue
+			}
+
+			if strings.HasPrefix(rec.Name, "*.") {
+				unsupported = append(unsupported, rec)
+				continue
+			}
+
+			alias := strings.TrimSuffix(rec.Name, ".")
+			for _, addr := range resolve(records, byName, rec.Target) {
+				if !slices.Contains(aliases[addr], alias) {
+					aliases[addr] = append(aliases[addr], alias)
+				}
+			}
+		}
+	}
+
+	addrs := make([]netip.Addr, 0, len(names))
+	for addr := range names {
+		addrs = append(addrs, addr)
+	}
+	slices.SortFunc(addrs, netip.Addr.Compare)
+
+	// sources do not guarantee ordering, keep the output stable to avoid
+	// needless writes
+	buf := &bytes.Buffer{}
+	for _, addr := range addrs {
+		slices.Sort(names[addr])
+		slices.Sort(aliases[addr])
+
+		fmt.Fprintf(buf, "%s %s\n", addr, strings.Join(slices.Concat(names[addr], aliases[addr]), " "))
+	}
+
+	return buf.Bytes(), unsupported
+}
+
+// reportUnsupported logs the records that cannot be expressed in the file,
+// only when they changed since the last write.
+func (h *HostsFile) reportUnsupported(recs []dns.Record) {
+	lines := []string{}
+	for _, rec := range recs {
+		lines = append(lines, rec.String())
+	}
+	slices.Sort(lines)
+
+	key := strings.Join(lines, "\n")
+	if key == h.lastUnsupported {
+		return
+	}
+	h.lastUnsupported = key
+
+	for _, rec := range recs {
+		h.log.Warn("record not supported, skipping", "record", rec)
+	}
+}
+
+// resolve follows CNAME records from name to the addresses it points to.
+func resolve(records []dns.Record, byName map[string][]netip.Addr, name string) []netip.Addr {
+	for range maxCNAMEDepth {
+		if addrs, ok := byName[name]; ok {
+			return addrs
+		}
+
+		idx := slices.IndexFunc(records, func(rec dns.Record) bool {
+			return rec.Type == dns.CNAME && rec.Name == name
+		})
+		if idx < 0 {
+			return nil
+		}
+
+		name = records[idx].Target
+	}
+
+	return nil
+}
+
+// replaceBlock returns current with the managed block content replaced, or
+// appended when the file has no block yet.
+func (h *HostsFile) replaceBlock(current []byte, content []byte) ([]byte, error) {
+	begin := "# BEGIN " + h.cfg.Marker + "\n"
+	end := "# END " + h.cfg.Marker + "\n"
+
+	block := slices.Concat([]byte(begin), content, []byte(end))
+
+	start := bytes.Index(current, []byte(begin))
+	if start < 0 {
+		if len(current) > 0 && !bytes.HasSuffix(current, []byte("\n")) {
+			current = append(current, '\n')
+		}
+
+		return slices.Concat(current, block), nil
+	}
+
+	stop := bytes.Index(current[start:], []byte(end))
+	if stop < 0 {
+		return nil, fmt.Errorf("%q found without %q", strings.TrimSpace(begin), strings.TrimSpace(end))
+	}
+	stop += start + len(end)
+
+	return slices.Concat(current[:start], block, current[stop:]), nil
+}
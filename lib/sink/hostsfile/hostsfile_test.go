@@ -0,0 +1,131 @@
+package hostsfile
+
+import (
+	"context"
+	"log/slog"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	"github.com/ShimmerGlass/shimdns/lib/reload"
+	"github.com/stretchr/testify/require"
+)
+
+var testRecords = []dns.Record{
+	{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.2")},
+	{Type: dns.A, Name: "bar.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+	{Type: dns.AAAA, Name: "foo.lan.", Address: netip.MustParseAddr("fd00::2")},
+	{Type: dns.CNAME, Name: "www.lan.", Target: "alias.lan."},
+	{Type: dns.CNAME, Name: "alias.lan.", Target: "foo.lan."},
+	{Type: dns.PTR, Name: "2.1.168.192.in-addr.arpa.", Ptr: "foo.lan."},
+}
+
+func TestWriteBlock(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hosts")
+	reloads := filepath.Join(dir, "reloads")
+
+	require.NoError(t, os.WriteFile(path, []byte("127.0.0.1 localhost\n# BEGIN shimdns\nold\n# END shimdns\n::1 localhost\n"), 0o600))
+
+	h, err := New(slog.Default(), Config{
+		Path:    path,
+		Aliases: true,
+		Reload:  reload.Config{Command: "echo >> " + reloads},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, h.Write(context.Background(), testRecords))
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, `127.0.0.1 localhost
+# BEGIN shimdns
+192.168.1.1 bar.lan
+192.168.1.2 foo.lan alias.lan www.lan
+fd00::2 foo.lan alias.lan www.lan
+# END shimdns
+::1 localhost
+`, string(content))
+
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+
+	// unchanged content is not written and does not reload
+	require.NoError(t, h.Write(context.Background(), testRecords))
+
+	reloaded, err := os.ReadFile(reloads)
+	require.NoError(t, err)
+	require.Equal(t, "\n", string(reloaded))
+}
+
+func TestWriteWholeFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts")
+
+	h, err := New(slog.Default(), Config{Path: path, WholeFile: true})
+	require.NoError(t, err)
+
+	require.NoError(t, h.Write(context.Background(), testRecords))
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "192.168.1.1 bar.lan\n192.168.1.2 foo.lan\nfd00::2 foo.lan\n", string(content))
+}
+
+func TestWriteBlockAppended(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts")
+	require.NoError(t, os.WriteFile(path, []byte("127.0.0.1 localhost"), 0o644))
+
+	h, err := New(slog.Default(), Config{Path: path, Marker: "lan"})
+	require.NoError(t, err)
+
+	require.NoError(t, h.Write(context.Background(), testRecords[:1]))
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "127.0.0.1 localhost\n# BEGIN lan\n192.168.1.2 foo.lan\n# END lan\n", string(content))
+}
+
+func TestWriteSkipsWildcards(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts")
+
+	h, err := New(slog.Default(), Config{Path: path, WholeFile: true, Aliases: true})
+	require.NoError(t, err)
+
+	require.NoError(t, h.Write(context.Background(), []dns.Record{
+		{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.2")},
+		{Type: dns.A, Name: "*.apps.lan.", Address: netip.MustParseAddr("192.168.1.2")},
+		{Type: dns.CNAME, Name: "*.www.lan.", Target: "foo.lan."},
+	}))
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "192.168.1.2 foo.lan\n", string(content))
+}
+
+func TestReloadRetried(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hosts")
+	ready := filepath.Join(dir, "ready")
+	reloads := filepath.Join(dir, "reloads")
+
+	h, err := New(slog.Default(), Config{
+		Path:      path,
+		WholeFile: true,
+		Reload:    reload.Config{Command: "test -f " + ready + " && echo >> " + reloads},
+	})
+	require.NoError(t, err)
+
+	require.Error(t, h.Write(context.Background(), testRecords))
+
+	// the file is already up to date, the reload is still retried
+	require.NoError(t, os.WriteFile(ready, nil, 0o600))
+	require.NoError(t, h.Write(context.Background(), testRecords))
+	require.NoError(t, h.Write(context.Background(), testRecords))
+
+	reloaded, err := os.ReadFile(reloads)
+	require.NoError(t, err)
+	require.Equal(t, "\n", string(reloaded))
+}
@@ -0,0 +1,22 @@
+package libdns
+
+import "github.com/ShimmerGlass/shimdns/lib/exp"
+
+const defaultTTL = 300
+
+type Config struct {
+	// name of a registered provider
+	Provider string `yaml:"provider"`
+	// provider settings, decoded into the provider struct using its JSON tags
+	Options map[string]any `yaml:"options"`
+
+	Zone string `yaml:"zone"`
+
+	// file the owned record sets are kept in across restarts, required.
+	// Record sets not created by shimdns are never modified.
+	StateFile string `yaml:"state_file"`
+
+	TTL uint32 `yaml:"ttl"`
+
+	Filter exp.Filter `yaml:"filter"`
+}
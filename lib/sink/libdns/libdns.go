@@ -0,0 +1,231 @@
+package libdns
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	"github.com/libdns/libdns"
+	dnssrv "github.com/miekg/dns"
+	"github.com/samber/lo"
+)
+
+type LibDNS struct {
+	log      *slog.Logger
+	cfg      Config
+	provider Provider
+
+	zone  string
+	owned map[string]struct{}
+}
+
+func New(log *slog.Logger, cfg Config) (*LibDNS, error) {
+	if cfg.Zone == "" {
+		return nil, fmt.Errorf("missing zone")
+	}
+
+	if cfg.StateFile == "" {
+		return nil, fmt.Errorf("missing state_file")
+	}
+
+	if cfg.TTL == 0 {
+		cfg.TTL = defaultTTL
+	}
+
+	provider, err := newProvider(cfg.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	// libdns providers are configured through their JSON tags
+	buf, err := json.Marshal(cfg.Options)
+	if err != nil {
+		return nil, fmt.Errorf("options: %w", err)
+	}
+	err = json.Unmarshal(buf, provider)
+	if err != nil {
+		return nil, fmt.Errorf("options: %w", err)
+	}
+
+	l := &LibDNS{
+		log:      log.With("sink", "libdns", "provider", cfg.Provider, "zone", cfg.Zone),
+		cfg:      cfg,
+		provider: provider,
+		zone:     strings.ToLower(dnssrv.CanonicalName(cfg.Zone)),
+		owned:    map[string]struct{}{},
+	}
+
+	err = l.loadState()
+	if err != nil {
+		return nil, fmt.Errorf("state: %w", err)
+	}
+
+	return l, nil
+}
+
+func (l *LibDNS) Write(ctx context.Context, records []dns.Record) error {
+	err := l.write(ctx, records)
+	if err != nil {
+		return fmt.Errorf("libdns sink: %w", err)
+	}
+
+	return nil
+}
+
+func (l *LibDNS) write(ctx context.Context, records []dns.Record) error {
+	records, err := l.cfg.Filter.Filter(records)
+	if err != nil {
+		return err
+	}
+
+	desired := map[string][]libdns.Record{}
+	for _, rec := range records {
+		name := strings.ToLower(dnssrv.CanonicalName(rec.Name))
+		if !dnssrv.IsSubDomain(l.zone, name) {
+			continue
+		}
+
+		r, ok := l.toLibDNS(rec)
+		if !ok {
+			continue
+		}
+
+		k := key(r.RR())
+		if !slices.ContainsFunc(desired[k], func(o libdns.Record) bool { return sameData(o.RR(), r.RR()) }) {
+			desired[k] = append(desired[k], r)
+		}
+	}
+
+	currentRecs, err := l.provider.GetRecords(ctx, l.zone)
+	if err != nil {
+		return fmt.Errorf("get records: %w", err)
+	}
+
+	current := map[string][]libdns.Record{}
+	for _, r := range currentRecs {
+		k := key(r.RR())
+		current[k] = append(current[k], r)
+	}
+
+	toSet := []libdns.Record{}
+	setKeys := []string{}
+	for _, k := range slices.Sorted(maps.Keys(desired)) {
+		_, owned := l.owned[k]
+		cur, exists := current[k]
+
+		if exists && !owned {
+			l.log.Warn("record set exists and is not managed by shimdns, skipping", "record_set", k)
+			continue
+		}
+
+		if exists && sameSet(cur, desired[k]) {
+			continue
+		}
+
+		toSet = append(toSet, desired[k]...)
+		setKeys = append(setKeys, k)
+	}
+
+	toDelete := []libdns.Record{}
+	deleteKeys := []string{}
+	for _, k := range slices.Sorted(maps.Keys(l.owned)) {
+		if _, ok := desired[k]; ok {
+			continue
+		}
+
+		toDelete = append(toDelete, current[k]...)
+		deleteKeys = append(deleteKeys, k)
+	}
+
+	if len(toSet) > 0 {
+		_, err := l.provider.SetRecords(ctx, l.zone, toSet)
+		if err != nil {
+			return fmt.Errorf("set records: %w", err)
+		}
+
+		for _, k := range setKeys {
+			l.owned[k] = struct{}{}
+			l.log.Info("record set updated", "record_set", k)
+		}
+	}
+
+	if len(toDelete) > 0 {
+		_, err := l.provider.DeleteRecords(ctx, l.zone, toDelete)
+		if err != nil {
+			return fmt.Errorf("delete records: %w", err)
+		}
+	}
+
+	for _, k := range deleteKeys {
+		delete(l.owned, k)
+		if len(current[k]) > 0 {
+			l.log.Info("record set deleted", "record_set", k)
+		}
+	}
+
+	if len(setKeys) > 0 || len(deleteKeys) > 0 {
+		err := l.saveState()
+		if err != nil {
+			return fmt.Errorf("state: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// toLibDNS returns the libdns record for rec, with its name relative to the
+// zone, or false if its type is not supported.
+func (l *LibDNS) toLibDNS(rec dns.Record) (libdns.Record, bool) {
+	name := libdns.RelativeName(strings.ToLower(dnssrv.CanonicalName(rec.Name)), l.zone)
+	ttl := time.Duration(l.cfg.TTL) * time.Second
+
+	switch rec.Type {
+	case dns.A, dns.AAAA:
+		return libdns.Address{Name: name, TTL: ttl, IP: rec.Address}, true
+	case dns.CNAME:
+		return libdns.CNAME{Name: name, TTL: ttl, Target: dnssrv.CanonicalName(rec.Target)}, true
+	case dns.MX:
+		return libdns.MX{Name: name, TTL: ttl, Preference: rec.Preference, Target: dnssrv.CanonicalName(rec.Mx)}, true
+	case dns.SRV:
+		return libdns.SRV{Name: name, TTL: ttl, Priority: rec.Priority, Weight: rec.Weight, Port: rec.Port, Target: dnssrv.CanonicalName(rec.Target)}, true
+	case dns.PTR:
+		return libdns.RR{Name: name, TTL: ttl, Type: string(dns.PTR), Data: dnssrv.CanonicalName(rec.Ptr)}, true
+	default:
+		return nil, false
+	}
+}
+
+func sameSet(a []libdns.Record, b []libdns.Record) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for _, r := range a {
+		if r.RR().TTL.Truncate(time.Second) != b[0].RR().TTL {
+			return false
+		}
+
+		if !lo.ContainsBy(b, func(o libdns.Record) bool { return sameData(r.RR(), o.RR()) }) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// sameData compares record data ignoring case and the trailing dot of names,
+// which providers do not report consistently.
+func sameData(a libdns.RR, b libdns.RR) bool {
+	norm := func(s string) string { return strings.TrimSuffix(strings.ToLower(s), ".") }
+	return norm(a.Data) == norm(b.Data)
+}
+
+func key(rr libdns.RR) string {
+	return strings.ToLower(rr.Name) + " " + rr.Type
+}
@@ -0,0 +1,134 @@
+package libdns
+
+import (
+	"context"
+	"log/slog"
+	"net/netip"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	"github.com/libdns/libdns"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryProvider is an in-memory libdns provider.
+type memoryProvider struct {
+	Token string `json:"token"`
+
+	mu      sync.Mutex
+	records []libdns.RR
+	calls   int
+}
+
+func (m *memoryProvider) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return lo.Map(m.records, func(rr libdns.RR, _ int) libdns.Record {
+		rec, _ := rr.Parse()
+		return rec
+	}), nil
+}
+
+func (m *memoryProvider) SetRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.calls++
+	for _, r := range recs {
+		m.records = lo.Reject(m.records, func(cur libdns.RR, _ int) bool {
+			return cur.Name == r.RR().Name && cur.Type == r.RR().Type
+		})
+	}
+	for _, r := range recs {
+		m.records = append(m.records, r.RR())
+	}
+
+	return recs, nil
+}
+
+func (m *memoryProvider) DeleteRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.calls++
+	for _, r := range recs {
+		m.records = lo.Reject(m.records, func(cur libdns.RR, _ int) bool { return cur == r.RR() })
+	}
+
+	return recs, nil
+}
+
+func (m *memoryProvider) find(name string, rtype string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return lo.FilterMap(m.records, func(rr libdns.RR, _ int) (string, bool) {
+		return rr.Data, rr.Name == name && rr.Type == rtype
+	})
+}
+
+func TestWrite(t *testing.T) {
+	provider := &memoryProvider{records: []libdns.RR{
+		{Name: "manual", TTL: time.Hour, Type: "A", Data: "10.0.0.1"},
+		{Name: "@", TTL: time.Hour, Type: "MX", Data: "10 mail.example.com."},
+	}}
+	Register("memory", func() Provider { return provider })
+
+	cfg := Config{
+		Provider:  "memory",
+		Options:   map[string]any{"token": "secret"},
+		Zone:      "example.com",
+		StateFile: filepath.Join(t.TempDir(), "state.json"),
+	}
+
+	l, err := New(slog.Default(), cfg)
+	require.NoError(t, err)
+	require.Equal(t, "secret", provider.Token)
+
+	recs := []dns.Record{
+		{Type: dns.A, Name: "foo.example.com.", Address: netip.MustParseAddr("192.168.1.1")},
+		{Type: dns.A, Name: "foo.example.com.", Address: netip.MustParseAddr("192.168.1.2")},
+		{Type: dns.A, Name: "manual.example.com.", Address: netip.MustParseAddr("192.168.1.3")},
+		{Type: dns.SRV, Name: "_http._tcp.foo.example.com.", Target: "foo.example.com.", Port: 80},
+		{Type: dns.MX, Name: "example.com.", Mx: "mail2.example.com.", Preference: 20},
+		{Type: dns.A, Name: "foo.other.", Address: netip.MustParseAddr("192.168.2.1")},
+	}
+
+	require.NoError(t, l.Write(context.Background(), recs))
+
+	require.ElementsMatch(t, []string{"192.168.1.1", "192.168.1.2"}, provider.find("foo", "A"))
+	require.Equal(t, []string{"0 0 80 foo.example.com."}, provider.find("_http._tcp.foo", "SRV"))
+
+	// record sets not created by the sink are left alone
+	require.Equal(t, []string{"10.0.0.1"}, provider.find("manual", "A"))
+	require.Equal(t, []string{"10 mail.example.com."}, provider.find("@", "MX"))
+
+	// unchanged records do not cause calls
+	calls := provider.calls
+	require.NoError(t, l.Write(context.Background(), recs))
+	require.Equal(t, calls, provider.calls)
+
+	// ownership survives restarts
+	l, err = New(slog.Default(), cfg)
+	require.NoError(t, err)
+
+	require.NoError(t, l.Write(context.Background(), recs[:1]))
+	require.Equal(t, []string{"192.168.1.1"}, provider.find("foo", "A"))
+	require.Empty(t, provider.find("_http._tcp.foo", "SRV"))
+	require.Equal(t, []string{"10.0.0.1"}, provider.find("manual", "A"))
+}
+
+func TestUnknownProvider(t *testing.T) {
+	_, err := New(slog.Default(), Config{Provider: "nope", Zone: "example.com", StateFile: filepath.Join(t.TempDir(), "state.json")})
+	require.ErrorContains(t, err, `unknown provider "nope"`)
+}
+
+func TestStateFileRequired(t *testing.T) {
+	_, err := New(slog.Default(), Config{Provider: "test", Zone: "example.com"})
+	require.ErrorContains(t, err, "state_file")
+}
@@ -0,0 +1,50 @@
+package libdns
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/libdns/libdns"
+)
+
+// Provider is a libdns provider able to list, set and delete records.
+type Provider interface {
+	libdns.RecordGetter
+	libdns.RecordSetter
+	libdns.RecordDeleter
+}
+
+var (
+	providersLock sync.Mutex
+	providers     = map[string]func() Provider{}
+)
+
+// Register makes a libdns provider available under name. fn must return a
+// pointer to a new zero value of the provider, e.g.:
+//
+//	libdns.Register("hetzner", func() libdns.Provider { return &hetzner.Provider{} })
+func Register(name string, fn func() Provider) {
+	providersLock.Lock()
+	defer providersLock.Unlock()
+
+	providers[name] = fn
+}
+
+func newProvider(name string) (Provider, error) {
+	providersLock.Lock()
+	defer providersLock.Unlock()
+
+	fn, ok := providers[name]
+	if !ok {
+		names := make([]string, 0, len(providers))
+		for n := range providers {
+			names = append(names, n)
+		}
+		slices.Sort(names)
+
+		return nil, fmt.Errorf("unknown provider %q, available: %v", name, names)
+	}
+
+	return fn(), nil
+}
@@ -0,0 +1,25 @@
+package libdns
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/ShimmerGlass/shimdns/lib/statefile"
+)
+
+func (l *LibDNS) loadState() error {
+	keys, err := statefile.Load[string](l.cfg.StateFile)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range keys {
+		l.owned[k] = struct{}{}
+	}
+
+	return nil
+}
+
+func (l *LibDNS) saveState() error {
+	return statefile.Save(l.cfg.StateFile, slices.Sorted(maps.Keys(l.owned)))
+}
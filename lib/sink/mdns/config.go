@@ -0,0 +1,22 @@
+package mdns
+
+import "github.com/ShimmerGlass/shimdns/lib/exp"
+
+type Config struct {
+	// interfaces to answer on, all multicast capable interfaces when empty
+	Interfaces  []string `yaml:"interfaces"`
+	DisableIPv6 bool     `yaml:"disable_ipv6"`
+
+	// names under these domains are moved into .local, ie. with "lan"
+	// foo.lan. is published as foo.local.
+	Rename []string `yaml:"rename"`
+
+	// SRV records named "_service._proto.<instance>.<domain>" are published
+	// as the DNS-SD instance "<instance>._service._proto.local.", ie.
+	// _http._tcp.nas.lan. as nas._http._tcp.local. Only the first label
+	// after the service type names the instance. TXT holds the TXT record
+	// content of these instances by service type, ie. "_http._tcp"
+	TXT map[string][]string `yaml:"txt"`
+
+	Filter exp.Filter `yaml:"filter"`
+}
@@ -0,0 +1,466 @@
+package mdns
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	dnssrv "github.com/miekg/dns"
+	"github.com/samber/lo"
+)
+
+const (
+	port = 5353
+
+	// RFC 6762 section 8.1
+	probeCount    = 3
+	probeInterval = 250 * time.Millisecond
+	// RFC 6762 section 8.2, probing restarts after losing a tiebreak
+	tiebreakDelay = time.Second
+	// lost tiebreaks before the name is considered in use
+	maxTiebreaks = 5
+	// RFC 6762 section 8.3
+	announceInterval = time.Second
+
+	// records per message sent unsolicited
+	maxRecordsPerMsg = 50
+
+	// top bit of the class, cache flush in responses and unicast response
+	// requested in questions
+	classTopBit = 1 << 15
+)
+
+var (
+	groupIPv4 = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: port}
+	groupIPv6 = &net.UDPAddr{IP: net.ParseIP("ff02::fb"), Port: port}
+)
+
+type MDNS struct {
+	log *slog.Logger
+	cfg Config
+
+	links []*link
+
+	lock    sync.Mutex
+	records []dnssrv.RR
+	probing map[string]*probeState
+	// records not published because their name is in use on the network,
+	// by name. They are not probed again until they change.
+	conflicts map[string][]dnssrv.RR
+}
+
+// link is a multicast socket on one interface and address family.
+type link struct {
+	iface *net.Interface
+	conn  *net.UDPConn
+	group *net.UDPAddr
+}
+
+// local reports whether addr is on the link network.
+func (l *link) local(addr *net.UDPAddr) bool {
+	if addr.IP.To4() == nil {
+		return addr.Zone == "" || addr.Zone == l.iface.Name
+	}
+
+	addrs, err := l.iface.Addrs()
+	if err != nil {
+		return true
+	}
+
+	for _, a := range addrs {
+		if n, ok := a.(*net.IPNet); ok && n.Contains(addr.IP) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func New(log *slog.Logger, cfg Config) (*MDNS, error) {
+	m := &MDNS{
+		log:       log.With("sink", "mdns"),
+		cfg:       cfg,
+		probing:   map[string]*probeState{},
+		conflicts: map[string][]dnssrv.RR{},
+	}
+
+	ifaces, err := m.interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, iface := range ifaces {
+		groups := []*net.UDPAddr{groupIPv4}
+		if !cfg.DisableIPv6 {
+			groups = append(groups, groupIPv6)
+		}
+
+		for _, group := range groups {
+			network := "udp4"
+			if group.IP.To4() == nil {
+				network = "udp6"
+			}
+
+			conn, err := net.ListenMulticastUDP(network, iface, group)
+			if err != nil {
+				m.log.Warn("cannot listen", "iface", iface.Name, "group", group, "err", err)
+				continue
+			}
+
+			l := &link{iface: iface, conn: conn, group: group}
+			m.links = append(m.links, l)
+
+			m.log.Info("listening", "iface", iface.Name, "group", group)
+			go m.read(l)
+		}
+	}
+
+	if len(m.links) == 0 {
+		return nil, fmt.Errorf("no usable interface")
+	}
+
+	return m, nil
+}
+
+func (m *MDNS) interfaces() ([]*net.Interface, error) {
+	if len(m.cfg.Interfaces) > 0 {
+		res := []*net.Interface{}
+		for _, name := range m.cfg.Interfaces {
+			iface, err := net.InterfaceByName(name)
+			if err != nil {
+				return nil, fmt.Errorf("interface %q: %w", name, err)
+			}
+
+			res = append(res, iface)
+		}
+
+		return res, nil
+	}
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("interfaces: %w", err)
+	}
+
+	res := []*net.Interface{}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp != 0 && iface.Flags&net.FlagMulticast != 0 && iface.Flags&net.FlagLoopback == 0 {
+			res = append(res, &iface)
+		}
+	}
+
+	return res, nil
+}
+
+func (m *MDNS) Write(ctx context.Context, records []dns.Record) error {
+	records, err := m.cfg.Filter.Filter(records)
+	if err != nil {
+		return err
+	}
+
+	rrs := m.resourceRecords(records)
+
+	m.lock.Lock()
+	old := m.records
+	m.lock.Unlock()
+
+	added := lo.Filter(rrs, func(rr dnssrv.RR, _ int) bool { return !containsRR(old, rr) })
+	removed := lo.Filter(old, func(rr dnssrv.RR, _ int) bool { return !containsRR(rrs, rr) })
+
+	// names found in use stay unpublished until their records change
+	m.lock.Lock()
+	for name, conflicted := range m.conflicts {
+		if !sameRRs(conflicted, lo.Filter(rrs, func(rr dnssrv.RR, _ int) bool { return sameName(rr.Header().Name, name) })) {
+			delete(m.conflicts, name)
+			continue
+		}
+
+		added = lo.Filter(added, func(rr dnssrv.RR, _ int) bool { return !sameName(rr.Header().Name, name) })
+	}
+	m.lock.Unlock()
+
+	if len(added) == 0 && len(removed) == 0 {
+		return nil
+	}
+
+	// stop answering for removed records and tell caches to forget them
+	m.lock.Lock()
+	m.records = lo.Filter(m.records, func(rr dnssrv.RR, _ int) bool { return !containsRR(removed, rr) })
+	m.lock.Unlock()
+
+	m.goodbye(removed)
+
+	// names we did not own before must be probed before being claimed
+	newNames := []string{}
+	for _, rr := range added {
+		name := strings.ToLower(rr.Header().Name)
+		if shared(rr) || lo.Contains(newNames, name) || lo.ContainsBy(old, func(o dnssrv.RR) bool { return sameName(o.Header().Name, name) }) {
+			continue
+		}
+
+		newNames = append(newNames, name)
+	}
+
+	conflicts, err := m.probe(ctx, newNames, added)
+	if err != nil {
+		return err
+	}
+
+	m.lock.Lock()
+	for name := range conflicts {
+		m.log.Warn("name already in use on the network, not publishing", "name", name)
+		m.conflicts[name] = lo.Filter(added, func(rr dnssrv.RR, _ int) bool { return sameName(rr.Header().Name, name) })
+	}
+
+	added = lo.Filter(added, func(rr dnssrv.RR, _ int) bool { return !conflicts[strings.ToLower(rr.Header().Name)] })
+	m.records = append(m.records, added...)
+	m.lock.Unlock()
+
+	m.announce(added)
+
+	return nil
+}
+
+// announce sends unsolicited responses for rrs, as per RFC 6762 section 8.3.
+func (m *MDNS) announce(rrs []dnssrv.RR) {
+	if len(rrs) == 0 {
+		return
+	}
+
+	rrs = lo.Map(rrs, func(rr dnssrv.RR, _ int) dnssrv.RR { return cacheFlush(rr) })
+
+	m.sendRecords(rrs)
+	time.AfterFunc(announceInterval, func() { m.sendRecords(rrs) })
+}
+
+// goodbye tells caches to drop rrs, as per RFC 6762 section 10.1.
+func (m *MDNS) goodbye(rrs []dnssrv.RR) {
+	rrs = lo.Map(rrs, func(rr dnssrv.RR, _ int) dnssrv.RR {
+		rr = dnssrv.Copy(rr)
+		rr.Header().Ttl = 0
+		return rr
+	})
+
+	m.sendRecords(rrs)
+}
+
+func (m *MDNS) sendRecords(rrs []dnssrv.RR) {
+	for _, chunk := range lo.Chunk(rrs, maxRecordsPerMsg) {
+		msg := new(dnssrv.Msg)
+		msg.Response = true
+		msg.Authoritative = true
+		msg.Answer = chunk
+
+		m.send(msg)
+	}
+}
+
+func (m *MDNS) send(msg *dnssrv.Msg) {
+	buf, err := msg.Pack()
+	if err != nil {
+		m.log.Warn("pack", "err", err)
+		return
+	}
+
+	for _, l := range m.links {
+		_, err := l.conn.WriteToUDP(buf, l.group)
+		if err != nil {
+			m.log.Debug("send", "iface", l.iface.Name, "group", l.group, "err", err)
+		}
+	}
+}
+
+func (m *MDNS) read(l *link) {
+	buf := make([]byte, 9000)
+
+	for {
+		n, src, err := l.conn.ReadFromUDP(buf)
+		if err != nil {
+			m.log.Warn("read", "iface", l.iface.Name, "err", err)
+			return
+		}
+
+		msg := new(dnssrv.Msg)
+		if err := msg.Unpack(buf[:n]); err != nil {
+			m.log.Debug("invalid message", "src", src, "err", err)
+			continue
+		}
+
+		// sockets bound to the same group receive the traffic of all
+		// interfaces
+		if !l.local(src) {
+			continue
+		}
+
+		if msg.Opcode != dnssrv.OpcodeQuery || msg.Rcode != dnssrv.RcodeSuccess {
+			continue
+		}
+
+		if msg.Response {
+			m.checkConflicts(msg)
+			continue
+		}
+
+		m.checkTiebreaks(msg)
+
+		m.lock.Lock()
+		rrs := m.records
+		m.lock.Unlock()
+
+		// legacy unicast queries do not come from the mDNS port
+		legacy := src.Port != port
+
+		res, unicast := answer(rrs, msg, legacy)
+		if res == nil {
+			continue
+		}
+
+		out, err := res.Pack()
+		if err != nil {
+			m.log.Warn("pack", "err", err)
+			continue
+		}
+
+		dst := l.group
+		if unicast {
+			dst = src
+		}
+
+		_, err = l.conn.WriteToUDP(out, dst)
+		if err != nil {
+			m.log.Debug("send", "iface", l.iface.Name, "dst", dst, "err", err)
+		}
+	}
+}
+
+// answer returns the response to req, if any, and whether it must be sent
+// unicast to the querier.
+func answer(rrs []dnssrv.RR, req *dnssrv.Msg, legacy bool) (*dnssrv.Msg, bool) {
+	res := new(dnssrv.Msg)
+	res.Response = true
+	res.Authoritative = true
+
+	unicast := legacy
+
+	if legacy {
+		res.Id = req.Id
+		res.Question = req.Question
+	}
+
+	for _, q := range req.Question {
+		if q.Qclass&classTopBit != 0 {
+			unicast = true
+		}
+
+		if class := q.Qclass &^ classTopBit; class != dnssrv.ClassINET && class != dnssrv.ClassANY {
+			continue
+		}
+
+		for _, rr := range rrs {
+			hdr := rr.Header()
+			if !sameName(hdr.Name, q.Name) || (q.Qtype != dnssrv.TypeANY && q.Qtype != hdr.Rrtype) {
+				continue
+			}
+
+			if knownAnswer(req, rr) {
+				continue
+			}
+
+			res.Answer = append(res.Answer, rr)
+		}
+	}
+
+	if len(res.Answer) == 0 {
+		return nil, false
+	}
+
+	// additional records, RFC 6763 section 12
+	for _, rr := range res.Answer {
+		var targets []string
+
+		switch rr := rr.(type) {
+		case *dnssrv.PTR:
+			targets = []string{rr.Ptr}
+		case *dnssrv.SRV:
+			targets = []string{rr.Target}
+		}
+
+		for len(targets) > 0 {
+			target := targets[0]
+			targets = targets[1:]
+
+			for _, e := range rrs {
+				if !sameName(e.Header().Name, target) || containsRR(res.Answer, e) || containsRR(res.Extra, e) {
+					continue
+				}
+
+				switch e := e.(type) {
+				case *dnssrv.SRV:
+					targets = append(targets, e.Target)
+				case *dnssrv.A, *dnssrv.AAAA, *dnssrv.TXT:
+				default:
+					continue
+				}
+
+				res.Extra = append(res.Extra, e)
+			}
+		}
+	}
+
+	res.Answer = lo.Map(res.Answer, func(rr dnssrv.RR, _ int) dnssrv.RR { return output(rr, legacy) })
+	res.Extra = lo.Map(res.Extra, func(rr dnssrv.RR, _ int) dnssrv.RR { return output(rr, legacy) })
+
+	return res, unicast
+}
+
+// knownAnswer reports whether the querier already has rr cached with at
+// least half of its TTL remaining, RFC 6762 section 7.1.
+func knownAnswer(req *dnssrv.Msg, rr dnssrv.RR) bool {
+	for _, known := range req.Answer {
+		if dnssrv.IsDuplicate(known, rr) && known.Header().Ttl >= rr.Header().Ttl/2 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func output(rr dnssrv.RR, legacy bool) dnssrv.RR {
+	if legacy {
+		// RFC 6762 section 6.7
+		rr = dnssrv.Copy(rr)
+		rr.Header().Ttl = min(rr.Header().Ttl, 10)
+		return rr
+	}
+
+	return cacheFlush(rr)
+}
+
+func cacheFlush(rr dnssrv.RR) dnssrv.RR {
+	if shared(rr) {
+		return rr
+	}
+
+	rr = dnssrv.Copy(rr)
+	rr.Header().Class |= classTopBit
+
+	return rr
+}
+
+// sameRRs reports whether a and b hold the same records.
+func sameRRs(a []dnssrv.RR, b []dnssrv.RR) bool {
+	return len(a) == len(b) &&
+		lo.EveryBy(a, func(rr dnssrv.RR) bool { return containsRR(b, rr) }) &&
+		lo.EveryBy(b, func(rr dnssrv.RR) bool { return containsRR(a, rr) })
+}
+
+func containsRR(rrs []dnssrv.RR, rr dnssrv.RR) bool {
+	return lo.ContainsBy(rrs, func(e dnssrv.RR) bool {
+		return dnssrv.IsDuplicate(e, rr) && e.Header().Ttl == rr.Header().Ttl
+	})
+}
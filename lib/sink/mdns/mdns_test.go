@@ -0,0 +1,226 @@
+package mdns
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	dnssrv "github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func testRecords(t *testing.T) []dnssrv.RR {
+	m := &MDNS{cfg: Config{
+		Rename: []string{"lan"},
+		TXT:    map[string][]string{"_ipp._tcp": {"txtvers=1"}},
+	}}
+
+	return m.resourceRecords([]dns.Record{
+		{Type: dns.A, Name: "printer.lan.", Address: netip.MustParseAddr("192.168.1.10")},
+		{Type: dns.SRV, Name: "_ipp._tcp.printer.lan.", Target: "printer.lan.", Port: 631},
+		{Type: dns.PTR, Name: "10.1.168.192.in-addr.arpa.", Ptr: "printer.lan."},
+		// not renamed and not in .local
+		{Type: dns.A, Name: "foo.other.", Address: netip.MustParseAddr("192.168.1.11")},
+	})
+}
+
+func TestResourceRecords(t *testing.T) {
+	rrs := testRecords(t)
+
+	names := []string{}
+	for _, rr := range rrs {
+		names = append(names, rr.String())
+	}
+
+	require.ElementsMatch(t, []string{
+		"printer.local.\t120\tIN\tA\t192.168.1.10",
+		"printer._ipp._tcp.local.\t120\tIN\tSRV\t0 0 631 printer.local.",
+		"printer._ipp._tcp.local.\t4500\tIN\tTXT\t\"txtvers=1\"",
+		"_ipp._tcp.local.\t4500\tIN\tPTR\tprinter._ipp._tcp.local.",
+		"_services._dns-sd._udp.local.\t4500\tIN\tPTR\t_ipp._tcp.local.",
+		"10.1.168.192.in-addr.arpa.\t120\tIN\tPTR\tprinter.local.",
+	}, names)
+}
+
+func TestAnswer(t *testing.T) {
+	rrs := testRecords(t)
+
+	// browsing a service returns the instance details as additional records
+	req := new(dnssrv.Msg)
+	req.SetQuestion("_ipp._tcp.local.", dnssrv.TypePTR)
+	req.Question[0].Qclass |= classTopBit
+
+	res, unicast := answer(rrs, req, false)
+	require.True(t, unicast)
+	require.Len(t, res.Answer, 1)
+	require.Empty(t, res.Question)
+	// shared records do not set cache flush
+	require.Equal(t, uint16(dnssrv.ClassINET), res.Answer[0].Header().Class)
+
+	extra := []uint16{}
+	for _, rr := range res.Extra {
+		extra = append(extra, rr.Header().Rrtype)
+		require.Equal(t, uint16(dnssrv.ClassINET|classTopBit), rr.Header().Class)
+	}
+	require.ElementsMatch(t, []uint16{dnssrv.TypeSRV, dnssrv.TypeTXT, dnssrv.TypeA}, extra)
+
+	// known answers are suppressed
+	req = new(dnssrv.Msg)
+	req.SetQuestion("printer.local.", dnssrv.TypeA)
+	req.Answer = []dnssrv.RR{rrs[0]}
+	res, _ = answer(rrs, req, false)
+	require.Nil(t, res)
+
+	// legacy unicast queries get the question back and short TTLs
+	req = new(dnssrv.Msg)
+	req.SetQuestion("PRINTER.local.", dnssrv.TypeANY)
+	res, unicast = answer(rrs, req, true)
+	require.True(t, unicast)
+	require.Equal(t, req.Id, res.Id)
+	require.Len(t, res.Question, 1)
+	require.Len(t, res.Answer, 1)
+	require.EqualValues(t, 10, res.Answer[0].Header().Ttl)
+
+	req = new(dnssrv.Msg)
+	req.SetQuestion("missing.local.", dnssrv.TypeA)
+	res, _ = answer(rrs, req, false)
+	require.Nil(t, res)
+}
+
+func TestTiebreak(t *testing.T) {
+	a := func(ip string) dnssrv.RR {
+		return &dnssrv.A{
+			Hdr: dnssrv.RR_Header{Name: "printer.local.", Rrtype: dnssrv.TypeA, Class: dnssrv.ClassINET, Ttl: hostTTL},
+			A:   net.ParseIP(ip),
+		}
+	}
+	aaaa := &dnssrv.AAAA{
+		Hdr:  dnssrv.RR_Header{Name: "printer.local.", Rrtype: dnssrv.TypeAAAA, Class: dnssrv.ClassINET | classTopBit, Ttl: hostTTL},
+		AAAA: net.ParseIP("fd00::1"),
+	}
+
+	for _, tc := range []struct {
+		name   string
+		ours   []dnssrv.RR
+		theirs []dnssrv.RR
+		res    int
+	}{
+		{name: "identical", ours: []dnssrv.RR{a("192.168.1.10")}, theirs: []dnssrv.RR{a("192.168.1.10")}, res: 0},
+		{name: "greater rdata wins", ours: []dnssrv.RR{a("192.168.1.11")}, theirs: []dnssrv.RR{a("192.168.1.10")}, res: 1},
+		{name: "lesser rdata loses", ours: []dnssrv.RR{a("169.254.99.200")}, theirs: []dnssrv.RR{a("169.254.200.50")}, res: -1},
+		// RFC 6762 section 8.2 example, type is compared before rdata
+		{name: "greater type wins", ours: []dnssrv.RR{aaaa}, theirs: []dnssrv.RR{a("192.168.1.10")}, res: 1},
+		{name: "longer list wins", ours: []dnssrv.RR{a("192.168.1.10")}, theirs: []dnssrv.RR{a("192.168.1.10"), aaaa}, res: -1},
+		// lists are sorted before comparing
+		{
+			name:   "order independent",
+			ours:   []dnssrv.RR{a("192.168.1.20"), a("192.168.1.10")},
+			theirs: []dnssrv.RR{a("192.168.1.10"), a("192.168.1.30")},
+			res:    -1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.res, tiebreak(tc.ours, tc.theirs))
+			require.Equal(t, -tc.res, tiebreak(tc.theirs, tc.ours))
+		})
+	}
+}
+
+func testMDNS() *MDNS {
+	return &MDNS{
+		log:       slog.Default(),
+		cfg:       Config{Rename: []string{"lan"}},
+		probing:   map[string]*probeState{},
+		conflicts: map[string][]dnssrv.RR{},
+	}
+}
+
+// waitProbing waits until name is being probed.
+func waitProbing(t *testing.T, m *MDNS, name string) *probeState {
+	var st *probeState
+	require.Eventually(t, func() bool {
+		m.lock.Lock()
+		defer m.lock.Unlock()
+		st = m.probing[name]
+		return st != nil
+	}, 5*time.Second, time.Millisecond)
+
+	return st
+}
+
+func TestProbeTiebreakLost(t *testing.T) {
+	m := testMDNS()
+
+	recs := []dns.Record{{Type: dns.A, Name: "printer.lan.", Address: netip.MustParseAddr("192.168.1.10")}}
+
+	done := make(chan error)
+	go func() { done <- m.Write(context.Background(), recs) }()
+
+	st := waitProbing(t, m, "printer.local.")
+
+	// another host probes simultaneously with greater records
+	req := new(dnssrv.Msg)
+	req.SetQuestion("printer.local.", dnssrv.TypeANY)
+	req.Ns = []dnssrv.RR{&dnssrv.A{
+		Hdr: dnssrv.RR_Header{Name: "printer.local.", Rrtype: dnssrv.TypeA, Class: dnssrv.ClassINET, Ttl: hostTTL},
+		A:   net.ParseIP("192.168.1.20"),
+	}}
+	m.checkTiebreaks(req)
+
+	m.lock.Lock()
+	require.True(t, st.lost)
+	m.lock.Unlock()
+
+	// probing restarts, and the winner now answers for the name
+	require.Eventually(t, func() bool {
+		m.lock.Lock()
+		defer m.lock.Unlock()
+		return !st.lost
+	}, 5*time.Second, time.Millisecond)
+
+	res := new(dnssrv.Msg)
+	res.Response = true
+	res.Answer = req.Ns
+	m.checkConflicts(res)
+
+	require.NoError(t, <-done)
+	require.Empty(t, m.records)
+}
+
+func TestConflictRemembered(t *testing.T) {
+	m := testMDNS()
+
+	recs := []dns.Record{{Type: dns.A, Name: "printer.lan.", Address: netip.MustParseAddr("192.168.1.10")}}
+
+	done := make(chan error)
+	go func() { done <- m.Write(context.Background(), recs) }()
+
+	waitProbing(t, m, "printer.local.")
+
+	res := new(dnssrv.Msg)
+	res.Response = true
+	res.Answer = []dnssrv.RR{&dnssrv.A{
+		Hdr: dnssrv.RR_Header{Name: "printer.local.", Rrtype: dnssrv.TypeA, Class: dnssrv.ClassINET, Ttl: hostTTL},
+		A:   net.ParseIP("192.168.1.20"),
+	}}
+	m.checkConflicts(res)
+
+	require.NoError(t, <-done)
+	require.Empty(t, m.records)
+
+	// the conflicted name is not probed again
+	start := time.Now()
+	require.NoError(t, m.Write(context.Background(), recs))
+	require.Less(t, time.Since(start), probeInterval)
+	require.Empty(t, m.records)
+
+	// until its records change
+	recs[0].Address = netip.MustParseAddr("192.168.1.11")
+	require.NoError(t, m.Write(context.Background(), recs))
+	require.Len(t, m.records, 1)
+	require.Empty(t, m.conflicts)
+}
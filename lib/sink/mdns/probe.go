@@ -0,0 +1,208 @@
+package mdns
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	dnssrv "github.com/miekg/dns"
+	"github.com/samber/lo"
+)
+
+// probeState is the state of a name being probed.
+type probeState struct {
+	// records we intend to publish under the name
+	proposed []dnssrv.RR
+	// another host answered for the name
+	conflict bool
+	// another host probing for the name at the same time won the tiebreak
+	lost bool
+}
+
+// probe queries names to check no other host uses them, as per RFC 6762
+// section 8.1. It returns the names found in use.
+func (m *MDNS) probe(ctx context.Context, names []string, proposed []dnssrv.RR) (map[string]bool, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	m.lock.Lock()
+	for _, name := range names {
+		m.probing[name] = &probeState{
+			proposed: lo.Filter(proposed, func(rr dnssrv.RR, _ int) bool { return sameName(rr.Header().Name, name) }),
+		}
+	}
+	m.lock.Unlock()
+
+	defer func() {
+		m.lock.Lock()
+		for _, name := range names {
+			delete(m.probing, name)
+		}
+		m.lock.Unlock()
+	}()
+
+	conflicts := map[string]bool{}
+
+	for tiebreaks := 0; len(names) > 0; tiebreaks++ {
+		err := m.sendProbes(ctx, names)
+		if err != nil {
+			return nil, err
+		}
+
+		lost := []string{}
+
+		m.lock.Lock()
+		for _, name := range names {
+			st := m.probing[name]
+
+			switch {
+			case st.conflict:
+				conflicts[name] = true
+			case st.lost && tiebreaks < maxTiebreaks:
+				st.lost = false
+				lost = append(lost, name)
+			case st.lost:
+				conflicts[name] = true
+			}
+		}
+		m.lock.Unlock()
+
+		names = lost
+		if len(names) == 0 {
+			break
+		}
+
+		m.log.Debug("lost simultaneous probe tiebreak, probing again", "names", names)
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(tiebreakDelay):
+		}
+	}
+
+	return conflicts, nil
+}
+
+func (m *MDNS) sendProbes(ctx context.Context, names []string) error {
+	for _, chunk := range lo.Chunk(names, maxRecordsPerMsg) {
+		msg := new(dnssrv.Msg)
+
+		m.lock.Lock()
+		for _, name := range chunk {
+			msg.Question = append(msg.Question, dnssrv.Question{
+				Name:   name,
+				Qtype:  dnssrv.TypeANY,
+				Qclass: dnssrv.ClassINET | classTopBit,
+			})
+
+			// proposed records allow simultaneous probes to be resolved
+			msg.Ns = append(msg.Ns, m.probing[name].proposed...)
+		}
+		m.lock.Unlock()
+
+		for range probeCount {
+			m.send(msg)
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(probeInterval):
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkConflicts flags names being probed that another host answers for.
+func (m *MDNS) checkConflicts(res *dnssrv.Msg) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if len(m.probing) == 0 {
+		return
+	}
+
+	for _, rr := range append(res.Answer, res.Extra...) {
+		st, ok := m.probing[strings.ToLower(rr.Header().Name)]
+		if ok && !shared(rr) {
+			st.conflict = true
+		}
+	}
+}
+
+// checkTiebreaks flags names being probed that another host probes at the
+// same time with records winning the tiebreak, as per RFC 6762 section 8.2.
+func (m *MDNS) checkTiebreaks(req *dnssrv.Msg) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if len(m.probing) == 0 {
+		return
+	}
+
+	for _, q := range req.Question {
+		st, ok := m.probing[strings.ToLower(q.Name)]
+		if !ok {
+			continue
+		}
+
+		theirs := lo.Filter(req.Ns, func(rr dnssrv.RR, _ int) bool { return sameName(rr.Header().Name, q.Name) })
+		if len(theirs) > 0 && tiebreak(st.proposed, theirs) < 0 {
+			st.lost = true
+		}
+	}
+}
+
+// tiebreak compares the records proposed by two hosts probing for the same
+// name. It returns a positive number if ours win, a negative number if
+// theirs win, or zero when they are identical, which is not a conflict.
+// Records are sorted and compared by class, type and rdata, the first
+// difference decides and a longer list wins over its prefix.
+func tiebreak(ours []dnssrv.RR, theirs []dnssrv.RR) int {
+	a := sortedForTiebreak(ours)
+	b := sortedForTiebreak(theirs)
+
+	for i := range min(len(a), len(b)) {
+		if c := compareForTiebreak(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+
+	return cmp.Compare(len(a), len(b))
+}
+
+func sortedForTiebreak(rrs []dnssrv.RR) []dnssrv.RR {
+	rrs = slices.Clone(rrs)
+	slices.SortFunc(rrs, compareForTiebreak)
+	return rrs
+}
+
+func compareForTiebreak(a dnssrv.RR, b dnssrv.RR) int {
+	ha, hb := a.Header(), b.Header()
+
+	return cmp.Or(
+		cmp.Compare(ha.Class&^classTopBit, hb.Class&^classTopBit),
+		cmp.Compare(ha.Rrtype, hb.Rrtype),
+		bytes.Compare(rdata(a), rdata(b)),
+	)
+}
+
+// rdata returns the uncompressed wire format rdata of rr.
+func rdata(rr dnssrv.RR) []byte {
+	// packing sets the rdata length on the header
+	rr = dnssrv.Copy(rr)
+	buf := make([]byte, dnssrv.Len(rr)+1)
+
+	off, err := dnssrv.PackRR(rr, buf, 0, nil, false)
+	if err != nil {
+		return nil
+	}
+
+	return buf[off-int(rr.Header().Rdlength) : off]
+}
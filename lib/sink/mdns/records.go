@@ -0,0 +1,140 @@
+package mdns
+
+import (
+	"net"
+	"strings"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	dnssrv "github.com/miekg/dns"
+)
+
+const (
+	// RFC 6762 section 10
+	hostTTL  = 120
+	otherTTL = 4500
+
+	localDomain    = "local."
+	servicesDomain = "_services._dns-sd._udp.local."
+)
+
+// rename returns the name rec should be published under, or false if it
+// falls outside of what mDNS answers for.
+func (m *MDNS) rename(name string) (string, bool) {
+	name = strings.ToLower(dnssrv.CanonicalName(name))
+
+	for _, domain := range m.cfg.Rename {
+		domain = strings.ToLower(dnssrv.CanonicalName(domain))
+		if dnssrv.IsSubDomain(domain, name) && name != domain {
+			name = strings.TrimSuffix(name, domain) + localDomain
+			break
+		}
+	}
+
+	for _, domain := range []string{localDomain, "in-addr.arpa.", "ip6.arpa."} {
+		if dnssrv.IsSubDomain(domain, name) && name != domain {
+			return name, true
+		}
+	}
+
+	return "", false
+}
+
+// resourceRecords converts recs into the resource records to publish. SRV records
+// named "_service._proto.instance" are published as DNS-SD service
+// instances.
+func (m *MDNS) resourceRecords(recs []dns.Record) []dnssrv.RR {
+	rrs := []dnssrv.RR{}
+
+	add := func(rr dnssrv.RR) {
+		for _, e := range rrs {
+			if dnssrv.IsDuplicate(e, rr) {
+				return
+			}
+		}
+
+		rrs = append(rrs, rr)
+	}
+
+	hdr := func(name string, t uint16, ttl uint32) dnssrv.RR_Header {
+		return dnssrv.RR_Header{Name: name, Rrtype: t, Class: dnssrv.ClassINET, Ttl: ttl}
+	}
+
+	for _, rec := range recs {
+		name, ok := m.rename(rec.Name)
+		if !ok {
+			continue
+		}
+
+		switch rec.Type {
+		case dns.A:
+			if !rec.Address.Is4() {
+				continue
+			}
+			add(&dnssrv.A{Hdr: hdr(name, dnssrv.TypeA, hostTTL), A: net.IP(rec.Address.AsSlice())})
+
+		case dns.AAAA:
+			if !rec.Address.Is6() {
+				continue
+			}
+			add(&dnssrv.AAAA{Hdr: hdr(name, dnssrv.TypeAAAA, hostTTL), AAAA: net.IP(rec.Address.AsSlice())})
+
+		case dns.PTR:
+			target, ok := m.rename(rec.Ptr)
+			if !ok {
+				continue
+			}
+			add(&dnssrv.PTR{Hdr: hdr(name, dnssrv.TypePTR, hostTTL), Ptr: target})
+
+		case dns.CNAME:
+			target, ok := m.rename(rec.Target)
+			if !ok {
+				continue
+			}
+			add(&dnssrv.CNAME{Hdr: hdr(name, dnssrv.TypeCNAME, hostTTL), Target: target})
+
+		case dns.SRV:
+			labels := dnssrv.SplitDomainName(name)
+			if len(labels) < 4 || !strings.HasPrefix(labels[0], "_") || !strings.HasPrefix(labels[1], "_") {
+				continue
+			}
+
+			target, ok := m.rename(rec.Target)
+			if !ok {
+				continue
+			}
+
+			service := labels[0] + "." + labels[1]
+			serviceName := service + "." + localDomain
+			instance := labels[2] + "." + serviceName
+
+			txt := m.cfg.TXT[service]
+			if len(txt) == 0 {
+				// a TXT record is required, RFC 6763 section 6
+				txt = []string{""}
+			}
+
+			add(&dnssrv.SRV{
+				Hdr:      hdr(instance, dnssrv.TypeSRV, hostTTL),
+				Priority: rec.Priority,
+				Weight:   rec.Weight,
+				Port:     rec.Port,
+				Target:   target,
+			})
+			add(&dnssrv.TXT{Hdr: hdr(instance, dnssrv.TypeTXT, otherTTL), Txt: txt})
+			add(&dnssrv.PTR{Hdr: hdr(serviceName, dnssrv.TypePTR, otherTTL), Ptr: instance})
+			add(&dnssrv.PTR{Hdr: hdr(servicesDomain, dnssrv.TypePTR, otherTTL), Ptr: serviceName})
+		}
+	}
+
+	return rrs
+}
+
+// shared reports whether other hosts may publish records with the same name
+// and type, which is the case for DNS-SD service enumeration.
+func shared(rr dnssrv.RR) bool {
+	return rr.Header().Rrtype == dnssrv.TypePTR && strings.HasPrefix(rr.Header().Name, "_")
+}
+
+func sameName(a, b string) bool {
+	return strings.EqualFold(dnssrv.CanonicalName(a), dnssrv.CanonicalName(b))
+}
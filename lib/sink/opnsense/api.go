@@ -0,0 +1,139 @@
+package opnsense
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ShimmerGlass/shimdns/lib/rest"
+)
+
+type hostOverride struct {
+	UUID        string `json:"uuid,omitempty"`
+	Enabled     string `json:"enabled"`
+	Hostname    string `json:"hostname"`
+	Domain      string `json:"domain"`
+	RR          string `json:"rr"`
+	Server      string `json:"server"`
+	MXPrio      string `json:"mxprio"`
+	MX          string `json:"mx"`
+	Description string `json:"description"`
+}
+
+type hostAlias struct {
+	UUID string `json:"uuid,omitempty"`
+	// uuid of the override when set, search results hold its name
+	Host        string `json:"host"`
+	Enabled     string `json:"enabled"`
+	Hostname    string `json:"hostname"`
+	Domain      string `json:"domain"`
+	Description string `json:"description"`
+}
+
+type searchRequest struct {
+	Current      int    `json:"current"`
+	RowCount     int    `json:"rowCount"`
+	SearchPhrase string `json:"searchPhrase"`
+}
+
+type searchResponse[T any] struct {
+	Rows []T `json:"rows"`
+}
+
+type resultResponse struct {
+	Result string `json:"result"`
+	Status string `json:"status"`
+	UUID   string `json:"uuid"`
+}
+
+type api struct {
+	url    string
+	key    string
+	secret string
+}
+
+func newAPI(url string, key string, secret string) *api {
+	return &api{
+		url:    url,
+		key:    key,
+		secret: secret,
+	}
+}
+
+func (a *api) request(path string) rest.Request {
+	return rest.Request{
+		URL:  a.url,
+		Path: path,
+
+		BasicUser: a.key,
+		BasicPass: a.secret,
+	}
+}
+
+func (a *api) Overrides(ctx context.Context) ([]hostOverride, error) {
+	res, err := rest.Post[searchResponse[hostOverride]](ctx, searchRequest{Current: 1, RowCount: -1}, a.request("/api/unbound/settings/searchHostOverride"))
+	if err != nil {
+		return nil, err
+	}
+
+	for i, o := range res.Rows {
+		// search results describe the type, e.g. "A (IPv4 address)"
+		if fields := strings.Fields(o.RR); len(fields) > 0 {
+			res.Rows[i].RR = fields[0]
+		}
+	}
+
+	return res.Rows, nil
+}
+
+func (a *api) AddOverride(ctx context.Context, o hostOverride) error {
+	return a.result(ctx, "/api/unbound/settings/addHostOverride", map[string]hostOverride{"host": o}, "saved")
+}
+
+func (a *api) DeleteOverride(ctx context.Context, uuid string) error {
+	return a.result(ctx, "/api/unbound/settings/delHostOverride/"+uuid, struct{}{}, "deleted")
+}
+
+func (a *api) Aliases(ctx context.Context) ([]hostAlias, error) {
+	res, err := rest.Post[searchResponse[hostAlias]](ctx, searchRequest{Current: 1, RowCount: -1}, a.request("/api/unbound/settings/searchHostAlias"))
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Rows, nil
+}
+
+func (a *api) AddAlias(ctx context.Context, al hostAlias) error {
+	return a.result(ctx, "/api/unbound/settings/addHostAlias", map[string]hostAlias{"alias": al}, "saved")
+}
+
+func (a *api) DeleteAlias(ctx context.Context, uuid string) error {
+	return a.result(ctx, "/api/unbound/settings/delHostAlias/"+uuid, struct{}{}, "deleted")
+}
+
+// Reconfigure applies the saved configuration to the running Unbound.
+func (a *api) Reconfigure(ctx context.Context) error {
+	res, err := rest.Post[resultResponse](ctx, struct{}{}, a.request("/api/unbound/service/reconfigure"))
+	if err != nil {
+		return err
+	}
+
+	if res.Status != "ok" {
+		return fmt.Errorf("reconfigure: unexpected status %q", res.Status)
+	}
+
+	return nil
+}
+
+func (a *api) result(ctx context.Context, path string, body any, want string) error {
+	res, err := rest.Post[resultResponse](ctx, body, a.request(path))
+	if err != nil {
+		return err
+	}
+
+	if res.Result != want {
+		return fmt.Errorf("%s: unexpected result %q", path, res.Result)
+	}
+
+	return nil
+}
@@ -0,0 +1,16 @@
+package opnsense
+
+import "github.com/ShimmerGlass/shimdns/lib/exp"
+
+const defaultDescription = "managed by shimdns"
+
+type Config struct {
+	URL    string `yaml:"url"`
+	Key    string `yaml:"key"`
+	Secret string `yaml:"secret"`
+
+	// overrides and aliases are owned when they carry this description
+	Description string `yaml:"description"`
+
+	Filter exp.Filter `yaml:"filter"`
+}
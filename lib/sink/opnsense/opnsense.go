@@ -0,0 +1,327 @@
+package opnsense
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	"github.com/samber/lo"
+)
+
+type OPNsense struct {
+	log *slog.Logger
+	cfg Config
+	api *api
+}
+
+// alias is a desired CNAME, pointing to the override of target.
+type alias struct {
+	hostname string
+	domain   string
+	target   string
+}
+
+func New(log *slog.Logger, cfg Config) (*OPNsense, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("missing url")
+	}
+
+	if cfg.Description == "" {
+		cfg.Description = defaultDescription
+	}
+
+	return &OPNsense{
+		log: log.With("sink", "opnsense"),
+		cfg: cfg,
+		api: newAPI(cfg.URL, cfg.Key, cfg.Secret),
+	}, nil
+}
+
+func (o *OPNsense) Write(ctx context.Context, records []dns.Record) error {
+	err := o.write(ctx, records)
+	if err != nil {
+		return fmt.Errorf("opnsense sink: %w", err)
+	}
+
+	return nil
+}
+
+func (o *OPNsense) write(ctx context.Context, records []dns.Record) error {
+	records, err := o.cfg.Filter.Filter(records)
+	if err != nil {
+		return err
+	}
+
+	overrides, aliases := o.desired(records)
+
+	changed, err := o.sync(ctx, overrides, aliases)
+	if err != nil {
+		return err
+	}
+
+	if changed {
+		o.log.Info("applying configuration")
+
+		err := o.api.Reconfigure(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// desired returns the overrides and aliases records translate to.
+func (o *OPNsense) desired(records []dns.Record) ([]hostOverride, []alias) {
+	overrides := []hostOverride{}
+	aliases := []alias{}
+
+	for _, rec := range records {
+		hostname, domain, ok := splitName(rec.Name)
+		if !ok {
+			continue
+		}
+
+		switch rec.Type {
+		case dns.A, dns.AAAA:
+			overrides = append(overrides, o.override(hostOverride{
+				Hostname: hostname,
+				Domain:   domain,
+				RR:       string(rec.Type),
+				Server:   rec.Address.String(),
+			}))
+
+		case dns.MX:
+			overrides = append(overrides, o.override(hostOverride{
+				Hostname: hostname,
+				Domain:   domain,
+				RR:       string(rec.Type),
+				MX:       normalize(rec.Mx),
+				MXPrio:   strconv.Itoa(int(rec.Preference)),
+			}))
+
+		case dns.CNAME:
+			aliases = append(aliases, alias{hostname: hostname, domain: domain, target: normalize(rec.Target)})
+		}
+	}
+
+	return lo.Uniq(overrides), lo.Uniq(aliases)
+}
+
+// changes holds what sync applies before adding aliases, in order.
+type changes struct {
+	deleteAliases   []hostAlias
+	deleteOverrides []hostOverride
+	addOverrides    []hostOverride
+}
+
+// changes returns the changes turning the current overrides and aliases into
+// the desired ones.
+func (o *OPNsense) changes(currentOverrides []hostOverride, currentAliases []hostAlias, overrides []hostOverride, aliases []alias) changes {
+	res := changes{}
+
+	// overrides no longer desired, they can only be deleted once no alias
+	// references them
+	for _, cur := range currentOverrides {
+		if cur.Description == o.cfg.Description && !lo.Contains(overrides, managedFields(cur)) {
+			res.deleteOverrides = append(res.deleteOverrides, cur)
+		}
+	}
+
+	for _, a := range currentAliases {
+		if a.Description != o.cfg.Description {
+			continue
+		}
+
+		// aliases of a replaced override are recreated on its successor
+		if !references(a, res.deleteOverrides) && lo.ContainsBy(aliases, func(want alias) bool { return o.aliasMatches(a, want, currentOverrides) }) {
+			continue
+		}
+
+		res.deleteAliases = append(res.deleteAliases, a)
+	}
+
+	for _, want := range overrides {
+		if !lo.ContainsBy(currentOverrides, func(cur hostOverride) bool { return managedFields(cur) == want }) {
+			res.addOverrides = append(res.addOverrides, want)
+		}
+	}
+
+	return res
+}
+
+// newAliases returns the aliases to add once the overrides are up to date.
+// Aliases whose target has no override are not published.
+func (o *OPNsense) newAliases(currentAliases []hostAlias, overrides []hostOverride, aliases []alias) []hostAlias {
+	var res []hostAlias
+
+	for _, want := range aliases {
+		if lo.ContainsBy(currentAliases, func(a hostAlias) bool {
+			return a.Description == o.cfg.Description && o.aliasMatches(a, want, overrides)
+		}) {
+			continue
+		}
+
+		target, ok := lo.Find(overrides, func(cur hostOverride) bool {
+			return (cur.RR == string(dns.A) || cur.RR == string(dns.AAAA)) && fullName(cur.Hostname, cur.Domain) == want.target
+		})
+		if !ok {
+			o.log.Warn("alias target has no A or AAAA override, record not published", "hostname", want.hostname, "domain", want.domain, "target", want.target)
+			continue
+		}
+
+		res = append(res, hostAlias{
+			Host:        target.UUID,
+			Enabled:     "1",
+			Hostname:    want.hostname,
+			Domain:      want.domain,
+			Description: o.cfg.Description,
+		})
+	}
+
+	return res
+}
+
+// sync updates the overrides and aliases and returns whether anything
+// changed.
+func (o *OPNsense) sync(ctx context.Context, overrides []hostOverride, aliases []alias) (bool, error) {
+	changed := false
+
+	currentOverrides, err := o.api.Overrides(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	currentAliases, err := o.api.Aliases(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	c := o.changes(currentOverrides, currentAliases, overrides, aliases)
+
+	for _, a := range c.deleteAliases {
+		o.log.Info("removing alias", "hostname", a.Hostname, "domain", a.Domain)
+
+		err := o.api.DeleteAlias(ctx, a.UUID)
+		if err != nil {
+			return changed, err
+		}
+		changed = true
+	}
+	currentAliases = lo.Without(currentAliases, c.deleteAliases...)
+
+	for _, cur := range c.deleteOverrides {
+		o.log.Info("removing override", "hostname", cur.Hostname, "domain", cur.Domain, "rr", cur.RR)
+
+		err := o.api.DeleteOverride(ctx, cur.UUID)
+		if err != nil {
+			return changed, err
+		}
+		changed = true
+	}
+	currentOverrides = lo.Without(currentOverrides, c.deleteOverrides...)
+
+	for _, want := range c.addOverrides {
+		o.log.Info("adding override", "hostname", want.Hostname, "domain", want.Domain, "rr", want.RR)
+
+		err := o.api.AddOverride(ctx, want)
+		if err != nil {
+			return changed, err
+		}
+		changed = true
+	}
+
+	// new overrides can be alias targets
+	if len(c.addOverrides) > 0 {
+		currentOverrides, err = o.api.Overrides(ctx)
+		if err != nil {
+			return changed, err
+		}
+	}
+
+	for _, a := range o.newAliases(currentAliases, currentOverrides, aliases) {
+		o.log.Info("adding alias", "hostname", a.Hostname, "domain", a.Domain)
+
+		err := o.api.AddAlias(ctx, a)
+		if err != nil {
+			return changed, err
+		}
+		changed = true
+	}
+
+	return changed, nil
+}
+
+// override returns h completed with the fields set on managed overrides.
+func (o *OPNsense) override(h hostOverride) hostOverride {
+	h.Enabled = "1"
+	h.Description = o.cfg.Description
+	return h
+}
+
+// managedFields returns an existing override with only the fields set by
+// the sink.
+func managedFields(h hostOverride) hostOverride {
+	res := hostOverride{
+		Enabled:     h.Enabled,
+		Hostname:    strings.ToLower(h.Hostname),
+		Domain:      strings.ToLower(h.Domain),
+		RR:          h.RR,
+		Description: h.Description,
+	}
+
+	switch h.RR {
+	case string(dns.MX):
+		res.MX = normalize(h.MX)
+		res.MXPrio = h.MXPrio
+	default:
+		res.Server = h.Server
+	}
+
+	return res
+}
+
+// aliasMatches returns whether the existing alias a is the desired alias
+// want. Search results reference the override by name, or by uuid.
+func (o *OPNsense) aliasMatches(a hostAlias, want alias, overrides []hostOverride) bool {
+	if strings.ToLower(a.Hostname) != want.hostname || strings.ToLower(a.Domain) != want.domain {
+		return false
+	}
+
+	if normalize(a.Host) == want.target {
+		return true
+	}
+
+	target, ok := lo.Find(overrides, func(cur hostOverride) bool { return cur.UUID == a.Host })
+	return ok && fullName(target.Hostname, target.Domain) == want.target
+}
+
+// references returns whether the alias a targets one of overrides. Search
+// results reference the override by name, or by uuid.
+func references(a hostAlias, overrides []hostOverride) bool {
+	return lo.ContainsBy(overrides, func(cur hostOverride) bool {
+		return cur.UUID == a.Host || fullName(cur.Hostname, cur.Domain) == normalize(a.Host)
+	})
+}
+
+// splitName returns the host and domain parts of name, or false when name
+// has a single label.
+func splitName(name string) (string, string, bool) {
+	hostname, domain, ok := strings.Cut(normalize(name), ".")
+	if !ok || domain == "" {
+		return "", "", false
+	}
+
+	return hostname, domain, true
+}
+
+func fullName(hostname string, domain string) string {
+	return normalize(hostname + "." + domain)
+}
+
+func normalize(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
@@ -0,0 +1,270 @@
+package opnsense
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/require"
+)
+
+type testCase struct {
+	Cfg              Config
+	CurrentOverrides []hostOverride
+	CurrentAliases   []hostAlias
+	Records          []dns.Record
+	Changes          changes
+	NewAliases       []hostAlias
+}
+
+var manual = hostOverride{UUID: "m1", Enabled: "1", Hostname: "manual", Domain: "lan", RR: "A", Server: "10.0.0.1"}
+
+var testCases = []testCase{
+	{
+		// single label names have no domain, aliases are only published
+		// with a target
+		Records: []dns.Record{
+			{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+			{Type: dns.A, Name: "FOO.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+			{Type: dns.AAAA, Name: "foo.lan.", Address: netip.MustParseAddr("fd00::1")},
+			{Type: dns.MX, Name: "mail.lan.", Mx: "foo.lan.", Preference: 10},
+			{Type: dns.A, Name: "lan.", Address: netip.MustParseAddr("192.168.1.2")},
+			{Type: dns.CNAME, Name: "nowhere.lan.", Target: "missing.lan."},
+		},
+		Changes: changes{addOverrides: []hostOverride{
+			{Enabled: "1", Hostname: "foo", Domain: "lan", RR: "A", Server: "192.168.1.1", Description: defaultDescription},
+			{Enabled: "1", Hostname: "foo", Domain: "lan", RR: "AAAA", Server: "fd00::1", Description: defaultDescription},
+			{Enabled: "1", Hostname: "mail", Domain: "lan", RR: "MX", MX: "foo.lan", MXPrio: "10", Description: defaultDescription},
+		}},
+	},
+	{
+		// items not created by the sink are left untouched, but can be
+		// alias targets
+		CurrentOverrides: []hostOverride{
+			manual,
+			{UUID: "m2", Enabled: "1", Hostname: "other", Domain: "lan", RR: "A", Server: "10.0.0.2", Description: "by hand"},
+		},
+		CurrentAliases: []hostAlias{
+			{UUID: "m3", Enabled: "1", Host: "manual.lan", Hostname: "www", Domain: "lan"},
+		},
+		Records: []dns.Record{
+			{Type: dns.CNAME, Name: "other.lan.", Target: "manual.lan."},
+		},
+		NewAliases: []hostAlias{
+			{Host: "m1", Enabled: "1", Hostname: "other", Domain: "lan", Description: defaultDescription},
+		},
+	},
+	{
+		// aliases go before the overrides they reference, and move to the
+		// successor of a replaced override
+		CurrentOverrides: []hostOverride{
+			manual,
+			{UUID: "s1", Enabled: "1", Hostname: "foo", Domain: "lan", RR: "A", Server: "192.168.1.1", Description: defaultDescription},
+			{UUID: "s2", Enabled: "1", Hostname: "bar", Domain: "lan", RR: "A", Server: "192.168.1.2", Description: defaultDescription},
+		},
+		CurrentAliases: []hostAlias{
+			{UUID: "s3", Enabled: "1", Host: "foo.lan", Hostname: "www", Domain: "lan", Description: defaultDescription},
+			{UUID: "s4", Enabled: "1", Host: "bar.lan", Hostname: "db", Domain: "lan", Description: defaultDescription},
+			{UUID: "s5", Enabled: "1", Host: "manual.lan", Hostname: "ext", Domain: "lan", Description: defaultDescription},
+		},
+		Records: []dns.Record{
+			{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.3")},
+			{Type: dns.CNAME, Name: "www.lan.", Target: "foo.lan."},
+			{Type: dns.CNAME, Name: "ext.lan.", Target: "manual.lan."},
+		},
+		Changes: changes{
+			deleteAliases: []hostAlias{
+				{UUID: "s3", Enabled: "1", Host: "foo.lan", Hostname: "www", Domain: "lan", Description: defaultDescription},
+				{UUID: "s4", Enabled: "1", Host: "bar.lan", Hostname: "db", Domain: "lan", Description: defaultDescription},
+			},
+			deleteOverrides: []hostOverride{
+				{UUID: "s1", Enabled: "1", Hostname: "foo", Domain: "lan", RR: "A", Server: "192.168.1.1", Description: defaultDescription},
+				{UUID: "s2", Enabled: "1", Hostname: "bar", Domain: "lan", RR: "A", Server: "192.168.1.2", Description: defaultDescription},
+			},
+			addOverrides: []hostOverride{
+				{Enabled: "1", Hostname: "foo", Domain: "lan", RR: "A", Server: "192.168.1.3", Description: defaultDescription},
+			},
+		},
+	},
+	{
+		// ownership is decided by the description
+		Cfg: Config{Description: "shimdns-1"},
+		CurrentOverrides: []hostOverride{
+			{UUID: "m1", Enabled: "1", Hostname: "default", Domain: "lan", RR: "A", Server: "10.0.0.1", Description: defaultDescription},
+			{UUID: "s1", Enabled: "1", Hostname: "stale", Domain: "lan", RR: "A", Server: "10.0.0.2", Description: "shimdns-1"},
+		},
+		Records: []dns.Record{
+			{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+		},
+		Changes: changes{
+			deleteOverrides: []hostOverride{
+				{UUID: "s1", Enabled: "1", Hostname: "stale", Domain: "lan", RR: "A", Server: "10.0.0.2", Description: "shimdns-1"},
+			},
+			addOverrides: []hostOverride{
+				{Enabled: "1", Hostname: "foo", Domain: "lan", RR: "A", Server: "192.168.1.1", Description: "shimdns-1"},
+			},
+		},
+	},
+	{
+		// unchanged, search results reference alias targets by name
+		CurrentOverrides: []hostOverride{
+			{UUID: "s1", Enabled: "1", Hostname: "foo", Domain: "lan", RR: "A", Server: "192.168.1.1", Description: defaultDescription},
+			{UUID: "s2", Enabled: "1", Hostname: "Mail", Domain: "lan", RR: "MX", MX: "foo.lan.", MXPrio: "10", Description: defaultDescription},
+		},
+		CurrentAliases: []hostAlias{
+			{UUID: "s3", Enabled: "1", Host: "foo.lan", Hostname: "www", Domain: "lan", Description: defaultDescription},
+		},
+		Records: []dns.Record{
+			{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+			{Type: dns.MX, Name: "mail.lan.", Mx: "foo.lan.", Preference: 10},
+			{Type: dns.CNAME, Name: "www.lan.", Target: "foo.lan."},
+		},
+	},
+}
+
+func TestChanges(t *testing.T) {
+	for i, tc := range testCases {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			tc.Cfg.URL = "http://opnsense"
+
+			o, err := New(slog.Default(), tc.Cfg)
+			require.NoError(t, err)
+
+			overrides, aliases := o.desired(tc.Records)
+
+			c := o.changes(tc.CurrentOverrides, tc.CurrentAliases, overrides, aliases)
+			require.Equal(t, tc.Changes, c)
+
+			newAliases := o.newAliases(
+				lo.Without(tc.CurrentAliases, c.deleteAliases...),
+				lo.Without(tc.CurrentOverrides, c.deleteOverrides...),
+				aliases,
+			)
+			require.Equal(t, tc.NewAliases, newAliases)
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	overrides := []hostOverride{}
+	aliases := []hostAlias{}
+	nextID := 0
+	requests := []string{}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, secret, ok := r.BasicAuth()
+		if !ok || key != "key" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"status": 401, "message": "Authentication Failed"}`))
+			return
+		}
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			_ = json.NewEncoder(w).Encode(resultResponse{Result: "failed"})
+			return
+		}
+
+		action := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/api/unbound/"), "settings/")
+		action, id, _ := strings.Cut(action, "/")
+		requests = append(requests, action)
+
+		result := resultResponse{}
+		switch action {
+		case "searchHostOverride":
+			// search results describe the record type
+			rows := lo.Map(overrides, func(o hostOverride, _ int) hostOverride {
+				o.RR += " (record)"
+				return o
+			})
+			_ = json.NewEncoder(w).Encode(searchResponse[hostOverride]{Rows: rows})
+			return
+
+		case "searchHostAlias":
+			// search results reference the override by name
+			rows := lo.Map(aliases, func(a hostAlias, _ int) hostAlias {
+				o, _ := lo.Find(overrides, func(o hostOverride) bool { return o.UUID == a.Host })
+				a.Host = o.Hostname + "." + o.Domain
+				return a
+			})
+			_ = json.NewEncoder(w).Encode(searchResponse[hostAlias]{Rows: rows})
+			return
+
+		case "addHostOverride":
+			body := map[string]hostOverride{}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			if o, ok := body["host"]; ok && o.Domain != "" {
+				nextID++
+				o.UUID = fmt.Sprint("o", nextID)
+				overrides = append(overrides, o)
+				result.Result = "saved"
+			}
+
+		case "addHostAlias":
+			body := map[string]hostAlias{}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			a, ok := body["alias"]
+			if ok && lo.ContainsBy(overrides, func(o hostOverride) bool { return o.UUID == a.Host }) {
+				nextID++
+				a.UUID = fmt.Sprint("a", nextID)
+				aliases = append(aliases, a)
+				result.Result = "saved"
+			}
+
+		case "delHostOverride":
+			// aliases reference their override
+			if !lo.ContainsBy(aliases, func(a hostAlias) bool { return a.Host == id }) {
+				overrides = lo.Reject(overrides, func(o hostOverride, _ int) bool { return o.UUID == id })
+				result.Result = "deleted"
+			}
+
+		case "delHostAlias":
+			aliases = lo.Reject(aliases, func(a hostAlias, _ int) bool { return a.UUID == id })
+			result.Result = "deleted"
+
+		case "service":
+			result.Status = "ok"
+		}
+
+		_ = json.NewEncoder(w).Encode(result)
+	}))
+	defer srv.Close()
+
+	o, err := New(slog.Default(), Config{URL: srv.URL, Key: "key", Secret: "secret"})
+	require.NoError(t, err)
+
+	require.NoError(t, o.Write(context.Background(), []dns.Record{
+		{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+		{Type: dns.CNAME, Name: "www.lan.", Target: "foo.lan."},
+	}))
+
+	// the alias moves to the new override before the old one goes
+	recs := []dns.Record{
+		{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.2")},
+		{Type: dns.CNAME, Name: "www.lan.", Target: "foo.lan."},
+	}
+	require.NoError(t, o.Write(context.Background(), recs))
+	require.NoError(t, o.Write(context.Background(), recs))
+
+	require.Equal(t, []string{
+		"searchHostOverride", "searchHostAlias", "addHostOverride", "searchHostOverride", "addHostAlias", "service",
+		"searchHostOverride", "searchHostAlias", "delHostAlias", "delHostOverride", "addHostOverride", "searchHostOverride", "addHostAlias", "service",
+		"searchHostOverride", "searchHostAlias",
+	}, requests)
+	require.Equal(t, []hostOverride{
+		{UUID: "o3", Enabled: "1", Hostname: "foo", Domain: "lan", RR: "A", Server: "192.168.1.2", Description: defaultDescription},
+	}, overrides)
+	require.Equal(t, []hostAlias{
+		{UUID: "a4", Enabled: "1", Host: "o3", Hostname: "www", Domain: "lan", Description: defaultDescription},
+	}, aliases)
+
+	o, err = New(slog.Default(), Config{URL: srv.URL, Key: "key", Secret: "wrong"})
+	require.NoError(t, err)
+	require.ErrorContains(t, o.Write(context.Background(), nil), "401")
+}
@@ -0,0 +1,131 @@
+package pihole
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/ShimmerGlass/shimdns/lib/rest"
+)
+
+const (
+	listHosts  = "hosts"
+	listCNAMEs = "cnameRecords"
+)
+
+type authResponse struct {
+	Session struct {
+		Valid bool   `json:"valid"`
+		SID   string `json:"sid"`
+	} `json:"session"`
+}
+
+type configResponse struct {
+	Config struct {
+		DNS map[string][]string `json:"dns"`
+	} `json:"config"`
+}
+
+type api struct {
+	url      string
+	password string
+
+	lock sync.Mutex
+	sid  string
+}
+
+func newAPI(url string, password string) *api {
+	return &api{
+		url:      url,
+		password: password,
+	}
+}
+
+// List returns the entries of a local DNS list, either listHosts
+// ("address name") or listCNAMEs ("name,target").
+func (a *api) List(ctx context.Context, list string) ([]string, error) {
+	res, err := authed(ctx, a, func(req rest.Request) (configResponse, error) {
+		req.Path = "/api/config/dns/" + list
+		return rest.Get[configResponse](ctx, req)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Config.DNS[list], nil
+}
+
+func (a *api) Add(ctx context.Context, list string, e string) error {
+	_, err := authed(ctx, a, func(req rest.Request) (any, error) {
+		req.Path = fmt.Sprintf("/api/config/dns/%s/%s", list, e)
+		return rest.Put[any](ctx, nil, req)
+	})
+	return err
+}
+
+func (a *api) Delete(ctx context.Context, list string, e string) error {
+	_, err := authed(ctx, a, func(req rest.Request) (any, error) {
+		req.Path = fmt.Sprintf("/api/config/dns/%s/%s", list, e)
+		req.ExpectEmptyResponse = true
+		return rest.Delete[any](ctx, nil, req)
+	})
+	return err
+}
+
+// authed runs fn with a session, logging in first when there is none or
+// when the current one expired.
+func authed[T any](ctx context.Context, a *api, fn func(rest.Request) (T, error)) (T, error) {
+	sid, err := a.session(ctx, false)
+	if err != nil {
+		var z T
+		return z, err
+	}
+
+	res, err := fn(a.request(sid))
+
+	statusErr := &rest.StatusError{}
+	if errors.As(err, &statusErr) && statusErr.Code == http.StatusUnauthorized {
+		sid, err = a.session(ctx, true)
+		if err != nil {
+			return res, err
+		}
+
+		return fn(a.request(sid))
+	}
+
+	return res, err
+}
+
+func (a *api) request(sid string) rest.Request {
+	return rest.Request{
+		URL:     a.url,
+		Headers: map[string]string{"X-FTL-SID": sid},
+	}
+}
+
+func (a *api) session(ctx context.Context, renew bool) (string, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.sid != "" && !renew {
+		return a.sid, nil
+	}
+
+	res, err := rest.Post[authResponse](ctx, map[string]string{"password": a.password}, rest.Request{
+		URL:  a.url,
+		Path: "/api/auth",
+	})
+	if err != nil {
+		return "", fmt.Errorf("auth: %w", err)
+	}
+
+	if !res.Session.Valid {
+		return "", fmt.Errorf("auth: invalid session")
+	}
+
+	a.sid = res.Session.SID
+
+	return a.sid, nil
+}
@@ -0,0 +1,14 @@
+package pihole
+
+import "github.com/ShimmerGlass/shimdns/lib/exp"
+
+type Config struct {
+	URL      string `yaml:"url"`
+	Password string `yaml:"password"`
+
+	// file the owned entries are kept in across restarts, required.
+	// Entries not created by shimdns are never removed.
+	StateFile string `yaml:"state_file"`
+
+	Filter exp.Filter `yaml:"filter"`
+}
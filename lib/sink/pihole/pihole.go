@@ -0,0 +1,170 @@
+package pihole
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+)
+
+type PiHole struct {
+	log *slog.Logger
+	cfg Config
+	api *api
+
+	owned map[string]struct{}
+}
+
+func New(log *slog.Logger, cfg Config) (*PiHole, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("missing url")
+	}
+
+	if cfg.StateFile == "" {
+		return nil, fmt.Errorf("missing state_file")
+	}
+
+	p := &PiHole{
+		log:   log.With("sink", "pihole"),
+		cfg:   cfg,
+		api:   newAPI(cfg.URL, cfg.Password),
+		owned: map[string]struct{}{},
+	}
+
+	err := p.loadState()
+	if err != nil {
+		return nil, fmt.Errorf("state: %w", err)
+	}
+
+	return p, nil
+}
+
+func (p *PiHole) Write(ctx context.Context, records []dns.Record) error {
+	err := p.write(ctx, records)
+	if err != nil {
+		return fmt.Errorf("pihole sink: %w", err)
+	}
+
+	return nil
+}
+
+func (p *PiHole) write(ctx context.Context, records []dns.Record) error {
+	records, err := p.cfg.Filter.Filter(records)
+	if err != nil {
+		return err
+	}
+
+	desired := entries(records)
+	changed := false
+
+	for _, list := range []string{listHosts, listCNAMEs} {
+		current, err := p.api.List(ctx, list)
+		if err != nil {
+			return err
+		}
+
+		add, remove := p.changes(list, current, desired[list])
+
+		for _, e := range remove {
+			p.log.Info("removing entry", "list", list, "entry", e)
+
+			err := p.api.Delete(ctx, list, e)
+			if err != nil {
+				return err
+			}
+
+			delete(p.owned, key(list, e))
+			changed = true
+		}
+
+		for _, e := range add {
+			p.log.Info("adding entry", "list", list, "entry", e)
+
+			err := p.api.Add(ctx, list, e)
+			if err != nil {
+				return err
+			}
+
+			p.owned[key(list, e)] = struct{}{}
+			changed = true
+		}
+
+		// forget entries removed by others
+		for k := range p.owned {
+			l, e, _ := strings.Cut(k, " ")
+			if l == list && !slices.Contains(current, e) && !slices.Contains(desired[list], e) {
+				delete(p.owned, k)
+				changed = true
+			}
+		}
+	}
+
+	if changed {
+		err := p.saveState()
+		if err != nil {
+			return fmt.Errorf("state: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// entries returns the entries of records, by list.
+func entries(records []dns.Record) map[string][]string {
+	res := map[string][]string{}
+	for _, rec := range records {
+		list, e, ok := recordToEntry(rec)
+		if !ok {
+			continue
+		}
+
+		if !slices.Contains(res[list], e) {
+			res[list] = append(res[list], e)
+		}
+	}
+
+	return res
+}
+
+// changes returns the entries to add to list and the owned ones to remove,
+// to turn current into desired.
+func (p *PiHole) changes(list string, current []string, desired []string) ([]string, []string) {
+	add := []string{}
+	remove := []string{}
+
+	for _, e := range current {
+		if _, ok := p.owned[key(list, e)]; ok && !slices.Contains(desired, e) {
+			remove = append(remove, e)
+		}
+	}
+
+	for _, e := range desired {
+		if !slices.Contains(current, e) {
+			add = append(add, e)
+		}
+	}
+
+	return add, remove
+}
+
+// recordToEntry returns the list and entry for rec, or false if Pi-hole
+// cannot express it.
+func recordToEntry(rec dns.Record) (string, string, bool) {
+	name := strings.TrimSuffix(rec.Name, ".")
+
+	switch rec.Type {
+	case dns.A, dns.AAAA:
+		return listHosts, rec.Address.String() + " " + name, true
+	case dns.CNAME:
+		return listCNAMEs, name + "," + strings.TrimSuffix(rec.Target, "."), true
+	default:
+		return "", "", false
+	}
+}
+
+func key(list string, e string) string {
+	return list + " " + e
+}
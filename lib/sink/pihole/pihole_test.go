@@ -0,0 +1,170 @@
+package pihole
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	"github.com/stretchr/testify/require"
+)
+
+type testCase struct {
+	List    string
+	Owned   []string
+	Current []string
+	Records []dns.Record
+	Add     []string
+	Remove  []string
+}
+
+var testCases = []testCase{
+	{
+		// records Pi-hole cannot express are ignored
+		List: listHosts,
+		Records: []dns.Record{
+			{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+			{Type: dns.AAAA, Name: "foo.lan.", Address: netip.MustParseAddr("fd00::1")},
+			{Type: dns.CNAME, Name: "www.lan.", Target: "foo.lan."},
+			{Type: dns.PTR, Name: "1.1.168.192.in-addr.arpa.", Ptr: "foo.lan."},
+		},
+		Add:    []string{"192.168.1.1 foo.lan", "fd00::1 foo.lan"},
+		Remove: []string{},
+	},
+	{
+		List: listCNAMEs,
+		Records: []dns.Record{
+			{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+			{Type: dns.CNAME, Name: "www.lan.", Target: "foo.lan."},
+		},
+		Add:    []string{"www.lan,foo.lan"},
+		Remove: []string{},
+	},
+	{
+		// entries not created by the sink in this list are never removed
+		List:    listHosts,
+		Owned:   []string{"hosts 192.168.1.1 foo.lan", "cnameRecords 192.168.1.3 bar.lan"},
+		Current: []string{"10.0.0.1 manual.lan", "192.168.1.1 foo.lan", "192.168.1.3 bar.lan"},
+		Records: []dns.Record{
+			{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.2")},
+			{Type: dns.A, Name: "manual.lan.", Address: netip.MustParseAddr("10.0.0.1")},
+		},
+		Add:    []string{"192.168.1.2 foo.lan"},
+		Remove: []string{"192.168.1.1 foo.lan"},
+	},
+}
+
+func TestChanges(t *testing.T) {
+	for i, tc := range testCases {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			p, err := New(slog.Default(), Config{URL: "http://pihole", StateFile: filepath.Join(t.TempDir(), "state.json")})
+			require.NoError(t, err)
+
+			for _, k := range tc.Owned {
+				p.owned[k] = struct{}{}
+			}
+
+			add, remove := p.changes(tc.List, tc.Current, entries(tc.Records)[tc.List])
+			require.Equal(t, tc.Add, add)
+			require.Equal(t, tc.Remove, remove)
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	lists := map[string][]string{listHosts: {"10.0.0.1 manual.lan"}}
+	sid := ""
+	logins := 0
+	requests := []string{}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/auth" {
+			body := map[string]string{}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			if r.Method != http.MethodPost || body["password"] != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			logins++
+			sid = fmt.Sprint("sid", logins)
+
+			res := authResponse{}
+			res.Session.Valid = true
+			res.Session.SID = sid
+			_ = json.NewEncoder(w).Encode(res)
+			return
+		}
+
+		if r.Header.Get("X-FTL-SID") != sid {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		list, entry, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/config/dns/"), "/")
+
+		switch r.Method {
+		case http.MethodGet:
+			res := configResponse{}
+			res.Config.DNS = map[string][]string{list: lists[list]}
+			_ = json.NewEncoder(w).Encode(res)
+			return
+		case http.MethodPut:
+			lists[list] = append(lists[list], entry)
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"took": 0.001}`))
+		case http.MethodDelete:
+			lists[list] = slices.DeleteFunc(lists[list], func(e string) bool { return e == entry })
+			w.WriteHeader(http.StatusNoContent)
+		}
+
+		requests = append(requests, r.Method+" "+r.URL.Path)
+	}))
+	defer srv.Close()
+
+	cfg := Config{URL: srv.URL, Password: "secret", StateFile: filepath.Join(t.TempDir(), "state.json")}
+
+	p, err := New(slog.Default(), cfg)
+	require.NoError(t, err)
+
+	recs := []dns.Record{
+		{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+		{Type: dns.CNAME, Name: "www.lan.", Target: "foo.lan."},
+	}
+	require.NoError(t, p.Write(context.Background(), recs))
+
+	// expired sessions are renewed
+	sid = "expired"
+	require.NoError(t, p.Write(context.Background(), recs[:1]))
+
+	// ownership is kept across restarts
+	p, err = New(slog.Default(), cfg)
+	require.NoError(t, err)
+	require.NoError(t, p.Write(context.Background(), nil))
+
+	require.Equal(t, []string{
+		"PUT /api/config/dns/hosts/192.168.1.1 foo.lan",
+		"PUT /api/config/dns/cnameRecords/www.lan,foo.lan",
+		"DELETE /api/config/dns/cnameRecords/www.lan,foo.lan",
+		"DELETE /api/config/dns/hosts/192.168.1.1 foo.lan",
+	}, requests)
+	require.Equal(t, []string{"10.0.0.1 manual.lan"}, lists[listHosts])
+	require.Equal(t, 3, logins)
+
+	p, err = New(slog.Default(), Config{URL: srv.URL, Password: "wrong", StateFile: cfg.StateFile})
+	require.NoError(t, err)
+	require.ErrorContains(t, p.Write(context.Background(), nil), "401")
+}
+
+func TestStateFileRequired(t *testing.T) {
+	_, err := New(slog.Default(), Config{URL: "http://127.0.0.1"})
+	require.ErrorContains(t, err, "state_file")
+}
@@ -0,0 +1,25 @@
+package pihole
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/ShimmerGlass/shimdns/lib/statefile"
+)
+
+func (p *PiHole) loadState() error {
+	keys, err := statefile.Load[string](p.cfg.StateFile)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range keys {
+		p.owned[k] = struct{}{}
+	}
+
+	return nil
+}
+
+func (p *PiHole) saveState() error {
+	return statefile.Save(p.cfg.StateFile, slices.Sorted(maps.Keys(p.owned)))
+}
@@ -0,0 +1,92 @@
+package powerdns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/ShimmerGlass/shimdns/lib/rest"
+)
+
+const (
+	changeReplace = "REPLACE"
+	changeDelete  = "DELETE"
+)
+
+type zone struct {
+	ID          string   `json:"id,omitempty"`
+	Name        string   `json:"name"`
+	Kind        string   `json:"kind,omitempty"`
+	Nameservers []string `json:"nameservers,omitempty"`
+	RRsets      []rrset  `json:"rrsets"`
+}
+
+type rrset struct {
+	Name       string    `json:"name"`
+	Type       string    `json:"type"`
+	TTL        uint32    `json:"ttl,omitempty"`
+	ChangeType string    `json:"changetype,omitempty"`
+	Records    []record  `json:"records"`
+	Comments   []comment `json:"comments"`
+}
+
+type record struct {
+	Content  string `json:"content"`
+	Disabled bool   `json:"disabled"`
+}
+
+type comment struct {
+	Content string `json:"content"`
+	Account string `json:"account"`
+}
+
+type api struct {
+	url      string
+	key      string
+	serverID string
+}
+
+func newAPI(url string, key string, serverID string) *api {
+	return &api{
+		url:      url,
+		key:      key,
+		serverID: serverID,
+	}
+}
+
+func (a *api) request(path string) rest.Request {
+	return rest.Request{
+		URL:     a.url,
+		Path:    fmt.Sprintf("/api/v1/servers/%s/zones%s", a.serverID, path),
+		Headers: map[string]string{"X-API-Key": a.key},
+	}
+}
+
+// Zone returns the zone with its RRsets, or false if it does not exist.
+func (a *api) Zone(ctx context.Context, name string) (zone, bool, error) {
+	z, err := rest.Get[zone](ctx, a.request("/"+name))
+
+	statusErr := &rest.StatusError{}
+	if errors.As(err, &statusErr) && (statusErr.Code == http.StatusNotFound || statusErr.Code == http.StatusUnprocessableEntity) {
+		return zone{}, false, nil
+	}
+	if err != nil {
+		return zone{}, false, err
+	}
+
+	return z, true, nil
+}
+
+func (a *api) CreateZone(ctx context.Context, z zone) error {
+	_, err := rest.Post[zone](ctx, z, a.request(""))
+	return err
+}
+
+func (a *api) PatchZone(ctx context.Context, name string, rrsets []rrset) error {
+	req := a.request("/" + name)
+	req.ExpectEmptyResponse = true
+
+	_, err := rest.Patch[any](ctx, zone{RRsets: rrsets}, req)
+	return err
+}
@@ -0,0 +1,32 @@
+package powerdns
+
+import "github.com/ShimmerGlass/shimdns/lib/exp"
+
+const (
+	defaultServerID = "localhost"
+	defaultComment  = "managed by shimdns"
+	defaultTTL      = 300
+	defaultKind     = "Native"
+)
+
+type Config struct {
+	URL      string `yaml:"url"`
+	APIKey   string `yaml:"api_key"`
+	ServerID string `yaml:"server_id"`
+
+	Zones []string `yaml:"zones"`
+	// create zones missing from the server
+	CreateZones bool `yaml:"create_zones"`
+	// kind and nameservers of created zones
+	Kind        string   `yaml:"kind"`
+	Nameservers []string `yaml:"nameservers"`
+
+	// RRsets are owned when they carry a comment with this content, or
+	// with this account when set
+	Comment string `yaml:"comment"`
+	Account string `yaml:"account"`
+
+	TTL uint32 `yaml:"ttl"`
+
+	Filter exp.Filter `yaml:"filter"`
+}
@@ -0,0 +1,258 @@
+package powerdns
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	dnssrv "github.com/miekg/dns"
+	"github.com/samber/lo"
+)
+
+type PowerDNS struct {
+	log *slog.Logger
+	cfg Config
+	api *api
+}
+
+type rrsetKey struct {
+	name  string
+	rtype string
+}
+
+func New(log *slog.Logger, cfg Config) (*PowerDNS, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("missing url")
+	}
+	if len(cfg.Zones) == 0 {
+		return nil, fmt.Errorf("missing zones")
+	}
+
+	if cfg.ServerID == "" {
+		cfg.ServerID = defaultServerID
+	}
+	if cfg.Comment == "" {
+		cfg.Comment = defaultComment
+	}
+	if cfg.TTL == 0 {
+		cfg.TTL = defaultTTL
+	}
+	if cfg.Kind == "" {
+		cfg.Kind = defaultKind
+	}
+
+	cfg.Zones = lo.Map(cfg.Zones, func(z string, _ int) string {
+		return strings.ToLower(dnssrv.CanonicalName(z))
+	})
+	cfg.Nameservers = lo.Map(cfg.Nameservers, func(ns string, _ int) string {
+		return dnssrv.CanonicalName(ns)
+	})
+
+	return &PowerDNS{
+		log: log.With("sink", "powerdns"),
+		cfg: cfg,
+		api: newAPI(cfg.URL, cfg.APIKey, cfg.ServerID),
+	}, nil
+}
+
+func (p *PowerDNS) Write(ctx context.Context, records []dns.Record) error {
+	err := p.write(ctx, records)
+	if err != nil {
+		return fmt.Errorf("powerdns sink: %w", err)
+	}
+
+	return nil
+}
+
+func (p *PowerDNS) write(ctx context.Context, records []dns.Record) error {
+	records, err := p.cfg.Filter.Filter(records)
+	if err != nil {
+		return err
+	}
+
+	byZone := p.rrsets(records)
+
+	for _, zone := range p.cfg.Zones {
+		err := p.syncZone(ctx, zone, byZone[zone])
+		if err != nil {
+			return fmt.Errorf("zone %s: %w", zone, err)
+		}
+	}
+
+	return nil
+}
+
+// rrsets groups records into RRsets, by configured zone.
+func (p *PowerDNS) rrsets(records []dns.Record) map[string]map[rrsetKey][]record {
+	byZone := map[string]map[rrsetKey][]record{}
+	for _, rec := range records {
+		zone := p.zoneFor(rec.Name)
+		if zone == "" {
+			continue
+		}
+
+		rr, ok := rec.RR(p.cfg.TTL)
+		if !ok {
+			continue
+		}
+
+		hdr := rr.Header()
+		key := rrsetKey{
+			name:  strings.ToLower(hdr.Name),
+			rtype: dnssrv.TypeToString[hdr.Rrtype],
+		}
+		content := strings.TrimPrefix(rr.String(), hdr.String())
+
+		if byZone[zone] == nil {
+			byZone[zone] = map[rrsetKey][]record{}
+		}
+		if !slices.ContainsFunc(byZone[zone][key], func(r record) bool { return r.Content == content }) {
+			byZone[zone][key] = append(byZone[zone][key], record{Content: content})
+		}
+	}
+
+	return byZone
+}
+
+func (p *PowerDNS) syncZone(ctx context.Context, name string, desired map[rrsetKey][]record) error {
+	z, ok, err := p.api.Zone(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		if !p.cfg.CreateZones {
+			return fmt.Errorf("zone does not exist")
+		}
+
+		err = p.api.CreateZone(ctx, zone{
+			Name:        name,
+			Kind:        p.cfg.Kind,
+			Nameservers: p.cfg.Nameservers,
+			RRsets:      []rrset{},
+		})
+		if err != nil {
+			return fmt.Errorf("create zone: %w", err)
+		}
+
+		p.log.Info("zone created", "zone", name)
+	}
+
+	changes := p.changes(z.RRsets, desired)
+	if len(changes) == 0 {
+		return nil
+	}
+
+	err = p.api.PatchZone(ctx, name, changes)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range changes {
+		p.log.Info("rrset updated", "zone", name, "name", c.Name, "type", c.Type, "change", c.ChangeType)
+	}
+
+	return nil
+}
+
+// changes returns the RRset changes turning the zone RRsets into desired,
+// leaving the RRsets not created by this sink untouched.
+func (p *PowerDNS) changes(rrsets []rrset, desired map[rrsetKey][]record) []rrset {
+	current := map[rrsetKey]rrset{}
+	for _, set := range rrsets {
+		current[rrsetKey{name: strings.ToLower(set.Name), rtype: set.Type}] = set
+	}
+
+	changes := []rrset{}
+
+	for key, recs := range desired {
+		existing, exists := current[key]
+		if exists && !p.owned(existing) {
+			p.log.Warn("rrset exists and is not managed by shimdns, skipping", "name", key.name, "type", key.rtype)
+			continue
+		}
+
+		if exists && existing.TTL == p.cfg.TTL && sameRecords(existing.Records, recs) {
+			continue
+		}
+
+		changes = append(changes, rrset{
+			Name:       key.name,
+			Type:       key.rtype,
+			TTL:        p.cfg.TTL,
+			ChangeType: changeReplace,
+			Records:    recs,
+			Comments:   []comment{p.comment()},
+		})
+	}
+
+	for key, set := range current {
+		if _, ok := desired[key]; ok || !p.owned(set) {
+			continue
+		}
+
+		changes = append(changes, rrset{
+			Name:       set.Name,
+			Type:       set.Type,
+			ChangeType: changeDelete,
+			Records:    []record{},
+			Comments:   []comment{},
+		})
+	}
+
+	// map iteration is random, keep requests stable
+	slices.SortFunc(changes, func(a, b rrset) int {
+		return strings.Compare(a.Name+" "+a.Type, b.Name+" "+b.Type)
+	})
+
+	return changes
+}
+
+func (p *PowerDNS) comment() comment {
+	return comment{
+		Content: p.cfg.Comment,
+		Account: p.cfg.Account,
+	}
+}
+
+// owned returns whether the RRset was created by this sink.
+func (p *PowerDNS) owned(set rrset) bool {
+	return slices.ContainsFunc(set.Comments, func(c comment) bool {
+		if p.cfg.Account != "" {
+			return c.Account == p.cfg.Account
+		}
+
+		return c.Content == p.cfg.Comment
+	})
+}
+
+// zoneFor returns the most specific configured zone containing name.
+func (p *PowerDNS) zoneFor(name string) string {
+	name = strings.ToLower(dnssrv.CanonicalName(name))
+	res := ""
+
+	for _, zone := range p.cfg.Zones {
+		if dnssrv.IsSubDomain(zone, name) && len(zone) > len(res) {
+			res = zone
+		}
+	}
+
+	return res
+}
+
+func sameRecords(a []record, b []record) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for _, r := range a {
+		if !slices.ContainsFunc(b, func(o record) bool { return o.Content == r.Content && o.Disabled == r.Disabled }) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,156 @@
+package powerdns
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	"github.com/stretchr/testify/require"
+)
+
+var managed = []comment{{Content: defaultComment}}
+
+type testCase struct {
+	Cfg     Config
+	Current []rrset
+	Records []dns.Record
+	Changes []rrset
+}
+
+var testCases = []testCase{
+	{
+		// records are grouped by name and type, outside of the zones they
+		// are ignored
+		Cfg: Config{TTL: 60},
+		Records: []dns.Record{
+			{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+			{Type: dns.A, Name: "FOO.lan.", Address: netip.MustParseAddr("192.168.1.2")},
+			{Type: dns.A, Name: "foo.other.", Address: netip.MustParseAddr("192.168.2.1")},
+			{Type: dns.MX, Name: "lan.", Mx: "mail.lan.", Preference: 10},
+		},
+		Changes: []rrset{
+			{Name: "foo.lan.", Type: "A", TTL: 60, ChangeType: changeReplace, Records: []record{{Content: "192.168.1.1"}, {Content: "192.168.1.2"}}, Comments: managed},
+			{Name: "lan.", Type: "MX", TTL: 60, ChangeType: changeReplace, Records: []record{{Content: "10 mail.lan."}}, Comments: managed},
+		},
+	},
+	{
+		// unchanged
+		Current: []rrset{
+			{Name: "foo.lan.", Type: "A", TTL: defaultTTL, Records: []record{{Content: "192.168.1.1"}}, Comments: managed},
+		},
+		Records: []dns.Record{
+			{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+		},
+		Changes: []rrset{},
+	},
+	{
+		// RRsets not created by the sink are neither replaced nor deleted
+		Current: []rrset{
+			{Name: "manual.lan.", Type: "A", TTL: 3600, Records: []record{{Content: "10.0.0.1"}}},
+			{Name: "stale.lan.", Type: "A", TTL: 300, Records: []record{{Content: "10.0.0.2"}}, Comments: managed},
+		},
+		Records: []dns.Record{
+			{Type: dns.A, Name: "manual.lan.", Address: netip.MustParseAddr("192.168.1.3")},
+		},
+		Changes: []rrset{
+			{Name: "stale.lan.", Type: "A", ChangeType: changeDelete, Records: []record{}, Comments: []comment{}},
+		},
+	},
+	{
+		// with an account, ownership ignores the comment content
+		Cfg: Config{Account: "shimdns-1"},
+		Current: []rrset{
+			{Name: "other.lan.", Type: "A", Records: []record{{Content: "10.0.0.1"}}, Comments: []comment{{Content: defaultComment, Account: "other"}}},
+			{Name: "stale.lan.", Type: "A", Records: []record{{Content: "10.0.0.2"}}, Comments: []comment{{Content: "anything", Account: "shimdns-1"}}},
+		},
+		Changes: []rrset{
+			{Name: "stale.lan.", Type: "A", ChangeType: changeDelete, Records: []record{}, Comments: []comment{}},
+		},
+	},
+}
+
+func TestChanges(t *testing.T) {
+	for i, tc := range testCases {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			tc.Cfg.URL = "http://powerdns"
+			tc.Cfg.Zones = []string{"lan"}
+
+			p, err := New(slog.Default(), tc.Cfg)
+			require.NoError(t, err)
+
+			changes := p.changes(tc.Current, p.rrsets(tc.Records)["lan."])
+			require.Equal(t, tc.Changes, changes)
+		})
+	}
+}
+
+type request struct {
+	Method string
+	Path   string
+	Body   zone
+}
+
+func TestWrite(t *testing.T) {
+	requests := []request{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-API-Key") != "secret" {
+			http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodGet && r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, `{"error": "expected a JSON body"}`, http.StatusUnsupportedMediaType)
+			return
+		}
+
+		req := request{Method: r.Method, Path: r.URL.Path}
+		_ = json.NewDecoder(r.Body).Decode(&req.Body)
+		requests = append(requests, req)
+
+		switch r.Method {
+		case http.MethodGet:
+			http.Error(w, `{"error": "Could not find domain"}`, http.StatusNotFound)
+		case http.MethodPost:
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(req.Body)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+
+	p, err := New(slog.Default(), Config{
+		URL:         srv.URL,
+		APIKey:      "secret",
+		Zones:       []string{"example.com"},
+		CreateZones: true,
+		Nameservers: []string{"ns.example.com"},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, p.Write(context.Background(), []dns.Record{
+		{Type: dns.A, Name: "www.example.com.", Address: netip.MustParseAddr("192.0.2.1")},
+	}))
+
+	require.Equal(t, []request{
+		{Method: http.MethodGet, Path: "/api/v1/servers/localhost/zones/example.com."},
+		{Method: http.MethodPost, Path: "/api/v1/servers/localhost/zones", Body: zone{
+			Name:        "example.com.",
+			Kind:        defaultKind,
+			Nameservers: []string{"ns.example.com."},
+			RRsets:      []rrset{},
+		}},
+		{Method: http.MethodPatch, Path: "/api/v1/servers/localhost/zones/example.com.", Body: zone{RRsets: []rrset{
+			{Name: "www.example.com.", Type: "A", TTL: defaultTTL, ChangeType: changeReplace, Records: []record{{Content: "192.0.2.1"}}, Comments: managed},
+		}}},
+	}, requests)
+
+	// without create_zones, missing zones are an error
+	p.cfg.CreateZones = false
+	require.ErrorContains(t, p.Write(context.Background(), nil), "zone does not exist")
+}
@@ -0,0 +1,40 @@
+package rfc2136
+
+import (
+	"time"
+
+	"github.com/ShimmerGlass/shimdns/lib/exp"
+)
+
+const (
+	diffAXFR  = "axfr"
+	diffState = "state"
+)
+
+type Config struct {
+	// primary server address, port 53 is used when not set
+	Server string   `yaml:"server"`
+	Zones  []string `yaml:"zones"`
+
+	TSIG TSIGConfig `yaml:"tsig"`
+
+	// how current zone contents are found: "state" only relies on the
+	// records previously pushed, "axfr" transfers the zones to also repair
+	// changes made by others
+	Diff string `yaml:"diff"`
+	// file the owned records are kept in across restarts, required
+	StateFile string `yaml:"state_file"`
+
+	TTL     uint32        `yaml:"ttl"`
+	Timeout time.Duration `yaml:"timeout"`
+
+	Filter exp.Filter `yaml:"filter"`
+}
+
+type TSIGConfig struct {
+	Name string `yaml:"name"`
+	// base64 encoded
+	Secret string `yaml:"secret"`
+	// hmac-sha256 when not set
+	Algorithm string `yaml:"algorithm"`
+}
@@ -0,0 +1,335 @@
+package rfc2136
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	dnssrv "github.com/miekg/dns"
+	"github.com/samber/lo"
+)
+
+const (
+	defaultTTL     = 300
+	defaultTimeout = 10 * time.Second
+
+	// records added or removed per UPDATE message
+	maxUpdateRecords = 500
+	tsigFudge        = 300
+)
+
+type RFC2136 struct {
+	log *slog.Logger
+	cfg Config
+
+	client *dnssrv.Client
+	// records pushed by us, by key
+	owned map[string]dnssrv.RR
+}
+
+func New(log *slog.Logger, cfg Config) (*RFC2136, error) {
+	if cfg.Server == "" {
+		return nil, fmt.Errorf("missing server")
+	}
+
+	if _, _, err := net.SplitHostPort(cfg.Server); err != nil {
+		cfg.Server = net.JoinHostPort(cfg.Server, "53")
+	}
+
+	if len(cfg.Zones) == 0 {
+		return nil, fmt.Errorf("missing zones")
+	}
+
+	if cfg.StateFile == "" {
+		return nil, fmt.Errorf("missing state_file")
+	}
+
+	cfg.Zones = lo.Map(cfg.Zones, func(z string, _ int) string {
+		return strings.ToLower(dnssrv.CanonicalName(z))
+	})
+
+	switch cfg.Diff {
+	case "":
+		cfg.Diff = diffState
+	case diffState, diffAXFR:
+	default:
+		return nil, fmt.Errorf("unknown diff mode %q", cfg.Diff)
+	}
+
+	if cfg.TTL == 0 {
+		cfg.TTL = defaultTTL
+	}
+
+	if cfg.Timeout == 0 {
+		cfg.Timeout = defaultTimeout
+	}
+
+	if cfg.TSIG.Name != "" {
+		cfg.TSIG.Name = dnssrv.CanonicalName(cfg.TSIG.Name)
+
+		if cfg.TSIG.Algorithm == "" {
+			cfg.TSIG.Algorithm = dnssrv.HmacSHA256
+		}
+		cfg.TSIG.Algorithm = dnssrv.CanonicalName(cfg.TSIG.Algorithm)
+	}
+
+	r := &RFC2136{
+		log: log.With("sink", "rfc2136"),
+		cfg: cfg,
+		client: &dnssrv.Client{
+			Net:        "tcp",
+			Timeout:    cfg.Timeout,
+			TsigSecret: cfg.tsigSecret(),
+		},
+		owned: map[string]dnssrv.RR{},
+	}
+
+	err := r.loadState()
+	if err != nil {
+		return nil, fmt.Errorf("state: %w", err)
+	}
+
+	return r, nil
+}
+
+func (c Config) tsigSecret() map[string]string {
+	if c.TSIG.Name == "" {
+		return nil
+	}
+
+	return map[string]string{c.TSIG.Name: c.TSIG.Secret}
+}
+
+func (r *RFC2136) Write(ctx context.Context, records []dns.Record) error {
+	err := r.write(ctx, records)
+	if err != nil {
+		return fmt.Errorf("rfc2136 sink: %w", err)
+	}
+
+	return nil
+}
+
+func (r *RFC2136) write(ctx context.Context, records []dns.Record) error {
+	records, err := r.cfg.Filter.Filter(records)
+	if err != nil {
+		return err
+	}
+
+	desired := map[string]map[string]dnssrv.RR{}
+	for _, rec := range records {
+		zone := r.zoneFor(rec.Name)
+		if zone == "" {
+			r.log.Debug("record outside of zones", "record", rec)
+			continue
+		}
+
+		rr, ok := rec.RR(r.cfg.TTL)
+		if !ok {
+			continue
+		}
+
+		if desired[zone] == nil {
+			desired[zone] = map[string]dnssrv.RR{}
+		}
+		desired[zone][key(rr)] = rr
+	}
+
+	for _, zone := range r.cfg.Zones {
+		err := r.syncZone(ctx, zone, desired[zone])
+		if err != nil {
+			return fmt.Errorf("zone %s: %w", zone, err)
+		}
+	}
+
+	return nil
+}
+
+func (r *RFC2136) syncZone(ctx context.Context, zone string, desired map[string]dnssrv.RR) error {
+	owned := map[string]dnssrv.RR{}
+	for k, rr := range r.owned {
+		if r.zoneFor(rr.Header().Name) == zone {
+			owned[k] = rr
+		}
+	}
+
+	current := owned
+	if r.cfg.Diff == diffAXFR {
+		var err error
+		current, err = r.transfer(ctx, zone)
+		if err != nil {
+			return fmt.Errorf("axfr: %w", err)
+		}
+	}
+
+	toAdd := []dnssrv.RR{}
+	for k, rr := range desired {
+		if _, ok := current[k]; !ok {
+			toAdd = append(toAdd, rr)
+		}
+	}
+
+	// records we did not push are never removed
+	toRemove := []dnssrv.RR{}
+	for k, rr := range owned {
+		_, wanted := desired[k]
+		_, exists := current[k]
+
+		if !wanted && exists {
+			toRemove = append(toRemove, rr)
+		}
+	}
+
+	if len(toAdd) > 0 || len(toRemove) > 0 {
+		err := r.update(ctx, zone, toAdd, toRemove)
+		if err != nil {
+			return err
+		}
+	}
+
+	changed := false
+	for k := range owned {
+		if _, ok := desired[k]; !ok {
+			delete(r.owned, k)
+			changed = true
+		}
+	}
+
+	for _, rr := range toAdd {
+		r.owned[key(rr)] = rr
+		changed = true
+	}
+
+	if changed {
+		err := r.saveState()
+		if err != nil {
+			return fmt.Errorf("state: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (r *RFC2136) update(ctx context.Context, zone string, toAdd []dnssrv.RR, toRemove []dnssrv.RR) error {
+	type op struct {
+		rr     dnssrv.RR
+		remove bool
+	}
+
+	ops := []op{}
+	for _, rr := range toRemove {
+		r.log.Info("removing record", "zone", zone, "record", rr.String())
+		ops = append(ops, op{rr: dnssrv.Copy(rr), remove: true})
+	}
+	for _, rr := range toAdd {
+		r.log.Info("adding record", "zone", zone, "record", rr.String())
+		ops = append(ops, op{rr: dnssrv.Copy(rr)})
+	}
+
+	for _, batch := range lo.Chunk(ops, maxUpdateRecords) {
+		msg := new(dnssrv.Msg)
+		msg.SetUpdate(zone)
+
+		for _, o := range batch {
+			if o.remove {
+				msg.Remove([]dnssrv.RR{o.rr})
+			} else {
+				msg.Insert([]dnssrv.RR{o.rr})
+			}
+		}
+
+		r.sign(msg)
+
+		res, _, err := r.client.ExchangeContext(ctx, msg, r.cfg.Server)
+		if err != nil {
+			return fmt.Errorf("update: %w", err)
+		}
+
+		if res.Rcode != dnssrv.RcodeSuccess {
+			return fmt.Errorf("update: %s", dnssrv.RcodeToString[res.Rcode])
+		}
+	}
+
+	return nil
+}
+
+// transfer returns the records of zone as currently served.
+func (r *RFC2136) transfer(ctx context.Context, zone string) (map[string]dnssrv.RR, error) {
+	dialer := net.Dialer{Timeout: r.cfg.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", r.cfg.Server)
+	if err != nil {
+		return nil, err
+	}
+
+	// the transfer has no context support, abort it by closing the
+	// connection
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	t := &dnssrv.Transfer{
+		Conn:         &dnssrv.Conn{Conn: conn},
+		ReadTimeout:  r.cfg.Timeout,
+		WriteTimeout: r.cfg.Timeout,
+		TsigSecret:   r.cfg.tsigSecret(),
+	}
+
+	msg := new(dnssrv.Msg)
+	msg.SetAxfr(zone)
+	r.sign(msg)
+
+	envs, err := t.In(msg, r.cfg.Server)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	res := map[string]dnssrv.RR{}
+	for env := range envs {
+		if env.Error != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, env.Error
+		}
+
+		for _, rr := range env.RR {
+			if _, ok := dns.FromRR(rr); ok {
+				res[key(rr)] = rr
+			}
+		}
+	}
+
+	return res, nil
+}
+
+func (r *RFC2136) sign(msg *dnssrv.Msg) {
+	if r.cfg.TSIG.Name != "" {
+		msg.SetTsig(r.cfg.TSIG.Name, r.cfg.TSIG.Algorithm, tsigFudge, time.Now().Unix())
+	}
+}
+
+// zoneFor returns the most specific configured zone containing name.
+func (r *RFC2136) zoneFor(name string) string {
+	name = strings.ToLower(dnssrv.CanonicalName(name))
+	res := ""
+
+	for _, zone := range r.cfg.Zones {
+		if dnssrv.IsSubDomain(zone, name) && len(zone) > len(res) {
+			res = zone
+		}
+	}
+
+	return res
+}
+
+// key identifies a record regardless of its TTL and name case.
+func key(rr dnssrv.RR) string {
+	rr = dnssrv.Copy(rr)
+	rr.Header().Name = strings.ToLower(dnssrv.CanonicalName(rr.Header().Name))
+	rr.Header().Ttl = 0
+
+	return rr.String()
+}
@@ -0,0 +1,199 @@
+package rfc2136
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/netip"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	dnssrv "github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testKeyName = "shimdns."
+	testSecret  = "c2VjcmV0c2VjcmV0c2VjcmV0c2VjcmV0"
+)
+
+// testPrimary is a primary server applying updates to an in-memory zone.
+type testPrimary struct {
+	lock    sync.Mutex
+	zone    map[string]dnssrv.RR
+	updates int
+}
+
+func (p *testPrimary) records() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	res := []string{}
+	for k := range p.zone {
+		res = append(res, k)
+	}
+	slices.Sort(res)
+
+	return res
+}
+
+func startPrimary(t *testing.T, zone []string) (*testPrimary, string) {
+	p := &testPrimary{zone: map[string]dnssrv.RR{}}
+	for _, line := range zone {
+		rr, err := dnssrv.NewRR(line)
+		require.NoError(t, err)
+		p.zone[key(rr)] = rr
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := &dnssrv.Server{
+		Listener:   l,
+		TsigSecret: map[string]string{testKeyName: testSecret},
+		// the default refuses updates
+		MsgAcceptFunc: func(dnssrv.Header) dnssrv.MsgAcceptAction { return dnssrv.MsgAccept },
+		Handler: dnssrv.HandlerFunc(func(w dnssrv.ResponseWriter, req *dnssrv.Msg) {
+			res := new(dnssrv.Msg)
+			res.SetReply(req)
+
+			if req.IsTsig() == nil || w.TsigStatus() != nil {
+				res.Rcode = dnssrv.RcodeNotAuth
+				_ = w.WriteMsg(res)
+				return
+			}
+			res.SetTsig(testKeyName, dnssrv.HmacSHA256, tsigFudge, int64(req.IsTsig().TimeSigned))
+
+			p.lock.Lock()
+			defer p.lock.Unlock()
+
+			if req.Opcode == dnssrv.OpcodeUpdate {
+				p.updates++
+
+				for _, rr := range req.Ns {
+					if rr.Header().Class == dnssrv.ClassNONE {
+						rr.Header().Class = dnssrv.ClassINET
+						delete(p.zone, key(rr))
+					} else {
+						p.zone[key(rr)] = rr
+					}
+				}
+
+				_ = w.WriteMsg(res)
+				return
+			}
+
+			soa, _ := dnssrv.NewRR("lan. 300 IN SOA ns.lan. hostmaster.lan. 1 3600 600 86400 300")
+
+			rrs := []dnssrv.RR{soa}
+			for _, rr := range p.zone {
+				rrs = append(rrs, rr)
+			}
+			rrs = append(rrs, soa)
+
+			ch := make(chan *dnssrv.Envelope, 1)
+			ch <- &dnssrv.Envelope{RR: rrs}
+			close(ch)
+
+			tr := new(dnssrv.Transfer)
+			_ = tr.Out(w, req, ch)
+		}),
+	}
+	go func() { _ = srv.ActivateAndServe() }()
+	t.Cleanup(func() { _ = srv.Shutdown() })
+
+	return p, l.Addr().String()
+}
+
+func testSink(t *testing.T, addr string, diff string, stateFile string) *RFC2136 {
+	r, err := New(slog.Default(), Config{
+		Server:    addr,
+		Zones:     []string{"lan"},
+		Diff:      diff,
+		StateFile: stateFile,
+		TSIG:      TSIGConfig{Name: "shimdns", Secret: testSecret},
+	})
+	require.NoError(t, err)
+
+	return r
+}
+
+func TestWriteOnlyTouchesOwnedRecords(t *testing.T) {
+	for _, diff := range []string{diffState, diffAXFR} {
+		t.Run(diff, func(t *testing.T) {
+			p, addr := startPrimary(t, []string{
+				"manual.lan. 300 IN A 192.168.1.100",
+			})
+			stateFile := filepath.Join(t.TempDir(), "state.json")
+
+			r := testSink(t, addr, diff, stateFile)
+			err := r.Write(context.Background(), []dns.Record{
+				{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+				{Type: dns.A, Name: "bar.lan.", Address: netip.MustParseAddr("192.168.1.2")},
+				{Type: dns.A, Name: "foo.other.", Address: netip.MustParseAddr("192.168.1.3")},
+			})
+			require.NoError(t, err)
+			require.Equal(t, []string{
+				"bar.lan.\t0\tIN\tA\t192.168.1.2",
+				"foo.lan.\t0\tIN\tA\t192.168.1.1",
+				"manual.lan.\t0\tIN\tA\t192.168.1.100",
+			}, p.records())
+
+			// ownership survives restarts
+			r = testSink(t, addr, diff, stateFile)
+			err = r.Write(context.Background(), []dns.Record{
+				{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+			})
+			require.NoError(t, err)
+			require.Equal(t, []string{
+				"foo.lan.\t0\tIN\tA\t192.168.1.1",
+				"manual.lan.\t0\tIN\tA\t192.168.1.100",
+			}, p.records())
+
+			// no changes, no update
+			updates := p.updates
+			err = r.Write(context.Background(), []dns.Record{
+				{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+			})
+			require.NoError(t, err)
+			require.Equal(t, updates, p.updates)
+		})
+	}
+}
+
+func TestWriteAXFRRepairsDrift(t *testing.T) {
+	p, addr := startPrimary(t, nil)
+
+	r := testSink(t, addr, diffAXFR, filepath.Join(t.TempDir(), "state.json"))
+	recs := []dns.Record{
+		{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+	}
+
+	require.NoError(t, r.Write(context.Background(), recs))
+
+	p.lock.Lock()
+	clear(p.zone)
+	p.lock.Unlock()
+
+	require.NoError(t, r.Write(context.Background(), recs))
+	require.Equal(t, []string{"foo.lan.\t0\tIN\tA\t192.168.1.1"}, p.records())
+}
+
+func TestStateFileRequired(t *testing.T) {
+	_, err := New(slog.Default(), Config{Server: "127.0.0.1", Zones: []string{"lan"}})
+	require.ErrorContains(t, err, "state_file")
+}
+
+func TestTransferCanceled(t *testing.T) {
+	_, addr := startPrimary(t, nil)
+	r := testSink(t, addr, diffAXFR, filepath.Join(t.TempDir(), "state.json"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := r.transfer(ctx, "lan.")
+	require.ErrorIs(t, err, context.Canceled)
+}
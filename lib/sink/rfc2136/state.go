@@ -0,0 +1,37 @@
+package rfc2136
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/ShimmerGlass/shimdns/lib/statefile"
+	dnssrv "github.com/miekg/dns"
+)
+
+func (r *RFC2136) loadState() error {
+	lines, err := statefile.Load[string](r.cfg.StateFile)
+	if err != nil {
+		return err
+	}
+
+	for _, line := range lines {
+		rr, err := dnssrv.NewRR(line)
+		if err != nil {
+			return fmt.Errorf("%q: %w", line, err)
+		}
+
+		r.owned[key(rr)] = rr
+	}
+
+	return nil
+}
+
+func (r *RFC2136) saveState() error {
+	lines := []string{}
+	for _, rr := range r.owned {
+		lines = append(lines, rr.String())
+	}
+	slices.Sort(lines)
+
+	return statefile.Save(r.cfg.StateFile, lines)
+}
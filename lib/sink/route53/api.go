@@ -0,0 +1,190 @@
+package route53
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	apiVersion = "2013-04-01"
+	apiXMLNS   = "https://route53.amazonaws.com/doc/2013-04-01/"
+
+	actionUpsert = "UPSERT"
+	actionDelete = "DELETE"
+
+	statusInSync = "INSYNC"
+)
+
+type rrset struct {
+	Name            string           `xml:"Name"`
+	Type            string           `xml:"Type"`
+	SetIdentifier   string           `xml:"SetIdentifier,omitempty"`
+	TTL             uint32           `xml:"TTL,omitempty"`
+	ResourceRecords []resourceRecord `xml:"ResourceRecords>ResourceRecord,omitempty"`
+	AliasTarget     *struct{}        `xml:"AliasTarget,omitempty"`
+}
+
+type resourceRecord struct {
+	Value string `xml:"Value"`
+}
+
+type change struct {
+	Action            string `xml:"Action"`
+	ResourceRecordSet rrset  `xml:"ResourceRecordSet"`
+}
+
+type changeRequest struct {
+	XMLName xml.Name `xml:"ChangeResourceRecordSetsRequest"`
+	XMLNS   string   `xml:"xmlns,attr"`
+	Comment string   `xml:"ChangeBatch>Comment,omitempty"`
+	Changes []change `xml:"ChangeBatch>Changes>Change"`
+}
+
+type changeInfo struct {
+	ID     string `xml:"ChangeInfo>Id"`
+	Status string `xml:"ChangeInfo>Status"`
+}
+
+type hostedZone struct {
+	ID   string `xml:"HostedZone>Id"`
+	Name string `xml:"HostedZone>Name"`
+}
+
+type listResponse struct {
+	ResourceRecordSets   []rrset `xml:"ResourceRecordSets>ResourceRecordSet"`
+	IsTruncated          bool    `xml:"IsTruncated"`
+	NextRecordName       string  `xml:"NextRecordName"`
+	NextRecordType       string  `xml:"NextRecordType"`
+	NextRecordIdentifier string  `xml:"NextRecordIdentifier"`
+}
+
+type errorResponse struct {
+	Code    string `xml:"Error>Code"`
+	Message string `xml:"Error>Message"`
+}
+
+type api struct {
+	endpoint string
+	region   string
+	creds    credentials
+	client   *http.Client
+}
+
+func newAPI(endpoint string, region string, creds credentials) *api {
+	return &api{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		region:   region,
+		creds:    creds,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (a *api) HostedZone(ctx context.Context, id string) (hostedZone, error) {
+	res := hostedZone{}
+	err := a.do(ctx, http.MethodGet, "/hostedzone/"+id, nil, nil, &res)
+	return res, err
+}
+
+func (a *api) RecordSets(ctx context.Context, zoneID string) ([]rrset, error) {
+	res := []rrset{}
+	query := url.Values{}
+
+	for {
+		page := listResponse{}
+		err := a.do(ctx, http.MethodGet, "/hostedzone/"+zoneID+"/rrset", query, nil, &page)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, page.ResourceRecordSets...)
+
+		if !page.IsTruncated {
+			return res, nil
+		}
+
+		query = url.Values{
+			"name": {page.NextRecordName},
+			"type": {page.NextRecordType},
+		}
+		if page.NextRecordIdentifier != "" {
+			query.Set("identifier", page.NextRecordIdentifier)
+		}
+	}
+}
+
+func (a *api) Change(ctx context.Context, zoneID string, changes []change) (changeInfo, error) {
+	res := changeInfo{}
+	err := a.do(ctx, http.MethodPost, "/hostedzone/"+zoneID+"/rrset", nil, changeRequest{
+		XMLNS:   apiXMLNS,
+		Comment: "shimdns",
+		Changes: changes,
+	}, &res)
+	return res, err
+}
+
+func (a *api) ChangeStatus(ctx context.Context, id string) (changeInfo, error) {
+	res := changeInfo{}
+	err := a.do(ctx, http.MethodGet, "/change/"+id, nil, nil, &res)
+	return res, err
+}
+
+func (a *api) do(ctx context.Context, method string, path string, query url.Values, body any, res any) error {
+	buf := []byte{}
+	if body != nil {
+		var err error
+		buf, err = xml.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+
+	u := a.endpoint + "/" + apiVersion + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/xml")
+	}
+
+	sign(req, buf, a.creds, a.region, "route53", time.Now())
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", method, path, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", method, path, err)
+	}
+
+	if resp.StatusCode >= 400 {
+		apiErr := errorResponse{}
+		if xml.Unmarshal(data, &apiErr) == nil && apiErr.Code != "" {
+			return fmt.Errorf("%s %s: %s: %s", method, path, apiErr.Code, apiErr.Message)
+		}
+
+		return fmt.Errorf("%s %s: bad status code: %d", method, path, resp.StatusCode)
+	}
+
+	err = xml.Unmarshal(data, res)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", method, path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,43 @@
+package route53
+
+import (
+	"time"
+
+	"github.com/ShimmerGlass/shimdns/lib/exp"
+)
+
+const (
+	defaultEndpoint     = "https://route53.amazonaws.com"
+	defaultRegion       = "us-east-1"
+	defaultTTL          = 300
+	defaultPollInterval = 5 * time.Second
+	defaultPollTimeout  = 2 * time.Minute
+)
+
+type Config struct {
+	HostedZoneID string `yaml:"hosted_zone_id"`
+
+	// API endpoint, the public one is used when not set
+	Endpoint string `yaml:"endpoint"`
+	Region   string `yaml:"region"`
+
+	// credentials are read from the environment and the shared credentials
+	// file when not set
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+	SessionToken    string `yaml:"session_token"`
+	Profile         string `yaml:"profile"`
+
+	// file the owned record sets are kept in across restarts, required.
+	// Record sets not created by shimdns are never modified.
+	StateFile string `yaml:"state_file"`
+
+	TTL uint32 `yaml:"ttl"`
+
+	// how often and for how long to wait for changes to be in sync, a
+	// negative timeout disables waiting
+	PollInterval time.Duration `yaml:"poll_interval"`
+	PollTimeout  time.Duration `yaml:"poll_timeout"`
+
+	Filter exp.Filter `yaml:"filter"`
+}
@@ -0,0 +1,104 @@
+package route53
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// loadCredentials returns the configured credentials, falling back to the
+// standard AWS environment variables and shared credentials file.
+func loadCredentials(cfg Config) (credentials, error) {
+	if cfg.AccessKeyID != "" {
+		return credentials{
+			AccessKeyID:     cfg.AccessKeyID,
+			SecretAccessKey: cfg.SecretAccessKey,
+			SessionToken:    cfg.SessionToken,
+		}, nil
+	}
+
+	if id := os.Getenv("AWS_ACCESS_KEY_ID"); id != "" && cfg.Profile == "" {
+		return credentials{
+			AccessKeyID:     id,
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}, nil
+	}
+
+	profile := cfg.Profile
+	if profile == "" {
+		profile = os.Getenv("AWS_PROFILE")
+	}
+	if profile == "" {
+		profile = "default"
+	}
+
+	path := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return credentials{}, err
+		}
+		path = filepath.Join(home, ".aws", "credentials")
+	}
+
+	buf, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return credentials{}, fmt.Errorf("no credentials configured")
+	}
+	if err != nil {
+		return credentials{}, err
+	}
+
+	values := parseProfile(buf, profile)
+	if values["aws_access_key_id"] == "" {
+		return credentials{}, fmt.Errorf("%s: no credentials for profile %q", path, profile)
+	}
+
+	return credentials{
+		AccessKeyID:     values["aws_access_key_id"],
+		SecretAccessKey: values["aws_secret_access_key"],
+		SessionToken:    values["aws_session_token"],
+	}, nil
+}
+
+// parseProfile returns the keys of a profile section in an INI credentials
+// file.
+func parseProfile(buf []byte, profile string) map[string]string {
+	res := map[string]string{}
+	section := ""
+
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(strings.TrimPrefix(line[1:len(line)-1], "profile "))
+			continue
+		}
+
+		if section != profile {
+			continue
+		}
+
+		k, v, ok := strings.Cut(line, "=")
+		if ok {
+			res[strings.ToLower(strings.TrimSpace(k))] = strings.TrimSpace(v)
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,267 @@
+package route53
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	dnssrv "github.com/miekg/dns"
+	"github.com/samber/lo"
+)
+
+// UPSERTs count twice toward the 1000 changes per request limit
+const maxBatchChanges = 500
+
+type Route53 struct {
+	log *slog.Logger
+	cfg Config
+	api *api
+
+	zone  string
+	owned map[string]struct{}
+}
+
+func New(log *slog.Logger, cfg Config) (*Route53, error) {
+	if cfg.HostedZoneID == "" {
+		return nil, fmt.Errorf("missing hosted_zone_id")
+	}
+
+	if cfg.StateFile == "" {
+		return nil, fmt.Errorf("missing state_file")
+	}
+	cfg.HostedZoneID = strings.TrimPrefix(cfg.HostedZoneID, "/hostedzone/")
+
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = defaultEndpoint
+	}
+	if cfg.Region == "" {
+		cfg.Region = defaultRegion
+	}
+	if cfg.TTL == 0 {
+		cfg.TTL = defaultTTL
+	}
+	if cfg.PollInterval == 0 {
+		cfg.PollInterval = defaultPollInterval
+	}
+	if cfg.PollTimeout == 0 {
+		cfg.PollTimeout = defaultPollTimeout
+	}
+
+	creds, err := loadCredentials(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("credentials: %w", err)
+	}
+
+	r := &Route53{
+		log:   log.With("sink", "route53", "zone_id", cfg.HostedZoneID),
+		cfg:   cfg,
+		api:   newAPI(cfg.Endpoint, cfg.Region, creds),
+		owned: map[string]struct{}{},
+	}
+
+	err = r.loadState()
+	if err != nil {
+		return nil, fmt.Errorf("state: %w", err)
+	}
+
+	return r, nil
+}
+
+func (r *Route53) Write(ctx context.Context, records []dns.Record) error {
+	err := r.write(ctx, records)
+	if err != nil {
+		return fmt.Errorf("route53 sink: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Route53) write(ctx context.Context, records []dns.Record) error {
+	records, err := r.cfg.Filter.Filter(records)
+	if err != nil {
+		return err
+	}
+
+	if r.zone == "" {
+		z, err := r.api.HostedZone(ctx, r.cfg.HostedZoneID)
+		if err != nil {
+			return err
+		}
+		r.zone = normalizeName(z.Name)
+	}
+
+	sets, err := r.api.RecordSets(ctx, r.cfg.HostedZoneID)
+	if err != nil {
+		return err
+	}
+
+	changes := r.changes(r.desired(records), sets)
+
+	for _, batch := range lo.Chunk(changes, maxBatchChanges) {
+		err := r.apply(ctx, batch)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// desired groups the records of the hosted zone into record sets, by key.
+func (r *Route53) desired(records []dns.Record) map[string]rrset {
+	desired := map[string]rrset{}
+	for _, rec := range records {
+		rr, ok := rec.RR(r.cfg.TTL)
+		if !ok {
+			continue
+		}
+
+		hdr := rr.Header()
+		name := normalizeName(hdr.Name)
+		if !dnssrv.IsSubDomain(r.zone, name) {
+			continue
+		}
+
+		// all values of a name and type share one record set
+		k := key(name, dnssrv.TypeToString[hdr.Rrtype])
+		set, ok := desired[k]
+		if !ok {
+			set = rrset{Name: name, Type: dnssrv.TypeToString[hdr.Rrtype], TTL: r.cfg.TTL}
+		}
+
+		value := strings.TrimPrefix(rr.String(), hdr.String())
+		if !slices.Contains(set.ResourceRecords, resourceRecord{Value: value}) {
+			set.ResourceRecords = append(set.ResourceRecords, resourceRecord{Value: value})
+		}
+		desired[k] = set
+	}
+
+	return desired
+}
+
+// changes returns the changes turning the hosted zone record sets into
+// desired. Only the record sets this sink created are modified, the ones
+// that no longer exist are forgotten.
+func (r *Route53) changes(desired map[string]rrset, sets []rrset) []change {
+	current := map[string]rrset{}
+	for _, set := range sets {
+		k := key(normalizeName(set.Name), set.Type)
+		if _, ok := current[k]; !ok {
+			current[k] = set
+		}
+	}
+
+	changes := []change{}
+
+	for _, k := range slices.Sorted(maps.Keys(desired)) {
+		want := desired[k]
+		_, owned := r.owned[k]
+
+		cur, exists := current[k]
+		if exists && !owned {
+			r.log.Warn("record set exists and is not managed by shimdns, skipping", "name", want.Name, "type", want.Type)
+			continue
+		}
+
+		if exists && sameSet(cur, want) {
+			continue
+		}
+
+		changes = append(changes, change{Action: actionUpsert, ResourceRecordSet: want})
+	}
+
+	for _, k := range slices.Sorted(maps.Keys(r.owned)) {
+		if _, ok := desired[k]; ok {
+			continue
+		}
+
+		cur, exists := current[k]
+		if !exists {
+			delete(r.owned, k)
+			continue
+		}
+
+		// deletions must match the current record set exactly
+		changes = append(changes, change{Action: actionDelete, ResourceRecordSet: cur})
+	}
+
+	return changes
+}
+
+func (r *Route53) apply(ctx context.Context, changes []change) error {
+	info, err := r.api.Change(ctx, r.cfg.HostedZoneID, changes)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range changes {
+		k := key(normalizeName(c.ResourceRecordSet.Name), c.ResourceRecordSet.Type)
+		if c.Action == actionDelete {
+			delete(r.owned, k)
+		} else {
+			r.owned[k] = struct{}{}
+		}
+
+		r.log.Info("record set changed", "action", c.Action, "name", c.ResourceRecordSet.Name, "type", c.ResourceRecordSet.Type)
+	}
+
+	err = r.saveState()
+	if err != nil {
+		return fmt.Errorf("state: %w", err)
+	}
+
+	return r.wait(ctx, info)
+}
+
+// wait polls the change status until it is propagated to all servers.
+func (r *Route53) wait(ctx context.Context, info changeInfo) error {
+	if r.cfg.PollTimeout < 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.cfg.PollTimeout)
+	defer cancel()
+
+	id := strings.TrimPrefix(info.ID, "/change/")
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for info.Status != statusInSync {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("change %s: waiting for sync: %w", id, ctx.Err())
+		case <-ticker.C:
+		}
+
+		var err error
+		info, err = r.api.ChangeStatus(ctx, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func sameSet(a rrset, b rrset) bool {
+	if a.TTL != b.TTL || a.AliasTarget != nil || a.SetIdentifier != "" {
+		return false
+	}
+
+	return lo.ElementsMatch(a.ResourceRecords, b.ResourceRecords)
+}
+
+// normalizeName returns name as a lowercase FQDN, with Route 53's escaped
+// wildcard label replaced.
+func normalizeName(name string) string {
+	return strings.ToLower(dnssrv.CanonicalName(strings.ReplaceAll(name, `\052`, "*")))
+}
+
+func key(name string, rtype string) string {
+	return name + " " + rtype
+}
@@ -0,0 +1,252 @@
+package route53
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func values(values ...string) []resourceRecord {
+	res := []resourceRecord{}
+	for _, v := range values {
+		res = append(res, resourceRecord{Value: v})
+	}
+	return res
+}
+
+type testCase struct {
+	Cfg     Config
+	Owned   []string
+	Current []rrset
+	Records []dns.Record
+	Changes []change
+}
+
+var testCases = []testCase{
+	{
+		// values are grouped by name and type, records outside of the
+		// hosted zone are ignored
+		Cfg: Config{TTL: 60},
+		Records: []dns.Record{
+			{Type: dns.A, Name: "foo.example.com.", Address: netip.MustParseAddr("192.168.1.1")},
+			{Type: dns.A, Name: "FOO.example.com.", Address: netip.MustParseAddr("192.168.1.2")},
+			{Type: dns.MX, Name: "example.com.", Mx: "mail.example.com.", Preference: 10},
+			{Type: dns.A, Name: "foo.other.", Address: netip.MustParseAddr("192.168.2.1")},
+		},
+		Changes: []change{
+			{Action: actionUpsert, ResourceRecordSet: rrset{Name: "example.com.", Type: "MX", TTL: 60, ResourceRecords: values("10 mail.example.com.")}},
+			{Action: actionUpsert, ResourceRecordSet: rrset{Name: "foo.example.com.", Type: "A", TTL: 60, ResourceRecords: values("192.168.1.1", "192.168.1.2")}},
+		},
+	},
+	{
+		// wildcard names are listed escaped
+		Owned:   []string{"*.example.com. CNAME"},
+		Current: []rrset{{Name: `\052.example.com.`, Type: "CNAME", TTL: defaultTTL, ResourceRecords: values("foo.example.com.")}},
+		Records: []dns.Record{{Type: dns.CNAME, Name: "*.example.com.", Target: "foo.example.com."}},
+		Changes: []change{},
+	},
+	{
+		// record sets not created by the sink are neither replaced nor
+		// deleted, deletions match the current record set
+		Owned: []string{"stale.example.com. A", "gone.example.com. A"},
+		Current: []rrset{
+			{Name: "manual.example.com.", Type: "A", TTL: 300, ResourceRecords: values("10.0.0.1")},
+			{Name: "other.example.com.", Type: "A", TTL: 300, ResourceRecords: values("10.0.0.2")},
+			{Name: "stale.example.com.", Type: "A", TTL: 600, ResourceRecords: values("10.0.0.3")},
+		},
+		Records: []dns.Record{
+			{Type: dns.A, Name: "manual.example.com.", Address: netip.MustParseAddr("192.168.1.3")},
+		},
+		Changes: []change{
+			{Action: actionDelete, ResourceRecordSet: rrset{Name: "stale.example.com.", Type: "A", TTL: 600, ResourceRecords: values("10.0.0.3")}},
+		},
+	},
+}
+
+func TestChanges(t *testing.T) {
+	for i, tc := range testCases {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			tc.Cfg.HostedZoneID = "Z1"
+			tc.Cfg.AccessKeyID = "AKID"
+			tc.Cfg.SecretAccessKey = "secret"
+			tc.Cfg.StateFile = filepath.Join(t.TempDir(), "state.json")
+
+			r, err := New(slog.Default(), tc.Cfg)
+			require.NoError(t, err)
+
+			r.zone = "example.com."
+			for _, k := range tc.Owned {
+				r.owned[k] = struct{}{}
+			}
+
+			require.Equal(t, tc.Changes, r.changes(r.desired(tc.Records), tc.Current))
+
+			// owned record sets that no longer exist are forgotten
+			require.NotContains(t, r.owned, "gone.example.com. A")
+		})
+	}
+}
+
+// checkSignature verifies the SigV4 signature of r made with the test
+// credentials.
+func checkSignature(r *http.Request, body []byte) error {
+	now, err := time.Parse(sigDateFormat, r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return fmt.Errorf("X-Amz-Date: %w", err)
+	}
+
+	creds := credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}
+
+	req, err := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), nil)
+	if err != nil {
+		return err
+	}
+	sign(req, body, creds, defaultRegion, "route53", now)
+
+	if r.Header.Get("Authorization") != req.Header.Get("Authorization") {
+		return fmt.Errorf("expected %q", req.Header.Get("Authorization"))
+	}
+
+	return nil
+}
+
+type request struct {
+	Method string
+	Path   string
+	Body   string
+}
+
+func TestWrite(t *testing.T) {
+	// record sets are listed over two pages, changes are pending on their
+	// first poll
+	requests := []request{}
+	polls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := checkSignature(r, body); err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = fmt.Fprintf(w, `<ErrorResponse><Error><Code>SignatureDoesNotMatch</Code><Message>%s</Message></Error></ErrorResponse>`, err)
+			return
+		}
+
+		path := strings.TrimPrefix(r.URL.Path, "/"+apiVersion)
+
+		switch {
+		case path == "/hostedzone/Z1":
+			_, _ = fmt.Fprint(w, `<GetHostedZoneResponse><HostedZone><Id>/hostedzone/Z1</Id><Name>example.com.</Name></HostedZone></GetHostedZoneResponse>`)
+
+		case path == "/hostedzone/Z1/rrset" && r.Method == http.MethodGet:
+			res := listResponse{
+				ResourceRecordSets: []rrset{{Name: "example.com.", Type: "NS", TTL: 172800, ResourceRecords: values("ns.example.com.")}},
+				IsTruncated:        true,
+				NextRecordName:     "foo.example.com.",
+				NextRecordType:     "A",
+			}
+			if r.URL.Query().Get("name") == "foo.example.com." {
+				res = listResponse{ResourceRecordSets: []rrset{{Name: "foo.example.com.", Type: "A", TTL: 300, ResourceRecords: values("10.0.0.1")}}}
+			}
+			_ = xml.NewEncoder(w).Encode(struct {
+				XMLName xml.Name `xml:"ListResourceRecordSetsResponse"`
+				listResponse
+			}{listResponse: res})
+
+		case path == "/hostedzone/Z1/rrset":
+			requests = append(requests, request{Method: r.Method, Path: path, Body: string(body)})
+			_, _ = fmt.Fprint(w, `<ChangeResourceRecordSetsResponse><ChangeInfo><Id>/change/C1</Id><Status>PENDING</Status></ChangeInfo></ChangeResourceRecordSetsResponse>`)
+
+		case path == "/change/C1":
+			polls++
+			status := "PENDING"
+			if polls > 1 {
+				status = statusInSync
+			}
+			_, _ = fmt.Fprintf(w, `<GetChangeResponse><ChangeInfo><Id>/change/C1</Id><Status>%s</Status></ChangeInfo></GetChangeResponse>`, status)
+		}
+	}))
+	defer srv.Close()
+
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	r, err := New(slog.Default(), Config{
+		HostedZoneID:    "/hostedzone/Z1",
+		Endpoint:        srv.URL,
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "secret",
+		StateFile:       stateFile,
+		PollInterval:    time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	// foo.example.com. listed on the second page is not owned
+	require.NoError(t, r.Write(context.Background(), []dns.Record{
+		{Type: dns.A, Name: "foo.example.com.", Address: netip.MustParseAddr("192.168.1.1")},
+		{Type: dns.A, Name: "bar.example.com.", Address: netip.MustParseAddr("192.168.1.2")},
+	}))
+
+	require.Equal(t, []request{{
+		Method: http.MethodPost,
+		Path:   "/hostedzone/Z1/rrset",
+		Body: `<ChangeResourceRecordSetsRequest xmlns="` + apiXMLNS + `"><ChangeBatch><Comment>shimdns</Comment><Changes><Change>` +
+			`<Action>UPSERT</Action><ResourceRecordSet><Name>bar.example.com.</Name><Type>A</Type><TTL>300</TTL>` +
+			`<ResourceRecords><ResourceRecord><Value>192.168.1.2</Value></ResourceRecord></ResourceRecords>` +
+			`</ResourceRecordSet></Change></Changes></ChangeBatch></ChangeResourceRecordSetsRequest>`,
+	}}, requests)
+	require.Equal(t, 2, polls)
+
+	// ownership is kept across restarts
+	state, err := os.ReadFile(stateFile)
+	require.NoError(t, err)
+	require.Contains(t, string(state), "bar.example.com. A")
+}
+
+func TestLoadCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials")
+	require.NoError(t, os.WriteFile(path, []byte(`
+[default]
+aws_access_key_id = DEFAULTKEY
+aws_secret_access_key = defaultsecret
+
+[profile dns]
+aws_access_key_id=DNSKEY
+aws_secret_access_key=dnssecret
+aws_session_token=token
+`), 0o600))
+
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", path)
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_PROFILE", "")
+
+	creds, err := loadCredentials(Config{})
+	require.NoError(t, err)
+	require.Equal(t, credentials{AccessKeyID: "DEFAULTKEY", SecretAccessKey: "defaultsecret"}, creds)
+
+	creds, err = loadCredentials(Config{Profile: "dns"})
+	require.NoError(t, err)
+	require.Equal(t, credentials{AccessKeyID: "DNSKEY", SecretAccessKey: "dnssecret", SessionToken: "token"}, creds)
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "ENVKEY")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "envsecret")
+	creds, err = loadCredentials(Config{})
+	require.NoError(t, err)
+	require.Equal(t, credentials{AccessKeyID: "ENVKEY", SecretAccessKey: "envsecret"}, creds)
+
+	_, err = loadCredentials(Config{Profile: "missing"})
+	require.Error(t, err)
+}
+
+func TestStateFileRequired(t *testing.T) {
+	_, err := New(slog.Default(), Config{HostedZoneID: "Z1"})
+	require.ErrorContains(t, err, "state_file")
+}
@@ -0,0 +1,25 @@
+package route53
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/ShimmerGlass/shimdns/lib/statefile"
+)
+
+func (r *Route53) loadState() error {
+	keys, err := statefile.Load[string](r.cfg.StateFile)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range keys {
+		r.owned[k] = struct{}{}
+	}
+
+	return nil
+}
+
+func (r *Route53) saveState() error {
+	return statefile.Save(r.cfg.StateFile, slices.Sorted(maps.Keys(r.owned)))
+}
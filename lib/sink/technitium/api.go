@@ -0,0 +1,171 @@
+package technitium
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ShimmerGlass/shimdns/lib/rest"
+)
+
+type response[T any] struct {
+	Status       string `json:"status"`
+	ErrorMessage string `json:"errorMessage"`
+	Response     T      `json:"response"`
+}
+
+type zone struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type record struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	TTL      uint32 `json:"ttl"`
+	Disabled bool   `json:"disabled"`
+	Comments string `json:"comments"`
+	RData    rdata  `json:"rData"`
+}
+
+type rdata struct {
+	IPAddress  string `json:"ipAddress,omitempty"`
+	CName      string `json:"cname,omitempty"`
+	PtrName    string `json:"ptrName,omitempty"`
+	Preference uint16 `json:"preference,omitempty"`
+	Exchange   string `json:"exchange,omitempty"`
+	Priority   uint16 `json:"priority,omitempty"`
+	Weight     uint16 `json:"weight,omitempty"`
+	Port       uint16 `json:"port,omitempty"`
+	Target     string `json:"target,omitempty"`
+}
+
+// params returns the query parameters identifying the record data, as
+// expected by the add and delete endpoints.
+func (r record) params() url.Values {
+	v := url.Values{}
+
+	switch r.Type {
+	case "A", "AAAA":
+		v.Set("ipAddress", r.RData.IPAddress)
+	case "CNAME":
+		v.Set("cname", r.RData.CName)
+	case "PTR":
+		v.Set("ptrName", r.RData.PtrName)
+	case "MX":
+		v.Set("preference", strconv.Itoa(int(r.RData.Preference)))
+		v.Set("exchange", r.RData.Exchange)
+	case "SRV":
+		v.Set("priority", strconv.Itoa(int(r.RData.Priority)))
+		v.Set("weight", strconv.Itoa(int(r.RData.Weight)))
+		v.Set("port", strconv.Itoa(int(r.RData.Port)))
+		v.Set("target", r.RData.Target)
+	}
+
+	return v
+}
+
+// key identifies a record by its name, type and data.
+func (r record) key() string {
+	parts := []string{strings.ToLower(strings.TrimSuffix(r.Name, ".")), r.Type}
+
+	params := r.params()
+	for _, k := range []string{"ipAddress", "cname", "ptrName", "preference", "exchange", "priority", "weight", "port", "target"} {
+		if v := params.Get(k); v != "" {
+			parts = append(parts, strings.ToLower(strings.TrimSuffix(v, ".")))
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
+
+type api struct {
+	url   string
+	token string
+}
+
+func newAPI(url string, token string) *api {
+	return &api{
+		url:   url,
+		token: token,
+	}
+}
+
+func (a *api) Zones(ctx context.Context) ([]zone, error) {
+	res, err := call[struct {
+		Zones []zone `json:"zones"`
+	}](ctx, a, "/api/zones/list", url.Values{})
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Zones, nil
+}
+
+func (a *api) CreateZone(ctx context.Context, name string) error {
+	_, err := call[any](ctx, a, "/api/zones/create", url.Values{
+		"zone": {name},
+		"type": {"Primary"},
+	})
+	return err
+}
+
+func (a *api) Records(ctx context.Context, zone string) ([]record, error) {
+	res, err := call[struct {
+		Records []record `json:"records"`
+	}](ctx, a, "/api/zones/records/get", url.Values{
+		"domain":   {zone},
+		"zone":     {zone},
+		"listZone": {"true"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Records, nil
+}
+
+func (a *api) Add(ctx context.Context, zone string, r record) error {
+	q := r.params()
+	q.Set("domain", r.Name)
+	q.Set("zone", zone)
+	q.Set("type", r.Type)
+	q.Set("ttl", strconv.Itoa(int(r.TTL)))
+	q.Set("comments", r.Comments)
+
+	_, err := call[any](ctx, a, "/api/zones/records/add", q)
+	return err
+}
+
+func (a *api) Delete(ctx context.Context, zone string, r record) error {
+	q := r.params()
+	q.Set("domain", r.Name)
+	q.Set("zone", zone)
+	q.Set("type", r.Type)
+
+	_, err := call[any](ctx, a, "/api/zones/records/delete", q)
+	return err
+}
+
+// call runs an API request. Technitium reports errors in the response body
+// rather than with status codes.
+func call[T any](ctx context.Context, a *api, path string, query url.Values) (T, error) {
+	query.Set("token", a.token)
+
+	res, err := rest.Get[response[T]](ctx, rest.Request{
+		URL:   a.url,
+		Path:  path,
+		Query: query,
+	})
+	if err != nil {
+		return res.Response, err
+	}
+
+	if res.Status != "ok" {
+		return res.Response, fmt.Errorf("%s: %s: %s", path, res.Status, res.ErrorMessage)
+	}
+
+	return res.Response, nil
+}
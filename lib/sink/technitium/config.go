@@ -0,0 +1,24 @@
+package technitium
+
+import "github.com/ShimmerGlass/shimdns/lib/exp"
+
+const (
+	defaultTTL     = 300
+	defaultComment = "managed by shimdns"
+)
+
+type Config struct {
+	URL   string `yaml:"url"`
+	Token string `yaml:"token"`
+
+	Zones []string `yaml:"zones"`
+	// create missing reverse zones for PTR records, e.g. those from autoptr
+	CreateReverseZones bool `yaml:"create_reverse_zones"`
+
+	// records are owned when they carry this comment
+	Comment string `yaml:"comment"`
+
+	TTL uint32 `yaml:"ttl"`
+
+	Filter exp.Filter `yaml:"filter"`
+}
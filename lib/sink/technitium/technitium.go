@@ -0,0 +1,249 @@
+package technitium
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	dnssrv "github.com/miekg/dns"
+	"github.com/samber/lo"
+)
+
+type Technitium struct {
+	log *slog.Logger
+	cfg Config
+	api *api
+}
+
+func New(log *slog.Logger, cfg Config) (*Technitium, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("missing url")
+	}
+
+	if cfg.TTL == 0 {
+		cfg.TTL = defaultTTL
+	}
+	if cfg.Comment == "" {
+		cfg.Comment = defaultComment
+	}
+
+	cfg.Zones = lo.Map(cfg.Zones, func(z string, _ int) string { return normalize(z) })
+
+	return &Technitium{
+		log: log.With("sink", "technitium"),
+		cfg: cfg,
+		api: newAPI(cfg.URL, cfg.Token),
+	}, nil
+}
+
+func (t *Technitium) Write(ctx context.Context, records []dns.Record) error {
+	err := t.write(ctx, records)
+	if err != nil {
+		return fmt.Errorf("technitium sink: %w", err)
+	}
+
+	return nil
+}
+
+func (t *Technitium) write(ctx context.Context, records []dns.Record) error {
+	records, err := t.cfg.Filter.Filter(records)
+	if err != nil {
+		return err
+	}
+
+	zones := slices.Clone(t.cfg.Zones)
+
+	// reverse zones are managed as well when they can be created, to remove
+	// PTRs that are no longer produced
+	if t.cfg.CreateReverseZones {
+		existing, err := t.api.Zones(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, z := range existing {
+			name := normalize(z.Name)
+			if isReverse(name) && !slices.Contains(zones, name) {
+				zones = append(zones, name)
+			}
+		}
+	}
+
+	desired, created := t.desired(zones, records)
+
+	for _, zone := range created {
+		t.log.Info("creating reverse zone", "zone", zone)
+
+		err := t.api.CreateZone(ctx, zone)
+		if err != nil {
+			return fmt.Errorf("create zone %s: %w", zone, err)
+		}
+	}
+	zones = append(zones, created...)
+
+	for _, zone := range zones {
+		err := t.syncZone(ctx, zone, desired[zone])
+		if err != nil {
+			return fmt.Errorf("zone %s: %w", zone, err)
+		}
+	}
+
+	return nil
+}
+
+// desired returns the records by zone, and the reverse zones to create for
+// PTRs outside of zones.
+func (t *Technitium) desired(zones []string, records []dns.Record) (map[string][]record, []string) {
+	res := map[string][]record{}
+	var created []string
+
+	for _, rec := range records {
+		r, ok := t.toRecord(rec)
+		if !ok {
+			continue
+		}
+
+		zone := zoneFor(slices.Concat(zones, created), r.Name)
+		if zone == "" && rec.Type == dns.PTR && t.cfg.CreateReverseZones {
+			zone = reverseZone(r.Name)
+			created = append(created, zone)
+		}
+		if zone == "" {
+			continue
+		}
+
+		if !slices.ContainsFunc(res[zone], func(o record) bool { return o.key() == r.key() }) {
+			res[zone] = append(res[zone], r)
+		}
+	}
+
+	return res, created
+}
+
+func (t *Technitium) syncZone(ctx context.Context, zone string, desired []record) error {
+	current, err := t.api.Records(ctx, zone)
+	if err != nil {
+		return err
+	}
+
+	add, remove := t.changes(current, desired)
+
+	for _, r := range remove {
+		t.log.Info("removing record", "zone", zone, "record", r.key())
+
+		err := t.api.Delete(ctx, zone, r)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, r := range add {
+		t.log.Info("adding record", "zone", zone, "record", r.key())
+
+		err := t.api.Add(ctx, zone, r)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// changes returns the records to add and remove to turn the current records
+// of a zone into the desired ones.
+func (t *Technitium) changes(current []record, desired []record) ([]record, []record) {
+	var add, remove []record
+
+	for _, cur := range current {
+		if cur.Comments != t.cfg.Comment {
+			continue
+		}
+
+		if !slices.ContainsFunc(desired, func(r record) bool { return r.key() == cur.key() && r.TTL == cur.TTL }) {
+			remove = append(remove, cur)
+		}
+	}
+
+	for _, r := range desired {
+		if !slices.ContainsFunc(current, func(cur record) bool {
+			// records not owned block additions of the same data
+			return cur.key() == r.key() && (cur.Comments != t.cfg.Comment || cur.TTL == r.TTL)
+		}) {
+			add = append(add, r)
+		}
+	}
+
+	return add, remove
+}
+
+// toRecord returns the Technitium record for rec, or false if its type is
+// not supported.
+func (t *Technitium) toRecord(rec dns.Record) (record, bool) {
+	r := record{
+		Name:     normalize(rec.Name),
+		Type:     string(rec.Type),
+		TTL:      t.cfg.TTL,
+		Comments: t.cfg.Comment,
+	}
+
+	switch rec.Type {
+	case dns.A, dns.AAAA:
+		r.RData.IPAddress = rec.Address.String()
+	case dns.CNAME:
+		r.RData.CName = normalize(rec.Target)
+	case dns.PTR:
+		r.RData.PtrName = normalize(rec.Ptr)
+	case dns.MX:
+		r.RData.Preference = rec.Preference
+		r.RData.Exchange = normalize(rec.Mx)
+	case dns.SRV:
+		r.RData.Priority = rec.Priority
+		r.RData.Weight = rec.Weight
+		r.RData.Port = rec.Port
+		r.RData.Target = normalize(rec.Target)
+	default:
+		return r, false
+	}
+
+	return r, true
+}
+
+// zoneFor returns the most specific zone containing name.
+func zoneFor(zones []string, name string) string {
+	res := ""
+
+	for _, zone := range zones {
+		if dnssrv.IsSubDomain(zone+".", name+".") && len(zone) > len(res) {
+			res = zone
+		}
+	}
+
+	return res
+}
+
+func isReverse(zone string) bool {
+	return strings.HasSuffix(zone, ".in-addr.arpa") || strings.HasSuffix(zone, ".ip6.arpa")
+}
+
+// reverseZone returns the /24 or /64 reverse zone containing the PTR name.
+func reverseZone(name string) string {
+	labels := dnssrv.SplitDomainName(name)
+
+	switch {
+	case strings.HasSuffix(name, ".ip6.arpa") && len(labels) > 18:
+		return strings.Join(labels[len(labels)-18:], ".")
+	case strings.HasSuffix(name, ".in-addr.arpa") && len(labels) > 5:
+		return strings.Join(labels[len(labels)-5:], ".")
+	default:
+		return strings.Join(labels[1:], ".")
+	}
+}
+
+// normalize returns name lowercased without its trailing dot, as used by
+// Technitium.
+func normalize(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
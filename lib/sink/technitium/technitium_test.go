@@ -0,0 +1,198 @@
+package technitium
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/require"
+)
+
+type testCase struct {
+	Cfg     Config
+	Zone    string
+	Current []record
+	Records []dns.Record
+	Created []string
+	Add     []record
+	Remove  []record
+}
+
+var testCases = []testCase{
+	{
+		// records outside of the zones are ignored, as are PTRs without
+		// create_reverse_zones
+		Cfg: Config{TTL: 60},
+		Records: []dns.Record{
+			{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+			{Type: dns.A, Name: "FOO.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+			{Type: dns.AAAA, Name: "foo.lan.", Address: netip.MustParseAddr("fd00::1")},
+			{Type: dns.CNAME, Name: "www.lan.", Target: "foo.lan."},
+			{Type: dns.SRV, Name: "_http._tcp.foo.lan.", Target: "foo.lan.", Port: 80, Weight: 5},
+			{Type: dns.MX, Name: "lan.", Mx: "mail.lan.", Preference: 10},
+			{Type: dns.A, Name: "foo.other.", Address: netip.MustParseAddr("192.168.2.1")},
+			{Type: dns.PTR, Name: "1.1.168.192.in-addr.arpa.", Ptr: "foo.lan."},
+		},
+		Add: []record{
+			{Name: "foo.lan", Type: "A", TTL: 60, Comments: defaultComment, RData: rdata{IPAddress: "192.168.1.1"}},
+			{Name: "foo.lan", Type: "AAAA", TTL: 60, Comments: defaultComment, RData: rdata{IPAddress: "fd00::1"}},
+			{Name: "www.lan", Type: "CNAME", TTL: 60, Comments: defaultComment, RData: rdata{CName: "foo.lan"}},
+			{Name: "_http._tcp.foo.lan", Type: "SRV", TTL: 60, Comments: defaultComment, RData: rdata{Weight: 5, Port: 80, Target: "foo.lan"}},
+			{Name: "lan", Type: "MX", TTL: 60, Comments: defaultComment, RData: rdata{Preference: 10, Exchange: "mail.lan"}},
+		},
+	},
+	{
+		// records not created by the sink are neither replaced nor deleted
+		Current: []record{
+			{Name: "manual.lan", Type: "A", TTL: 3600, RData: rdata{IPAddress: "10.0.0.1"}},
+			{Name: "stale.lan", Type: "A", TTL: 300, Comments: defaultComment, RData: rdata{IPAddress: "10.0.0.2"}},
+		},
+		Records: []dns.Record{
+			{Type: dns.A, Name: "manual.lan.", Address: netip.MustParseAddr("10.0.0.1")},
+		},
+		Remove: []record{
+			{Name: "stale.lan", Type: "A", TTL: 300, Comments: defaultComment, RData: rdata{IPAddress: "10.0.0.2"}},
+		},
+	},
+	{
+		// records are replaced when their TTL changes
+		Current: []record{
+			{Name: "foo.lan", Type: "A", TTL: 60, Comments: defaultComment, RData: rdata{IPAddress: "192.168.1.1"}},
+		},
+		Records: []dns.Record{
+			{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+		},
+		Add: []record{
+			{Name: "foo.lan", Type: "A", TTL: defaultTTL, Comments: defaultComment, RData: rdata{IPAddress: "192.168.1.1"}},
+		},
+		Remove: []record{
+			{Name: "foo.lan", Type: "A", TTL: 60, Comments: defaultComment, RData: rdata{IPAddress: "192.168.1.1"}},
+		},
+	},
+	{
+		// ownership is decided by the comment
+		Cfg: Config{Comment: "shimdns-1"},
+		Current: []record{
+			{Name: "default.lan", Type: "A", TTL: 300, Comments: defaultComment, RData: rdata{IPAddress: "10.0.0.1"}},
+			{Name: "stale.lan", Type: "A", TTL: 300, Comments: "shimdns-1", RData: rdata{IPAddress: "10.0.0.2"}},
+		},
+		Remove: []record{
+			{Name: "stale.lan", Type: "A", TTL: 300, Comments: "shimdns-1", RData: rdata{IPAddress: "10.0.0.2"}},
+		},
+	},
+	{
+		// PTRs outside of the zones create their /24 or /64 reverse zone
+		Cfg:  Config{CreateReverseZones: true},
+		Zone: "1.168.192.in-addr.arpa",
+		Records: []dns.Record{
+			{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+			{Type: dns.PTR, Name: "1.1.168.192.in-addr.arpa.", Ptr: "foo.lan."},
+			{Type: dns.PTR, Name: "2.1.168.192.in-addr.arpa.", Ptr: "bar.lan."},
+			{Type: dns.PTR, Name: "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.d.f.ip6.arpa.", Ptr: "foo.lan."},
+		},
+		Created: []string{"1.168.192.in-addr.arpa", "0.0.0.0.0.0.0.0.0.0.0.0.0.0.d.f.ip6.arpa"},
+		Add: []record{
+			{Name: "1.1.168.192.in-addr.arpa", Type: "PTR", TTL: defaultTTL, Comments: defaultComment, RData: rdata{PtrName: "foo.lan"}},
+			{Name: "2.1.168.192.in-addr.arpa", Type: "PTR", TTL: defaultTTL, Comments: defaultComment, RData: rdata{PtrName: "bar.lan"}},
+		},
+	},
+}
+
+func TestChanges(t *testing.T) {
+	for i, tc := range testCases {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			tc.Cfg.URL = "http://technitium"
+			tc.Cfg.Zones = []string{"lan."}
+			if tc.Zone == "" {
+				tc.Zone = "lan"
+			}
+
+			tt, err := New(slog.Default(), tc.Cfg)
+			require.NoError(t, err)
+
+			desired, created := tt.desired(tt.cfg.Zones, tc.Records)
+			require.Equal(t, tc.Created, created)
+
+			add, remove := tt.changes(tc.Current, desired[tc.Zone])
+			require.Equal(t, tc.Add, add)
+			require.Equal(t, tc.Remove, remove)
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	zones := map[string][]record{
+		"lan": {{Name: "manual.lan", Type: "A", TTL: 3600, RData: rdata{IPAddress: "10.0.0.1"}}},
+		// owned records are removed from existing reverse zones too
+		"2.168.192.in-addr.arpa": {{Name: "1.2.168.192.in-addr.arpa", Type: "PTR", TTL: 300, Comments: defaultComment, RData: rdata{PtrName: "old.lan"}}},
+	}
+	requests := []string{}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("token") != "secret" {
+			_ = json.NewEncoder(w).Encode(response[any]{Status: "invalid-token", ErrorMessage: "Invalid token or session expired."})
+			return
+		}
+
+		q.Del("token")
+		requests = append(requests, strings.TrimPrefix(r.URL.Path, "/api/zones/")+" "+q.Encode())
+
+		var res any
+		switch r.URL.Path {
+		case "/api/zones/list":
+			res = map[string]any{"zones": lo.MapToSlice(zones, func(name string, _ []record) zone {
+				return zone{Name: name, Type: "Primary"}
+			})}
+		case "/api/zones/create":
+			zones[q.Get("zone")] = []record{}
+		case "/api/zones/records/get":
+			res = map[string]any{"records": zones[q.Get("zone")]}
+		case "/api/zones/records/add", "/api/zones/records/delete":
+			// records are checked through the final requests
+		default:
+			http.NotFound(w, r)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(response[any]{Status: "ok", Response: res})
+	}))
+	defer srv.Close()
+
+	tt, err := New(slog.Default(), Config{URL: srv.URL, Token: "secret", Zones: []string{"lan"}, CreateReverseZones: true})
+	require.NoError(t, err)
+
+	require.NoError(t, tt.Write(context.Background(), []dns.Record{
+		{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+		{Type: dns.PTR, Name: "1.1.168.192.in-addr.arpa.", Ptr: "foo.lan."},
+	}))
+
+	require.Equal(t, []string{
+		"list ",
+		"create type=Primary&zone=1.168.192.in-addr.arpa",
+		"records/get domain=lan&listZone=true&zone=lan",
+		"records/add comments=managed+by+shimdns&domain=foo.lan&ipAddress=192.168.1.1&ttl=300&type=A&zone=lan",
+		"records/get domain=2.168.192.in-addr.arpa&listZone=true&zone=2.168.192.in-addr.arpa",
+		"records/delete domain=1.2.168.192.in-addr.arpa&ptrName=old.lan&type=PTR&zone=2.168.192.in-addr.arpa",
+		"records/get domain=1.168.192.in-addr.arpa&listZone=true&zone=1.168.192.in-addr.arpa",
+		"records/add comments=managed+by+shimdns&domain=1.1.168.192.in-addr.arpa&ptrName=foo.lan&ttl=300&type=PTR&zone=1.168.192.in-addr.arpa",
+	}, requests)
+
+	tt, err = New(slog.Default(), Config{URL: srv.URL, Token: "wrong", Zones: []string{"lan"}})
+	require.NoError(t, err)
+	require.ErrorContains(t, tt.Write(context.Background(), nil), "invalid-token")
+}
+
+func TestReverseZone(t *testing.T) {
+	require.Equal(t, "1.168.192.in-addr.arpa", reverseZone("4.1.168.192.in-addr.arpa"))
+	require.Equal(t, "0.0.0.0.0.0.0.0.0.0.0.0.0.0.d.f.ip6.arpa",
+		reverseZone(strings.Repeat("1.", 16)+"0.0.0.0.0.0.0.0.0.0.0.0.0.0.d.f.ip6.arpa"))
+}
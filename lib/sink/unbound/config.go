@@ -0,0 +1,24 @@
+package unbound
+
+import (
+	"github.com/ShimmerGlass/shimdns/lib/exp"
+	"github.com/ShimmerGlass/shimdns/lib/reload"
+)
+
+type Config struct {
+	// file included by unbound with include:
+	Path string `yaml:"path"`
+	// ie. "unbound-control reload"
+	Reload reload.Config `yaml:"reload"`
+
+	LocalZones []LocalZone `yaml:"local_zones"`
+	TTL        uint32      `yaml:"ttl"`
+
+	Filter exp.Filter `yaml:"filter"`
+}
+
+type LocalZone struct {
+	Name string `yaml:"name"`
+	// unbound local-zone type, "static" when not set
+	Type string `yaml:"type"`
+}
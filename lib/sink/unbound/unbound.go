@@ -0,0 +1,119 @@
+package unbound
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/ShimmerGlass/shimdns/lib/configfile"
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	dnssrv "github.com/miekg/dns"
+)
+
+const (
+	defaultTTL           = 300
+	defaultLocalZoneType = "static"
+)
+
+type Unbound struct {
+	log *slog.Logger
+	cfg Config
+
+	file *configfile.Writer
+}
+
+func New(log *slog.Logger, cfg Config) (*Unbound, error) {
+	log = log.With("sink", "unbound")
+
+	if cfg.TTL == 0 {
+		cfg.TTL = defaultTTL
+	}
+
+	for i, z := range cfg.LocalZones {
+		if z.Name == "" {
+			return nil, fmt.Errorf("local zone #%d: missing name", i)
+		}
+
+		if z.Type == "" {
+			cfg.LocalZones[i].Type = defaultLocalZoneType
+		}
+	}
+
+	file, err := configfile.New(log, cfg.Path, cfg.Reload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Unbound{
+		log:  log,
+		cfg:  cfg,
+		file: file,
+	}, nil
+}
+
+func (u *Unbound) Write(ctx context.Context, records []dns.Record) error {
+	records, err := u.cfg.Filter.Filter(records)
+	if err != nil {
+		return fmt.Errorf("unbound sink: %w", err)
+	}
+
+	content, unsupported := u.render(records)
+	u.file.ReportUnsupported(unsupported)
+
+	err = u.file.Write(ctx, content)
+	if err != nil {
+		return fmt.Errorf("unbound sink: %w", err)
+	}
+
+	return nil
+}
+
+// render returns the unbound configuration for records, and the records it
+// cannot express.
+func (u *Unbound) render(records []dns.Record) ([]byte, []dns.Record) {
+	lines := []string{}
+	unsupported := []dns.Record{}
+
+	for _, rec := range records {
+		// local-data does not support wildcards
+		if strings.HasPrefix(rec.Name, "*.") {
+			unsupported = append(unsupported, rec)
+			continue
+		}
+
+		rr, ok := rec.RR(u.cfg.TTL)
+		if !ok {
+			unsupported = append(unsupported, rec)
+			continue
+		}
+
+		hdr := rr.Header()
+		rdata := strings.TrimPrefix(rr.String(), hdr.String())
+
+		lines = append(lines, fmt.Sprintf("\tlocal-data: \"%s %d IN %s %s\"",
+			hdr.Name, hdr.Ttl, dnssrv.TypeToString[hdr.Rrtype], rdata))
+	}
+
+	// sources do not guarantee ordering, keep the output stable to avoid
+	// needless reloads
+	slices.Sort(lines)
+	lines = slices.Compact(lines)
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("# generated by shimdns, do not edit\n")
+	buf.WriteString("server:\n")
+
+	for _, z := range u.cfg.LocalZones {
+		fmt.Fprintf(buf, "\tlocal-zone: \"%s\" %s\n", dnssrv.CanonicalName(z.Name), z.Type)
+	}
+
+	for _, l := range lines {
+		buf.WriteString(l)
+		buf.WriteByte('\n')
+	}
+
+	return buf.Bytes(), unsupported
+}
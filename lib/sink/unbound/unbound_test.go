@@ -0,0 +1,44 @@
+package unbound
+
+import (
+	"context"
+	"log/slog"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shimdns.conf")
+
+	u, err := New(slog.Default(), Config{
+		Path:       path,
+		LocalZones: []LocalZone{{Name: "lan"}, {Name: "168.192.in-addr.arpa.", Type: "transparent"}},
+	})
+	require.NoError(t, err)
+
+	err = u.Write(context.Background(), []dns.Record{
+		{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+		{Type: dns.CNAME, Name: "www.lan.", Target: "foo.lan."},
+		{Type: dns.SRV, Name: "_http._tcp.foo.lan.", Target: "foo.lan.", Port: 80},
+		{Type: dns.PTR, Name: "1.1.168.192.in-addr.arpa.", Ptr: "foo.lan."},
+		{Type: dns.A, Name: "*.apps.lan.", Address: netip.MustParseAddr("192.168.1.2")},
+	})
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, `# generated by shimdns, do not edit
+server:
+	local-zone: "lan." static
+	local-zone: "168.192.in-addr.arpa." transparent
+	local-data: "1.1.168.192.in-addr.arpa. 300 IN PTR foo.lan."
+	local-data: "_http._tcp.foo.lan. 300 IN SRV 0 0 80 foo.lan."
+	local-data: "foo.lan. 300 IN A 192.168.1.1"
+	local-data: "www.lan. 300 IN CNAME foo.lan."
+`, string(content))
+}
@@ -0,0 +1,40 @@
+package webhook
+
+import (
+	"time"
+
+	"github.com/ShimmerGlass/shimdns/lib/exp"
+)
+
+const (
+	defaultContentType     = "application/json"
+	defaultSignatureHeader = "X-Shimdns-Signature"
+	defaultRetries         = 3
+	defaultRetryInterval   = 5 * time.Second
+	defaultTimeout         = 10 * time.Second
+)
+
+type Config struct {
+	URLs    []string          `yaml:"urls"`
+	Headers map[string]string `yaml:"headers"`
+
+	// Go text/template of the request body, executed with .Added, .Removed
+	// and .Records. Defaults to a JSON document of the same fields.
+	Template    string `yaml:"template"`
+	ContentType string `yaml:"content_type"`
+
+	// send all records on each change instead of the added and removed ones
+	Snapshot bool `yaml:"snapshot"`
+
+	// when set, the body is signed with HMAC-SHA256 and the signature sent
+	// as "sha256=<hex>" in the signature header
+	Secret          string `yaml:"secret"`
+	SignatureHeader string `yaml:"signature_header"`
+
+	// retries after a failed request, a negative value disables retries
+	Retries       int           `yaml:"retries"`
+	RetryInterval time.Duration `yaml:"retry_interval"`
+	Timeout       time.Duration `yaml:"timeout"`
+
+	Filter exp.Filter `yaml:"filter"`
+}
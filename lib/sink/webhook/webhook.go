@@ -0,0 +1,241 @@
+package webhook
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	"github.com/ShimmerGlass/shimdns/lib/rest"
+	"github.com/samber/lo"
+)
+
+// payload is the data the body template is executed with.
+type payload struct {
+	Added   []dns.Record `json:"added"`
+	Removed []dns.Record `json:"removed"`
+	Records []dns.Record `json:"records"`
+}
+
+type Webhook struct {
+	log *slog.Logger
+	cfg Config
+
+	tmpl   *template.Template
+	client *http.Client
+
+	lock sync.Mutex
+	// records last delivered to each URL, a URL failing is sent the
+	// changes it missed on the next write
+	sent map[string][]dns.Record
+}
+
+func New(log *slog.Logger, cfg Config) (*Webhook, error) {
+	if len(cfg.URLs) == 0 {
+		return nil, errors.New("no urls configured")
+	}
+
+	if cfg.ContentType == "" {
+		cfg.ContentType = defaultContentType
+	}
+
+	if cfg.SignatureHeader == "" {
+		cfg.SignatureHeader = defaultSignatureHeader
+	}
+
+	if cfg.Retries == 0 {
+		cfg.Retries = defaultRetries
+	}
+
+	if cfg.RetryInterval == 0 {
+		cfg.RetryInterval = defaultRetryInterval
+	}
+
+	if cfg.Timeout == 0 {
+		cfg.Timeout = defaultTimeout
+	}
+
+	w := &Webhook{
+		log:    log.With("sink", "webhook"),
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+		sent:   map[string][]dns.Record{},
+	}
+
+	if cfg.Template != "" {
+		tmpl, err := template.New("body").Funcs(template.FuncMap{
+			"json": func(v any) (string, error) {
+				buf, err := json.Marshal(v)
+				return string(buf), err
+			},
+		}).Parse(cfg.Template)
+		if err != nil {
+			return nil, fmt.Errorf("template: %w", err)
+		}
+		w.tmpl = tmpl
+	}
+
+	return w, nil
+}
+
+func (w *Webhook) Write(ctx context.Context, records []dns.Record) error {
+	err := w.write(ctx, records)
+	if err != nil {
+		return fmt.Errorf("webhook sink: %w", err)
+	}
+
+	return nil
+}
+
+func (w *Webhook) write(ctx context.Context, records []dns.Record) error {
+	records, err := w.cfg.Filter.Filter(records)
+	if err != nil {
+		return err
+	}
+
+	records = sorted(records)
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	var errs []error
+	for _, url := range w.cfg.URLs {
+		prev, delivered := w.sent[url]
+		removed, added := lo.Difference(prev, records)
+
+		// snapshots are always sent on the first write
+		if len(added) == 0 && len(removed) == 0 && (delivered || !w.cfg.Snapshot) {
+			w.sent[url] = records
+			continue
+		}
+
+		p := payload{Added: added, Removed: removed}
+		if w.cfg.Snapshot {
+			p = payload{Records: records}
+		}
+
+		body, err := w.body(p)
+		if err != nil {
+			return err
+		}
+
+		err = w.send(ctx, url, body)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", url, err))
+			continue
+		}
+
+		w.log.Debug("sent", "url", url, "added", len(added), "removed", len(removed))
+		w.sent[url] = records
+	}
+
+	return errors.Join(errs...)
+}
+
+func (w *Webhook) body(p payload) ([]byte, error) {
+	if w.tmpl != nil {
+		buf := &bytes.Buffer{}
+		err := w.tmpl.Execute(buf, p)
+		if err != nil {
+			return nil, fmt.Errorf("template: %w", err)
+		}
+
+		return buf.Bytes(), nil
+	}
+
+	if w.cfg.Snapshot {
+		return json.Marshal(map[string][]dns.Record{"records": p.Records})
+	}
+
+	return json.Marshal(map[string][]dns.Record{"added": p.Added, "removed": p.Removed})
+}
+
+func (w *Webhook) send(ctx context.Context, url string, body []byte) error {
+	for attempt := 0; ; attempt++ {
+		err := w.post(ctx, url, body)
+		if err == nil {
+			return nil
+		}
+
+		if attempt >= w.cfg.Retries || !retryable(err) {
+			return err
+		}
+
+		w.log.Warn("request failed", "url", url, "attempts", attempt+1, "retry_in", w.cfg.RetryInterval, "err", err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(w.cfg.RetryInterval):
+		}
+	}
+}
+
+func (w *Webhook) post(ctx context.Context, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", w.cfg.ContentType)
+	for k, v := range w.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	if w.cfg.Secret != "" {
+		req.Header.Set(w.cfg.SignatureHeader, "sha256="+sign(w.cfg.Secret, body))
+	}
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	if res.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return &rest.StatusError{Code: res.StatusCode, Body: string(msg)}
+	}
+
+	_, _ = io.Copy(io.Discard, res.Body)
+
+	return nil
+}
+
+// retryable reports whether a request failing with err may succeed later,
+// client errors other than rate limiting are not retried.
+func retryable(err error) bool {
+	var serr *rest.StatusError
+	if errors.As(err, &serr) {
+		return serr.Code >= 500 || serr.Code == http.StatusTooManyRequests
+	}
+
+	return true
+}
+
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func sorted(records []dns.Record) []dns.Record {
+	records = append([]dns.Record{}, records...)
+	slices.SortFunc(records, func(a, b dns.Record) int {
+		return cmp.Or(cmp.Compare(a.String(), b.String()), cmp.Compare(a.Source+a.SourceName, b.Source+b.SourceName))
+	})
+	return records
+}
@@ -0,0 +1,146 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	"github.com/stretchr/testify/require"
+)
+
+// receiver records the bodies it is sent, failing the first requests.
+type receiver struct {
+	mu       sync.Mutex
+	failures int
+	status   int
+	bodies   []string
+	headers  []http.Header
+}
+
+func (f *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.failures > 0 {
+		f.failures--
+		w.WriteHeader(f.status)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	f.bodies = append(f.bodies, string(body))
+	f.headers = append(f.headers, r.Header)
+}
+
+func (f *receiver) received() ([]string, []http.Header) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.bodies, f.headers
+}
+
+var (
+	foo = dns.Record{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.1"), Source: "traefik"}
+	bar = dns.Record{Type: dns.CNAME, Name: "bar.lan.", Target: "foo.lan.", Source: "traefik"}
+)
+
+func TestDiff(t *testing.T) {
+	ok := &receiver{}
+	okSrv := httptest.NewServer(ok)
+	defer okSrv.Close()
+
+	flaky := &receiver{failures: 1, status: http.StatusServiceUnavailable}
+	flakySrv := httptest.NewServer(flaky)
+	defer flakySrv.Close()
+
+	down := &receiver{failures: 100, status: http.StatusBadRequest}
+	downSrv := httptest.NewServer(down)
+	defer downSrv.Close()
+
+	w, err := New(slog.Default(), Config{
+		URLs:          []string{okSrv.URL, flakySrv.URL, downSrv.URL},
+		Headers:       map[string]string{"Authorization": "Bearer token"},
+		Secret:        "secret",
+		RetryInterval: time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	err = w.Write(context.Background(), []dns.Record{foo})
+	require.ErrorContains(t, err, downSrv.URL)
+
+	// unchanged records are not sent again
+	err = w.Write(context.Background(), []dns.Record{foo})
+	require.ErrorContains(t, err, downSrv.URL)
+
+	err = w.Write(context.Background(), []dns.Record{bar})
+	require.ErrorContains(t, err, downSrv.URL)
+
+	expected := []string{
+		`{"added":[{"type":"A","name":"foo.lan.","source":"traefik","source_name":"","address":"192.168.1.1"}],"removed":[]}`,
+		`{"added":[{"type":"CNAME","name":"bar.lan.","source":"traefik","source_name":"","address":"","target":"foo.lan."}],` +
+			`"removed":[{"type":"A","name":"foo.lan.","source":"traefik","source_name":"","address":"192.168.1.1"}]}`,
+	}
+
+	bodies, headers := ok.received()
+	require.Equal(t, expected, bodies)
+	require.Equal(t, "Bearer token", headers[0].Get("Authorization"))
+	require.Equal(t, "application/json", headers[0].Get("Content-Type"))
+	require.Equal(t, "sha256="+sign("secret", []byte(expected[0])), headers[0].Get(defaultSignatureHeader))
+
+	// failed requests are retried
+	bodies, _ = flaky.received()
+	require.Equal(t, expected, bodies)
+
+	// client errors are not retried
+	down.mu.Lock()
+	require.Equal(t, 97, down.failures)
+	down.mu.Unlock()
+}
+
+func TestSnapshotTemplate(t *testing.T) {
+	rcv := &receiver{}
+	srv := httptest.NewServer(rcv)
+	defer srv.Close()
+
+	w, err := New(slog.Default(), Config{
+		URLs:        []string{srv.URL},
+		Snapshot:    true,
+		ContentType: "text/plain",
+		Template:    `{{ range .Records }}{{ .Name }} {{ .Type }}{{ "\n" }}{{ end }}`,
+	})
+	require.NoError(t, err)
+
+	// the first snapshot is sent even when empty
+	require.NoError(t, w.Write(context.Background(), nil))
+	require.NoError(t, w.Write(context.Background(), nil))
+	require.NoError(t, w.Write(context.Background(), []dns.Record{foo, bar}))
+
+	bodies, headers := rcv.received()
+	require.Equal(t, []string{"", "bar.lan. CNAME\nfoo.lan. A\n"}, bodies)
+	require.Equal(t, "text/plain", headers[1].Get("Content-Type"))
+	require.Empty(t, headers[1].Get(defaultSignatureHeader))
+}
+
+func TestSnapshotJSON(t *testing.T) {
+	rcv := &receiver{}
+	srv := httptest.NewServer(rcv)
+	defer srv.Close()
+
+	w, err := New(slog.Default(), Config{URLs: []string{srv.URL}, Snapshot: true})
+	require.NoError(t, err)
+
+	require.NoError(t, w.Write(context.Background(), []dns.Record{foo}))
+
+	bodies, _ := rcv.received()
+	res := map[string][]dns.Record{}
+	require.NoError(t, json.Unmarshal([]byte(bodies[0]), &res))
+	require.Equal(t, map[string][]dns.Record{"records": {foo}}, res)
+}
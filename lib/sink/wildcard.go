@@ -0,0 +1,53 @@
+package sink
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+)
+
+// WithoutWildcards returns a sink writing records to s, without the
+// wildcard records, e.g. "*.apps.lan.", that s cannot express.
+func WithoutWildcards(log *slog.Logger, s Sink) Sink {
+	return &wildcardFilter{log: log, sink: s}
+}
+
+type wildcardFilter struct {
+	log  *slog.Logger
+	sink Sink
+
+	// records last skipped, to only log changes
+	lastSkipped string
+}
+
+func (f *wildcardFilter) Write(ctx context.Context, records []dns.Record) error {
+	kept := make([]dns.Record, 0, len(records))
+	skipped := []dns.Record{}
+
+	for _, rec := range records {
+		if strings.HasPrefix(rec.Name, "*.") {
+			skipped = append(skipped, rec)
+		} else {
+			kept = append(kept, rec)
+		}
+	}
+
+	lines := []string{}
+	for _, rec := range skipped {
+		lines = append(lines, rec.String())
+	}
+	slices.Sort(lines)
+
+	if key := strings.Join(lines, "\n"); key != f.lastSkipped {
+		f.lastSkipped = key
+
+		for _, rec := range skipped {
+			f.log.Warn("wildcard records are not supported by this sink, skipping", "record", rec)
+		}
+	}
+
+	return f.sink.Write(ctx, kept)
+}
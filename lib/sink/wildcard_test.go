@@ -0,0 +1,33 @@
+package sink
+
+import (
+	"context"
+	"log/slog"
+	"net/netip"
+	"testing"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingSink []dns.Record
+
+func (r *recordingSink) Write(ctx context.Context, records []dns.Record) error {
+	*r = records
+	return nil
+}
+
+func TestWithoutWildcards(t *testing.T) {
+	rec := &recordingSink{}
+
+	err := WithoutWildcards(slog.Default(), rec).Write(context.Background(), []dns.Record{
+		{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+		{Type: dns.A, Name: "*.apps.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+		{Type: dns.CNAME, Name: "www.*.lan.", Target: "foo.lan."},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []dns.Record{
+		{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+		{Type: dns.CNAME, Name: "www.*.lan.", Target: "foo.lan."},
+	}, []dns.Record(*rec))
+}
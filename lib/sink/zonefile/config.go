@@ -0,0 +1,27 @@
+package zonefile
+
+import (
+	"github.com/ShimmerGlass/shimdns/lib/exp"
+	"github.com/ShimmerGlass/shimdns/lib/reload"
+)
+
+type Config struct {
+	// directory zone files are written to when a zone has no file set
+	Dir   string       `yaml:"dir"`
+	Zones []ZoneConfig `yaml:"zones"`
+
+	TTL uint32 `yaml:"ttl"`
+
+	Filter exp.Filter `yaml:"filter"`
+}
+
+type ZoneConfig struct {
+	Name string `yaml:"name"`
+	// "<dir>/<name>.zone" when not set
+	File string   `yaml:"file"`
+	NS   []string `yaml:"ns"`
+	// SOA contact, hostmaster.<zone> when not set
+	Mbox string `yaml:"mbox"`
+
+	Reload reload.Config `yaml:"reload"`
+}
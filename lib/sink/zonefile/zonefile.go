@@ -0,0 +1,231 @@
+package zonefile
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ShimmerGlass/shimdns/lib/atomicfile"
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	dnssrv "github.com/miekg/dns"
+	"github.com/samber/lo"
+)
+
+const (
+	defaultTTL = 300
+
+	soaRefresh = 3600
+	soaRetry   = 600
+	soaExpire  = 86400
+)
+
+type ZoneFile struct {
+	log *slog.Logger
+	cfg Config
+
+	// zones written whose reload did not succeed yet
+	reloadPending map[string]bool
+}
+
+func New(log *slog.Logger, cfg Config) (*ZoneFile, error) {
+	if cfg.TTL == 0 {
+		cfg.TTL = defaultTTL
+	}
+
+	cfg.Zones = slices.Clone(cfg.Zones)
+	for i, z := range cfg.Zones {
+		if z.Name == "" {
+			return nil, fmt.Errorf("zone #%d: missing name", i)
+		}
+
+		z.Name = strings.ToLower(dnssrv.CanonicalName(z.Name))
+
+		if len(z.NS) == 0 {
+			return nil, fmt.Errorf("zone %s: missing ns", z.Name)
+		}
+		z.NS = lo.Map(z.NS, func(ns string, _ int) string { return dnssrv.CanonicalName(ns) })
+
+		if z.Mbox == "" {
+			z.Mbox = "hostmaster." + z.Name
+		}
+		z.Mbox = dnssrv.CanonicalName(z.Mbox)
+
+		if z.File == "" {
+			if cfg.Dir == "" {
+				return nil, fmt.Errorf("zone %s: no file and no dir set", z.Name)
+			}
+
+			z.File = filepath.Join(cfg.Dir, strings.TrimSuffix(z.Name, ".")+".zone")
+		}
+
+		err := z.Reload.Validate()
+		if err != nil {
+			return nil, fmt.Errorf("zone %s: reload: %w", z.Name, err)
+		}
+
+		cfg.Zones[i] = z
+	}
+
+	return &ZoneFile{
+		log:           log.With("sink", "zonefile"),
+		cfg:           cfg,
+		reloadPending: map[string]bool{},
+	}, nil
+}
+
+func (z *ZoneFile) Write(ctx context.Context, records []dns.Record) error {
+	err := z.write(ctx, records)
+	if err != nil {
+		return fmt.Errorf("zonefile sink: %w", err)
+	}
+
+	return nil
+}
+
+func (z *ZoneFile) write(ctx context.Context, records []dns.Record) error {
+	records, err := z.cfg.Filter.Filter(records)
+	if err != nil {
+		return err
+	}
+
+	byZone := map[string][]dnssrv.RR{}
+	for _, rec := range records {
+		zone := z.zoneFor(rec.Name)
+		if zone == "" {
+			continue
+		}
+
+		rr, ok := rec.RR(z.cfg.TTL)
+		if !ok {
+			continue
+		}
+
+		byZone[zone] = append(byZone[zone], rr)
+	}
+
+	for _, zcfg := range z.cfg.Zones {
+		err := z.writeZone(ctx, zcfg, byZone[zcfg.Name])
+		if err != nil {
+			return fmt.Errorf("zone %s: %w", zcfg.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (z *ZoneFile) writeZone(ctx context.Context, zcfg ZoneConfig, rrs []dnssrv.RR) error {
+	current, err := os.ReadFile(zcfg.File)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	serial := currentSerial(current, zcfg)
+	if !bytes.Equal(current, z.render(zcfg, serial, rrs)) {
+		serial = nextSerial(serial, time.Now())
+
+		err = atomicfile.Write(zcfg.File, z.render(zcfg, serial, rrs), 0o644)
+		if err != nil {
+			return err
+		}
+
+		z.log.Info("zone file updated", "zone", zcfg.Name, "file", zcfg.File, "serial", serial)
+		z.reloadPending[zcfg.Name] = true
+	}
+
+	if !z.reloadPending[zcfg.Name] {
+		return nil
+	}
+
+	err = zcfg.Reload.Run(ctx)
+	if err != nil {
+		return err
+	}
+
+	delete(z.reloadPending, zcfg.Name)
+
+	return nil
+}
+
+func (z *ZoneFile) render(zcfg ZoneConfig, serial uint32, rrs []dnssrv.RR) []byte {
+	buf := &bytes.Buffer{}
+
+	fmt.Fprintf(buf, "$ORIGIN %s\n", zcfg.Name)
+	fmt.Fprintf(buf, "$TTL %d\n", z.cfg.TTL)
+	fmt.Fprintf(buf, "@\tIN\tSOA\t%s %s %d %d %d %d %d\n",
+		zcfg.NS[0], zcfg.Mbox, serial, soaRefresh, soaRetry, soaExpire, z.cfg.TTL)
+
+	for _, ns := range zcfg.NS {
+		fmt.Fprintf(buf, "@\tIN\tNS\t%s\n", ns)
+	}
+
+	lines := []string{}
+	for _, rr := range rrs {
+		hdr := rr.Header()
+		rdata := strings.TrimPrefix(rr.String(), hdr.String())
+
+		lines = append(lines, fmt.Sprintf("%s\tIN\t%s\t%s\n",
+			relative(hdr.Name, zcfg.Name), dnssrv.TypeToString[hdr.Rrtype], rdata))
+	}
+
+	// sources do not guarantee ordering, keep the output stable to avoid
+	// needless serial bumps
+	slices.Sort(lines)
+	lines = slices.Compact(lines)
+
+	for _, l := range lines {
+		buf.WriteString(l)
+	}
+
+	return buf.Bytes()
+}
+
+// zoneFor returns the most specific configured zone containing name.
+func (z *ZoneFile) zoneFor(name string) string {
+	name = strings.ToLower(dnssrv.CanonicalName(name))
+	res := ""
+
+	for _, zcfg := range z.cfg.Zones {
+		if dnssrv.IsSubDomain(zcfg.Name, name) && len(zcfg.Name) > len(res) {
+			res = zcfg.Name
+		}
+	}
+
+	return res
+}
+
+func relative(name string, origin string) string {
+	name = strings.ToLower(dnssrv.CanonicalName(name))
+	if name == origin {
+		return "@"
+	}
+
+	return strings.TrimSuffix(name, "."+origin)
+}
+
+// currentSerial returns the SOA serial of a previously written zone file.
+func currentSerial(content []byte, zcfg ZoneConfig) uint32 {
+	zp := dnssrv.NewZoneParser(bytes.NewReader(content), zcfg.Name, zcfg.File)
+
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		if soa, ok := rr.(*dnssrv.SOA); ok {
+			return soa.Serial
+		}
+	}
+
+	return 0
+}
+
+// nextSerial returns a YYYYMMDDnn serial greater than serial.
+func nextSerial(serial uint32, now time.Time) uint32 {
+	date, _ := strconv.ParseUint(now.UTC().Format("20060102")+"00", 10, 32)
+
+	return max(serial+1, uint32(date))
+}
@@ -0,0 +1,127 @@
+package zonefile
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	"github.com/ShimmerGlass/shimdns/lib/reload"
+	dnssrv "github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite(t *testing.T) {
+	dir := t.TempDir()
+
+	z, err := New(slog.Default(), Config{
+		Dir: dir,
+		Zones: []ZoneConfig{
+			{Name: "lan", NS: []string{"ns.lan"}},
+			{Name: "1.168.192.in-addr.arpa", NS: []string{"ns.lan"}},
+		},
+	})
+	require.NoError(t, err)
+
+	recs := []dns.Record{
+		{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.1")},
+		{Type: dns.SRV, Name: "_http._tcp.foo.lan.", Target: "foo.lan.", Port: 80},
+		{Type: dns.PTR, Name: "1.1.168.192.in-addr.arpa.", Ptr: "foo.lan."},
+		{Type: dns.A, Name: "foo.other.", Address: netip.MustParseAddr("192.168.2.1")},
+	}
+
+	require.NoError(t, z.Write(context.Background(), recs))
+
+	path := filepath.Join(dir, "lan.zone")
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	serial := currentSerial(content, z.cfg.Zones[0])
+	require.Equal(t, nextSerial(0, time.Now()), serial)
+	require.Equal(t, `$ORIGIN lan.
+$TTL 300
+@	IN	SOA	ns.lan. hostmaster.lan. `+strconv.FormatUint(uint64(serial), 10)+` 3600 600 86400 300
+@	IN	NS	ns.lan.
+_http._tcp.foo	IN	SRV	0 0 80 foo.lan.
+foo	IN	A	192.168.1.1
+`, string(content))
+
+	// the output is a valid zone file
+	zp := dnssrv.NewZoneParser(bytes.NewReader(content), "", path)
+	names := []string{}
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		names = append(names, rr.Header().Name)
+	}
+	require.NoError(t, zp.Err())
+	require.Equal(t, []string{"lan.", "lan.", "_http._tcp.foo.lan.", "foo.lan."}, names)
+
+	reverse, err := os.ReadFile(filepath.Join(dir, "1.168.192.in-addr.arpa.zone"))
+	require.NoError(t, err)
+	require.Contains(t, string(reverse), "\n1\tIN\tPTR\tfoo.lan.\n")
+
+	// unchanged records keep the serial
+	recs[0], recs[1] = recs[1], recs[0]
+	require.NoError(t, z.Write(context.Background(), recs))
+	content, err = os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, serial, currentSerial(content, z.cfg.Zones[0]))
+
+	recs[1].Address = netip.MustParseAddr("192.168.1.2")
+	require.NoError(t, z.Write(context.Background(), recs))
+	content, err = os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, serial+1, currentSerial(content, z.cfg.Zones[0]))
+}
+
+func TestReloadRetried(t *testing.T) {
+	dir := t.TempDir()
+	ready := filepath.Join(dir, "ready")
+	reloads := filepath.Join(dir, "reloads")
+
+	z, err := New(slog.Default(), Config{
+		Dir: dir,
+		Zones: []ZoneConfig{{
+			Name:   "lan",
+			NS:     []string{"ns.lan"},
+			Reload: reload.Config{Command: "test -f " + ready + " && echo >> " + reloads},
+		}},
+	})
+	require.NoError(t, err)
+
+	recs := []dns.Record{{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.1")}}
+
+	require.Error(t, z.Write(context.Background(), recs))
+
+	// the zone file is already up to date, the reload is still retried
+	require.NoError(t, os.WriteFile(ready, nil, 0o600))
+	require.NoError(t, z.Write(context.Background(), recs))
+	require.NoError(t, z.Write(context.Background(), recs))
+
+	reloaded, err := os.ReadFile(reloads)
+	require.NoError(t, err)
+	require.Equal(t, "\n", string(reloaded))
+}
+
+func TestNewKeepsConfig(t *testing.T) {
+	zones := []ZoneConfig{{Name: "lan", NS: []string{"ns.lan"}}}
+
+	_, err := New(slog.Default(), Config{Dir: t.TempDir(), Zones: zones})
+	require.NoError(t, err)
+	require.Equal(t, []ZoneConfig{{Name: "lan", NS: []string{"ns.lan"}}}, zones)
+}
+
+func TestNextSerial(t *testing.T) {
+	now := time.Date(2025, 3, 4, 12, 0, 0, 0, time.UTC)
+
+	require.EqualValues(t, 2025030400, nextSerial(0, now))
+	require.EqualValues(t, 2025030401, nextSerial(2025030400, now))
+	require.EqualValues(t, 2025030400, nextSerial(2025010105, now))
+	// serials ahead of the date keep increasing
+	require.EqualValues(t, 2025040100, nextSerial(2025040099, now))
+}
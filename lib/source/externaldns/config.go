@@ -0,0 +1,18 @@
+package externaldns
+
+type Config struct {
+	Name string `yaml:"name"`
+
+	// address the webhook provider API listens on, external-dns expects
+	// localhost:8888 by default
+	ListenAddr string `yaml:"listen_addr"`
+	// domains external-dns is allowed to manage
+	DomainFilter []string `yaml:"domain_filter"`
+
+	// sources, as "type" or "type.name", whose records are reported to
+	// external-dns as existing in addition to the ones it applied
+	Sources []string `yaml:"sources"`
+
+	// file the applied records are kept in across restarts
+	StateFile string `yaml:"state_file"`
+}
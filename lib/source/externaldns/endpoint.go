@@ -0,0 +1,118 @@
+package externaldns
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	dnssrv "github.com/miekg/dns"
+)
+
+// endpoint is an external-dns record set.
+type endpoint struct {
+	DNSName          string            `json:"dnsName"`
+	Targets          []string          `json:"targets"`
+	RecordType       string            `json:"recordType"`
+	SetIdentifier    string            `json:"setIdentifier,omitempty"`
+	RecordTTL        int64             `json:"recordTTL,omitempty"`
+	Labels           map[string]string `json:"labels,omitempty"`
+	ProviderSpecific []providerProp    `json:"providerSpecific,omitempty"`
+}
+
+type providerProp struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// changes is the body of apply requests.
+type changes struct {
+	Create    []endpoint `json:"Create"`
+	UpdateOld []endpoint `json:"UpdateOld"`
+	UpdateNew []endpoint `json:"UpdateNew"`
+	Delete    []endpoint `json:"Delete"`
+}
+
+type domainFilter struct {
+	Include []string `json:"include,omitempty"`
+}
+
+func (e endpoint) key() string {
+	return strings.ToLower(strings.TrimSuffix(e.DNSName, ".")) + " " + e.RecordType + " " + e.SetIdentifier
+}
+
+// records returns the records of e. Types shimdns does not handle, such
+// as the TXT records of the external-dns registry, have no records.
+func (e endpoint) records() ([]dns.Record, error) {
+	name := dnssrv.CanonicalName(e.DNSName)
+	res := []dns.Record{}
+
+	for _, target := range e.Targets {
+		rec := dns.Record{Type: dns.Type(e.RecordType), Name: name}
+
+		switch rec.Type {
+		case dns.A, dns.AAAA:
+			addr, err := netip.ParseAddr(target)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", e.DNSName, err)
+			}
+			rec.Address = addr
+
+		case dns.CNAME:
+			rec.Target = dnssrv.CanonicalName(target)
+
+		case dns.PTR:
+			rec.Ptr = dnssrv.CanonicalName(target)
+
+		case dns.SRV:
+			_, err := fmt.Sscanf(target, "%d %d %d %s", &rec.Priority, &rec.Weight, &rec.Port, &rec.Target)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid SRV target %q: %w", e.DNSName, target, err)
+			}
+			rec.Target = dnssrv.CanonicalName(rec.Target)
+
+		case dns.MX:
+			_, err := fmt.Sscanf(target, "%d %s", &rec.Preference, &rec.Mx)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid MX target %q: %w", e.DNSName, target, err)
+			}
+			rec.Mx = dnssrv.CanonicalName(rec.Mx)
+
+		default:
+			return nil, nil
+		}
+
+		res = append(res, rec)
+	}
+
+	return res, nil
+}
+
+// endpoints groups records by name and type.
+func endpoints(records []dns.Record) []endpoint {
+	res := []endpoint{}
+	idx := map[string]int{}
+
+	for _, rec := range records {
+		e := endpoint{
+			DNSName:    strings.TrimSuffix(rec.Name, "."),
+			RecordType: string(rec.Type),
+		}
+
+		target := strings.TrimSuffix(rec.RData(), ".")
+
+		i, ok := idx[e.key()]
+		if !ok {
+			i = len(res)
+			idx[e.key()] = i
+			res = append(res, e)
+		}
+
+		if !slices.Contains(res[i].Targets, target) {
+			res[i].Targets = append(res[i].Targets, target)
+		}
+	}
+
+	return res
+}
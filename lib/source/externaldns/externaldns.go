@@ -0,0 +1,238 @@
+package externaldns
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+)
+
+const Type = "externaldns"
+
+const mediaType = "application/external.dns.webhook+json;version=1"
+
+// ExternalDNS implements the external-dns webhook provider API. Records
+// applied by external-dns are read as a source, and the records of the
+// configured sources are reported back to external-dns as existing.
+type ExternalDNS struct {
+	log *slog.Logger
+	cfg Config
+
+	mu       sync.Mutex
+	applied  map[string]endpoint
+	pipeline []dns.Record
+}
+
+func New(log *slog.Logger, cfg Config) (*ExternalDNS, error) {
+	if cfg.Name == "" {
+		cfg.Name = Type
+	}
+
+	if cfg.ListenAddr == "" {
+		cfg.ListenAddr = "127.0.0.1:8888"
+	}
+
+	e := &ExternalDNS{
+		log:     log.With("source", Type, "source_name", cfg.Name),
+		cfg:     cfg,
+		applied: map[string]endpoint{},
+	}
+
+	err := e.loadState()
+	if err != nil {
+		return nil, fmt.Errorf("state: %w", err)
+	}
+
+	l, err := net.Listen("tcp", e.cfg.ListenAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	go e.serve(l)
+
+	return e, nil
+}
+
+func (e *ExternalDNS) serve(l net.Listener) {
+	e.log.Info("listening", "addr", l.Addr())
+
+	err := http.Serve(l, e.handler())
+	if err != nil {
+		e.log.Error("serve", "err", err)
+	}
+}
+
+func (e *ExternalDNS) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", e.negotiate)
+	mux.HandleFunc("GET /records", e.records)
+	mux.HandleFunc("POST /records", e.applyChanges)
+	mux.HandleFunc("POST /adjustendpoints", e.adjustEndpoints)
+	return mux
+}
+
+func (e *ExternalDNS) Type() string {
+	return Type
+}
+
+func (e *ExternalDNS) Name() string {
+	return e.cfg.Name
+}
+
+func (e *ExternalDNS) Read(ctx context.Context) ([]dns.Record, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	recs := []dns.Record{}
+	for _, ep := range e.applied {
+		epRecs, err := ep.records()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, rec := range epRecs {
+			rec.Source = Type
+			rec.SourceName = e.cfg.Name
+			recs = append(recs, rec)
+		}
+	}
+
+	return recs, nil
+}
+
+// Write receives the pipeline output so records of the configured sources
+// can be reported to external-dns.
+func (e *ExternalDNS) Write(ctx context.Context, records []dns.Record) error {
+	recs := []dns.Record{}
+	for _, rec := range records {
+		if e.reported(rec) {
+			recs = append(recs, rec)
+		}
+	}
+
+	e.mu.Lock()
+	e.pipeline = recs
+	e.mu.Unlock()
+
+	return nil
+}
+
+func (e *ExternalDNS) reported(rec dns.Record) bool {
+	if rec.Source == Type && rec.SourceName == e.cfg.Name {
+		return false
+	}
+
+	for _, src := range e.cfg.Sources {
+		typ, name, hasName := strings.Cut(src, ".")
+		if rec.Source == typ && (!hasName || rec.SourceName == name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (e *ExternalDNS) negotiate(w http.ResponseWriter, r *http.Request) {
+	e.reply(w, domainFilter{Include: e.cfg.DomainFilter})
+}
+
+func (e *ExternalDNS) records(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	res := slices.Collect(maps.Values(e.applied))
+	for _, ep := range endpoints(e.pipeline) {
+		if _, ok := e.applied[ep.key()]; !ok {
+			res = append(res, ep)
+		}
+	}
+	e.mu.Unlock()
+
+	res = slices.DeleteFunc(res, func(ep endpoint) bool { return !e.managed(ep.DNSName) })
+	slices.SortFunc(res, func(a, b endpoint) int { return cmp.Compare(a.key(), b.key()) })
+
+	e.reply(w, res)
+}
+
+func (e *ExternalDNS) applyChanges(w http.ResponseWriter, r *http.Request) {
+	ch := changes{}
+	err := json.NewDecoder(r.Body).Decode(&ch)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// reject the whole change set before applying anything
+	for _, ep := range slices.Concat(ch.Create, ch.UpdateNew) {
+		_, err := ep.records()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, ep := range slices.Concat(ch.Delete, ch.UpdateOld) {
+		e.log.Debug("delete", "name", ep.DNSName, "type", ep.RecordType, "targets", ep.Targets)
+		delete(e.applied, ep.key())
+	}
+
+	for _, ep := range slices.Concat(ch.Create, ch.UpdateNew) {
+		e.log.Debug("set", "name", ep.DNSName, "type", ep.RecordType, "targets", ep.Targets)
+		e.applied[ep.key()] = ep
+	}
+
+	err = e.saveState()
+	if err != nil {
+		e.log.Error("save state", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (e *ExternalDNS) adjustEndpoints(w http.ResponseWriter, r *http.Request) {
+	eps := []endpoint{}
+	err := json.NewDecoder(r.Body).Decode(&eps)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	e.reply(w, eps)
+}
+
+func (e *ExternalDNS) reply(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", mediaType)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		e.log.Error("reply", "err", err)
+	}
+}
+
+// managed reports whether name is within the domain filter.
+func (e *ExternalDNS) managed(name string) bool {
+	if len(e.cfg.DomainFilter) == 0 {
+		return true
+	}
+
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	for _, domain := range e.cfg.DomainFilter {
+		domain = strings.ToLower(strings.Trim(domain, "."))
+		if name == domain || strings.HasSuffix(name, "."+domain) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,146 @@
+package externaldns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ShimmerGlass/shimdns/lib/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvider(t *testing.T) {
+	cfg := Config{
+		ListenAddr:   "127.0.0.1:0",
+		DomainFilter: []string{"lan"},
+		Sources:      []string{"traefik"},
+		StateFile:    filepath.Join(t.TempDir(), "state.json"),
+	}
+
+	e, err := New(slog.Default(), cfg)
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(e.handler())
+	defer srv.Close()
+
+	call := func(method, path string, body any, res any) int {
+		buf, err := json.Marshal(body)
+		require.NoError(t, err)
+
+		req, err := http.NewRequest(method, srv.URL+path, bytes.NewReader(buf))
+		require.NoError(t, err)
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer func() { _ = resp.Body.Close() }()
+
+		if res != nil {
+			require.Equal(t, mediaType, resp.Header.Get("Content-Type"))
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(res))
+		}
+
+		return resp.StatusCode
+	}
+
+	filter := domainFilter{}
+	call(http.MethodGet, "/", nil, &filter)
+	require.Equal(t, []string{"lan"}, filter.Include)
+
+	status := call(http.MethodPost, "/records", changes{
+		Create: []endpoint{
+			{DNSName: "foo.lan", RecordType: "A", Targets: []string{"192.168.1.1", "192.168.1.2"}},
+			{DNSName: "_http._tcp.foo.lan", RecordType: "SRV", Targets: []string{"0 5 80 foo.lan"}},
+			{DNSName: "foo.lan", RecordType: "TXT", Targets: []string{"heritage=external-dns"}},
+		},
+	}, nil)
+	require.Equal(t, http.StatusNoContent, status)
+
+	// invalid change sets are rejected as a whole
+	status = call(http.MethodPost, "/records", changes{
+		Create: []endpoint{
+			{DNSName: "bar.lan", RecordType: "CNAME", Targets: []string{"foo.lan"}},
+			{DNSName: "baz.lan", RecordType: "A", Targets: []string{"invalid"}},
+		},
+	}, nil)
+	require.Equal(t, http.StatusBadRequest, status)
+
+	recs, err := e.Read(context.Background())
+	require.NoError(t, err)
+	require.ElementsMatch(t, []dns.Record{
+		{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.1"), Source: Type, SourceName: Type},
+		{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.2"), Source: Type, SourceName: Type},
+		{Type: dns.SRV, Name: "_http._tcp.foo.lan.", Target: "foo.lan.", Port: 80, Weight: 5, Source: Type, SourceName: Type},
+	}, recs)
+
+	// records of the chosen sources are reported as existing
+	require.NoError(t, e.Write(context.Background(), append(recs,
+		dns.Record{Type: dns.A, Name: "web.lan.", Address: netip.MustParseAddr("10.0.0.1"), Source: "traefik"},
+		dns.Record{Type: dns.A, Name: "web.lan.", Address: netip.MustParseAddr("10.0.0.2"), Source: "traefik"},
+		dns.Record{Type: dns.A, Name: "web.other.", Address: netip.MustParseAddr("10.0.0.3"), Source: "traefik"},
+		dns.Record{Type: dns.A, Name: "dhcp.lan.", Address: netip.MustParseAddr("10.0.0.4"), Source: "mikrotik_dhcp"},
+	)))
+
+	eps := []endpoint{}
+	call(http.MethodGet, "/records", nil, &eps)
+	require.Equal(t, []endpoint{
+		{DNSName: "_http._tcp.foo.lan", RecordType: "SRV", Targets: []string{"0 5 80 foo.lan"}},
+		{DNSName: "foo.lan", RecordType: "A", Targets: []string{"192.168.1.1", "192.168.1.2"}},
+		{DNSName: "foo.lan", RecordType: "TXT", Targets: []string{"heritage=external-dns"}},
+		{DNSName: "web.lan", RecordType: "A", Targets: []string{"10.0.0.1", "10.0.0.2"}},
+	}, eps)
+
+	adjusted := []endpoint{}
+	call(http.MethodPost, "/adjustendpoints", eps[:1], &adjusted)
+	require.Equal(t, eps[:1], adjusted)
+
+	status = call(http.MethodPost, "/records", changes{
+		UpdateOld: []endpoint{{DNSName: "foo.lan", RecordType: "A", Targets: []string{"192.168.1.1", "192.168.1.2"}}},
+		UpdateNew: []endpoint{{DNSName: "foo.lan", RecordType: "A", Targets: []string{"192.168.1.3"}}},
+		Delete:    []endpoint{{DNSName: "_http._tcp.foo.lan", RecordType: "SRV", Targets: []string{"0 5 80 foo.lan"}}},
+	}, nil)
+	require.Equal(t, http.StatusNoContent, status)
+
+	// applied records survive restarts
+	e, err = New(slog.Default(), cfg)
+	require.NoError(t, err)
+
+	recs, err = e.Read(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []dns.Record{
+		{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.3"), Source: Type, SourceName: Type},
+	}, recs)
+}
+
+func TestListenError(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = l.Close() }()
+
+	_, err = New(slog.Default(), Config{ListenAddr: l.Addr().String()})
+	require.Error(t, err)
+}
+
+func TestInvalidState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"entries": [
+		{"dnsName": "foo.lan", "recordType": "A", "targets": ["192.168.1.1"]},
+		{"dnsName": "bar.lan", "recordType": "A", "targets": ["invalid"]}
+	]}`), 0o600))
+
+	e, err := New(slog.Default(), Config{ListenAddr: "127.0.0.1:0", StateFile: path})
+	require.NoError(t, err)
+
+	recs, err := e.Read(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []dns.Record{
+		{Type: dns.A, Name: "foo.lan.", Address: netip.MustParseAddr("192.168.1.1"), Source: Type, SourceName: Type},
+	}, recs)
+}
@@ -0,0 +1,43 @@
+package externaldns
+
+import (
+	"cmp"
+	"maps"
+	"slices"
+
+	"github.com/ShimmerGlass/shimdns/lib/statefile"
+)
+
+func (e *ExternalDNS) loadState() error {
+	if e.cfg.StateFile == "" {
+		return nil
+	}
+
+	eps, err := statefile.Load[endpoint](e.cfg.StateFile)
+	if err != nil {
+		return err
+	}
+
+	for _, ep := range eps {
+		// an invalid entry would fail every read, drop it
+		_, err := ep.records()
+		if err != nil {
+			e.log.Warn("invalid endpoint in state file, dropping", "err", err)
+			continue
+		}
+
+		e.applied[ep.key()] = ep
+	}
+
+	return nil
+}
+
+func (e *ExternalDNS) saveState() error {
+	if e.cfg.StateFile == "" {
+		return nil
+	}
+
+	return statefile.Save(e.cfg.StateFile, slices.SortedFunc(maps.Values(e.applied), func(a, b endpoint) int {
+		return cmp.Compare(a.key(), b.key())
+	}))
+}
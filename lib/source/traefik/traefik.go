@@ -7,6 +7,8 @@ import (
 	"log/slog"
 	"net/netip"
 	"regexp"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/ShimmerGlass/shimdns/lib/dns"
@@ -191,9 +193,11 @@ func (t *Traefik) routers(ctx context.Context) ([]router, error) {
 }
 
 var hostReg = regexp.MustCompile("Host\\(['\"`]([^'\"`]+)['\"`]\\)")
+var hostRegexpReg = regexp.MustCompile("HostRegexp\\(['\"`]([^'\"`]+)['\"`]\\)")
 
 func routersHosts(router router) iter.Seq[string] {
 	matches := hostReg.FindAllStringSubmatch(router.Rule, -1)
+	regexpMatches := hostRegexpReg.FindAllStringSubmatch(router.Rule, -1)
 
 	return func(yield func(string) bool) {
 		for _, g := range matches {
@@ -201,5 +205,65 @@ func routersHosts(router router) iter.Seq[string] {
 				return
 			}
 		}
+
+		for _, g := range regexpMatches {
+			host, ok := hostRegexpWildcard(g[1])
+			if !ok {
+				continue
+			}
+
+			if !yield(host) {
+				return
+			}
+		}
+	}
+}
+
+const regexpChars = `\^$.*+?()[]{}|`
+
+// wildcardLabels are the first label patterns matching any single label,
+// narrower patterns cannot be expressed as a wildcard name.
+var wildcardLabels = []string{`.+`, `.*`, `[^.]+`}
+
+// hostRegexpWildcard converts a HostRegexp pattern whose first label
+// matches anything and is the only variable part, such as `^.+\.apps\.lan$`
+// or `{sub}.apps.lan`, into a wildcard name.
+func hostRegexpWildcard(pattern string) (string, bool) {
+	pattern = strings.TrimPrefix(pattern, "^")
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	// literal holds the rest of the pattern without its escaped dots, and
+	// must not contain any other regexp syntax
+	var rest, literal string
+
+	if strings.HasPrefix(pattern, "{") {
+		// traefik v2 syntax, dots are literal and a bare variable matches
+		// a single label
+		end := strings.Index(pattern, "}.")
+		if end < 0 {
+			return "", false
+		}
+
+		_, expr, ok := strings.Cut(pattern[1:end], ":")
+		if ok && !slices.Contains(wildcardLabels, expr) {
+			return "", false
+		}
+
+		rest = pattern[end+2:]
+		literal = strings.ReplaceAll(rest, ".", "")
+	} else {
+		label, after, ok := strings.Cut(pattern, `\.`)
+		if !ok || !slices.Contains(wildcardLabels, label) {
+			return "", false
+		}
+
+		rest = strings.ReplaceAll(after, `\.`, ".")
+		literal = strings.ReplaceAll(after, `\.`, "")
+	}
+
+	if rest == "" || strings.ContainsAny(literal, regexpChars) {
+		return "", false
 	}
+
+	return "*." + rest, true
 }
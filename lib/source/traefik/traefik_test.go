@@ -0,0 +1,44 @@
+package traefik
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostRegexpWildcard(t *testing.T) {
+	tests := []struct {
+		pattern string
+		host    string
+	}{
+		{pattern: `^.+\.apps\.lan$`, host: "*.apps.lan"},
+		{pattern: `.*\.apps\.lan`, host: "*.apps.lan"},
+		{pattern: `^[^.]+\.apps\.lan$`, host: "*.apps.lan"},
+		{pattern: `{sub}.apps.lan`, host: "*.apps.lan"},
+		{pattern: `{sub:[^.]+}.apps.lan`, host: "*.apps.lan"},
+
+		// narrower than any label
+		{pattern: `^app-.+\.lan$`},
+		{pattern: `^(foo|bar)\.apps\.lan$`},
+		{pattern: `^[a-z]+\.apps\.lan$`},
+		{pattern: `{sub:[a-z]+}.apps.lan`},
+		{pattern: `{sub:[a-z]{2}}.apps.lan`},
+
+		// variable parts beyond the first label
+		{pattern: `^.+\.apps\.(lan|home)$`},
+		{pattern: `^.+\..+\.lan$`},
+		{pattern: `{sub}.{env}.lan`},
+
+		// no name left
+		{pattern: `^.+$`},
+		{pattern: `{sub}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			host, ok := hostRegexpWildcard(tt.pattern)
+			require.Equal(t, tt.host != "", ok)
+			require.Equal(t, tt.host, host)
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package statefile
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+
+	"github.com/ShimmerGlass/shimdns/lib/atomicfile"
+)
+
+// file holds what a sink created on a backend it shares with others. It
+// is kept across restarts, without it records created before a restart
+// would never be removed.
+type file[T any] struct {
+	Entries []T `json:"entries"`
+}
+
+// Load returns the entries saved at path, none when the file does not exist
+// yet.
+func Load[T any](path string) ([]T, error) {
+	buf, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	f := file[T]{}
+	err = json.Unmarshal(buf, &f)
+	if err != nil {
+		return nil, err
+	}
+
+	return f.Entries, nil
+}
+
+// Save replaces the entries saved at path. Callers keep entries sorted so
+// the file only changes with its content.
+func Save[T any](path string, entries []T) error {
+	if entries == nil {
+		entries = []T{}
+	}
+
+	buf, err := json.MarshalIndent(file[T]{Entries: entries}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return atomicfile.Write(path, buf, 0o600)
+}
@@ -0,0 +1,22 @@
+package statefile
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	entries, err := Load[string](path)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	require.NoError(t, Save(path, []string{"a", "b"}))
+
+	entries, err = Load[string](path)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b"}, entries)
+}
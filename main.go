@@ -9,6 +9,7 @@ import (
 	"os"
 
 	"github.com/ShimmerGlass/shimdns/lib/prov"
+	"github.com/ShimmerGlass/shimdns/lib/sink"
 )
 
 func main() {
@@ -53,6 +54,13 @@ func run() error {
 		return err
 	}
 
+	// sources reporting the pipeline output back, such as externaldns
+	for _, src := range sources {
+		if s, ok := src.(sink.Sink); ok {
+			sinks = append(sinks, s)
+		}
+	}
+
 	prov, err := prov.New(log, cfg.Interval, sources, modifiers, sinks)
 	if err != nil {
 		return err
@@ -4,20 +4,53 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"strconv"
 
 	"github.com/ShimmerGlass/shimdns/lib/sink"
+	"github.com/ShimmerGlass/shimdns/lib/sink/adguard"
+	"github.com/ShimmerGlass/shimdns/lib/sink/cloudflare"
 	"github.com/ShimmerGlass/shimdns/lib/sink/dashboard"
+	"github.com/ShimmerGlass/shimdns/lib/sink/dnsmasq"
 	"github.com/ShimmerGlass/shimdns/lib/sink/dnsserver"
+	"github.com/ShimmerGlass/shimdns/lib/sink/etcd"
+	"github.com/ShimmerGlass/shimdns/lib/sink/hostsfile"
 	httpsink "github.com/ShimmerGlass/shimdns/lib/sink/http"
+	"github.com/ShimmerGlass/shimdns/lib/sink/libdns"
+	"github.com/ShimmerGlass/shimdns/lib/sink/mdns"
 	"github.com/ShimmerGlass/shimdns/lib/sink/mikrotik"
+	"github.com/ShimmerGlass/shimdns/lib/sink/opnsense"
+	"github.com/ShimmerGlass/shimdns/lib/sink/pihole"
+	"github.com/ShimmerGlass/shimdns/lib/sink/powerdns"
+	"github.com/ShimmerGlass/shimdns/lib/sink/rfc2136"
+	"github.com/ShimmerGlass/shimdns/lib/sink/route53"
+	"github.com/ShimmerGlass/shimdns/lib/sink/technitium"
+	"github.com/ShimmerGlass/shimdns/lib/sink/unbound"
+	"github.com/ShimmerGlass/shimdns/lib/sink/webhook"
+	"github.com/ShimmerGlass/shimdns/lib/sink/zonefile"
 	"gopkg.in/yaml.v3"
 )
 
 const (
-	sinkDashboard = "dashboard"
-	sinkMikrotik  = "mikrotik"
-	sinkDNSServer = "dnsserver"
-	sinkHTTP      = "http"
+	sinkDashboard  = "dashboard"
+	sinkMikrotik   = "mikrotik"
+	sinkDNSServer  = "dnsserver"
+	sinkHTTP       = "http"
+	sinkMDNS       = "mdns"
+	sinkRFC2136    = "rfc2136"
+	sinkHostsFile  = "hostsfile"
+	sinkZoneFile   = "zonefile"
+	sinkDnsmasq    = "dnsmasq"
+	sinkUnbound    = "unbound"
+	sinkPowerDNS   = "powerdns"
+	sinkCloudflare = "cloudflare"
+	sinkRoute53    = "route53"
+	sinkLibDNS     = "libdns"
+	sinkPiHole     = "pihole"
+	sinkAdGuard    = "adguard"
+	sinkOPNsense   = "opnsense"
+	sinkTechnitium = "technitium"
+	sinkEtcd       = "etcd"
+	sinkWebhook    = "webhook"
 )
 
 type SinkConfig struct {
@@ -65,6 +98,134 @@ func (s *SinkConfig) UnmarshalYAML(node *yaml.Node) error {
 		}
 		s.Cfg = rcfg
 
+	case sinkMDNS:
+		rcfg := mdns.Config{}
+		err = node.Decode(&rcfg)
+		if err != nil {
+			return err
+		}
+		s.Cfg = rcfg
+
+	case sinkRFC2136:
+		rcfg := rfc2136.Config{}
+		err = node.Decode(&rcfg)
+		if err != nil {
+			return err
+		}
+		s.Cfg = rcfg
+
+	case sinkHostsFile:
+		rcfg := hostsfile.Config{}
+		err = node.Decode(&rcfg)
+		if err != nil {
+			return err
+		}
+		s.Cfg = rcfg
+
+	case sinkZoneFile:
+		rcfg := zonefile.Config{}
+		err = node.Decode(&rcfg)
+		if err != nil {
+			return err
+		}
+		s.Cfg = rcfg
+
+	case sinkDnsmasq:
+		rcfg := dnsmasq.Config{}
+		err = node.Decode(&rcfg)
+		if err != nil {
+			return err
+		}
+		s.Cfg = rcfg
+
+	case sinkUnbound:
+		rcfg := unbound.Config{}
+		err = node.Decode(&rcfg)
+		if err != nil {
+			return err
+		}
+		s.Cfg = rcfg
+
+	case sinkPowerDNS:
+		rcfg := powerdns.Config{}
+		err = node.Decode(&rcfg)
+		if err != nil {
+			return err
+		}
+		s.Cfg = rcfg
+
+	case sinkCloudflare:
+		rcfg := cloudflare.Config{}
+		err = node.Decode(&rcfg)
+		if err != nil {
+			return err
+		}
+		s.Cfg = rcfg
+
+	case sinkRoute53:
+		rcfg := route53.Config{}
+		err = node.Decode(&rcfg)
+		if err != nil {
+			return err
+		}
+		s.Cfg = rcfg
+
+	case sinkLibDNS:
+		rcfg := libdns.Config{}
+		err = node.Decode(&rcfg)
+		if err != nil {
+			return err
+		}
+		s.Cfg = rcfg
+
+	case sinkPiHole:
+		rcfg := pihole.Config{}
+		err = node.Decode(&rcfg)
+		if err != nil {
+			return err
+		}
+		s.Cfg = rcfg
+
+	case sinkAdGuard:
+		rcfg := adguard.Config{}
+		err = node.Decode(&rcfg)
+		if err != nil {
+			return err
+		}
+		s.Cfg = rcfg
+
+	case sinkOPNsense:
+		rcfg := opnsense.Config{}
+		err = node.Decode(&rcfg)
+		if err != nil {
+			return err
+		}
+		s.Cfg = rcfg
+
+	case sinkTechnitium:
+		rcfg := technitium.Config{}
+		err = node.Decode(&rcfg)
+		if err != nil {
+			return err
+		}
+		s.Cfg = rcfg
+
+	case sinkEtcd:
+		rcfg := etcd.Config{}
+		err = node.Decode(&rcfg)
+		if err != nil {
+			return err
+		}
+		s.Cfg = rcfg
+
+	case sinkWebhook:
+		rcfg := webhook.Config{}
+		err = node.Decode(&rcfg)
+		if err != nil {
+			return err
+		}
+		s.Cfg = rcfg
+
 	default:
 		return fmt.Errorf("unknown sink type %q", cfg.Type)
 	}
@@ -74,6 +235,9 @@ func (s *SinkConfig) UnmarshalYAML(node *yaml.Node) error {
 
 func loadSinks(log *slog.Logger, cfg Config, httpMux *http.ServeMux) ([]sink.Sink, error) {
 	sinks := []sink.Sink{}
+	dashboards := []*dashboard.Dashboard{}
+	dnsServers := []*dnsserver.DNSServer{}
+	dnsServerAddrs := []string{}
 
 	for _, anySinkCfg := range cfg.Sinks {
 		switch sinkCfg := anySinkCfg.Cfg.(type) {
@@ -85,6 +249,7 @@ func loadSinks(log *slog.Logger, cfg Config, httpMux *http.ServeMux) ([]sink.Sin
 			}
 
 			sinks = append(sinks, src)
+			dashboards = append(dashboards, src)
 
 		case mikrotik.Config:
 			src, err := mikrotik.New(log, sinkCfg)
@@ -92,15 +257,17 @@ func loadSinks(log *slog.Logger, cfg Config, httpMux *http.ServeMux) ([]sink.Sin
 				return nil, fmt.Errorf("mikrotik: %w", err)
 			}
 
-			sinks = append(sinks, src)
+			sinks = append(sinks, sink.WithoutWildcards(log.With("sink", "mikrotik"), src))
 
 		case dnsserver.Config:
-			src, err := dnsserver.New(log, sinkCfg)
+			src, err := dnsserver.New(log, sinkCfg, httpMux)
 			if err != nil {
 				return nil, fmt.Errorf("dnsserver: %w", err)
 			}
 
 			sinks = append(sinks, src)
+			dnsServers = append(dnsServers, src)
+			dnsServerAddrs = append(dnsServerAddrs, sinkCfg.ListenAddr)
 
 		case httpsink.Config:
 			src, err := httpsink.New(log, sinkCfg, httpMux)
@@ -110,10 +277,175 @@ func loadSinks(log *slog.Logger, cfg Config, httpMux *http.ServeMux) ([]sink.Sin
 
 			sinks = append(sinks, src)
 
+		case mdns.Config:
+			src, err := mdns.New(log, sinkCfg)
+			if err != nil {
+				return nil, fmt.Errorf("mdns: %w", err)
+			}
+
+			sinks = append(sinks, sink.WithoutWildcards(log.With("sink", "mdns"), src))
+
+		case rfc2136.Config:
+			src, err := rfc2136.New(log, sinkCfg)
+			if err != nil {
+				return nil, fmt.Errorf("rfc2136: %w", err)
+			}
+
+			sinks = append(sinks, src)
+
+		case hostsfile.Config:
+			src, err := hostsfile.New(log, sinkCfg)
+			if err != nil {
+				return nil, fmt.Errorf("hostsfile: %w", err)
+			}
+
+			sinks = append(sinks, sink.WithoutWildcards(log.With("sink", "hostsfile"), src))
+
+		case zonefile.Config:
+			src, err := zonefile.New(log, sinkCfg)
+			if err != nil {
+				return nil, fmt.Errorf("zonefile: %w", err)
+			}
+
+			sinks = append(sinks, src)
+
+		case dnsmasq.Config:
+			src, err := dnsmasq.New(log, sinkCfg)
+			if err != nil {
+				return nil, fmt.Errorf("dnsmasq: %w", err)
+			}
+
+			sinks = append(sinks, sink.WithoutWildcards(log.With("sink", "dnsmasq"), src))
+
+		case unbound.Config:
+			src, err := unbound.New(log, sinkCfg)
+			if err != nil {
+				return nil, fmt.Errorf("unbound: %w", err)
+			}
+
+			sinks = append(sinks, sink.WithoutWildcards(log.With("sink", "unbound"), src))
+
+		case powerdns.Config:
+			src, err := powerdns.New(log, sinkCfg)
+			if err != nil {
+				return nil, fmt.Errorf("powerdns: %w", err)
+			}
+
+			sinks = append(sinks, src)
+
+		case cloudflare.Config:
+			src, err := cloudflare.New(log, sinkCfg)
+			if err != nil {
+				return nil, fmt.Errorf("cloudflare: %w", err)
+			}
+
+			sinks = append(sinks, src)
+
+		case route53.Config:
+			src, err := route53.New(log, sinkCfg)
+			if err != nil {
+				return nil, fmt.Errorf("route53: %w", err)
+			}
+
+			sinks = append(sinks, src)
+
+		case libdns.Config:
+			src, err := libdns.New(log, sinkCfg)
+			if err != nil {
+				return nil, fmt.Errorf("libdns: %w", err)
+			}
+
+			sinks = append(sinks, src)
+
+		case pihole.Config:
+			src, err := pihole.New(log, sinkCfg)
+			if err != nil {
+				return nil, fmt.Errorf("pihole: %w", err)
+			}
+
+			sinks = append(sinks, sink.WithoutWildcards(log.With("sink", "pihole"), src))
+
+		case adguard.Config:
+			src, err := adguard.New(log, sinkCfg)
+			if err != nil {
+				return nil, fmt.Errorf("adguard: %w", err)
+			}
+
+			sinks = append(sinks, src)
+
+		case opnsense.Config:
+			src, err := opnsense.New(log, sinkCfg)
+			if err != nil {
+				return nil, fmt.Errorf("opnsense: %w", err)
+			}
+
+			sinks = append(sinks, src)
+
+		case technitium.Config:
+			src, err := technitium.New(log, sinkCfg)
+			if err != nil {
+				return nil, fmt.Errorf("technitium: %w", err)
+			}
+
+			sinks = append(sinks, src)
+
+		case etcd.Config:
+			src, err := etcd.New(log, sinkCfg)
+			if err != nil {
+				return nil, fmt.Errorf("etcd: %w", err)
+			}
+
+			sinks = append(sinks, sink.WithoutWildcards(log.With("sink", "etcd"), src))
+
+		case webhook.Config:
+			src, err := webhook.New(log, sinkCfg)
+			if err != nil {
+				return nil, fmt.Errorf("webhook: %w", err)
+			}
+
+			sinks = append(sinks, src)
+
 		default:
 			return nil, fmt.Errorf("unknown sink type %s", anySinkCfg.Type)
 		}
 	}
 
+	for _, dash := range dashboards {
+		for i, srv := range dnsServers {
+			dash.AddCounters("DNS server "+dnsServerAddrs[i], func() []dashboard.Counter {
+				return dnsServerCounters(srv.Stats())
+			})
+		}
+	}
+
 	return sinks, nil
 }
+
+func dnsServerCounters(s dnsserver.Stats) []dashboard.Counter {
+	counters := []dashboard.Counter{
+		{Name: "Queries", Value: strconv.FormatUint(s.Queries, 10)},
+		{Name: "Refused", Value: strconv.FormatUint(s.Refused, 10)},
+		{Name: "Rate limited", Value: strconv.FormatUint(s.Dropped+s.Truncated, 10)},
+	}
+
+	if s.Blocked > 0 || s.BlocklistSize > 0 {
+		counters = append(counters,
+			dashboard.Counter{Name: "Blocked", Value: strconv.FormatUint(s.Blocked, 10)},
+			dashboard.Counter{Name: "Blocklist domains", Value: strconv.Itoa(s.BlocklistSize)},
+		)
+	}
+
+	for _, n := range s.Notify {
+		value := fmt.Sprintf("serial %d acknowledged", n.Serial)
+		switch {
+		case n.Attempts == 0:
+			value = fmt.Sprintf("serial %d sending", n.Serial)
+		case !n.Acknowledged:
+			value = fmt.Sprintf("serial %d failed after %d attempts: %s", n.Serial, n.Attempts, n.Err)
+		}
+
+		counters = append(counters, dashboard.Counter{Name: "Notify " + n.Zone + " " + n.Secondary, Value: value})
+	}
+
+	return counters
+}
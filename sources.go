@@ -5,6 +5,7 @@ import (
 	"log/slog"
 
 	"github.com/ShimmerGlass/shimdns/lib/source"
+	"github.com/ShimmerGlass/shimdns/lib/source/externaldns"
 	httpsource "github.com/ShimmerGlass/shimdns/lib/source/http"
 	mikrotikdhcp "github.com/ShimmerGlass/shimdns/lib/source/mikrotik_dhcp"
 	"github.com/ShimmerGlass/shimdns/lib/source/netbox"
@@ -62,6 +63,14 @@ func (s *SourceConfig) UnmarshalYAML(node *yaml.Node) error {
 		}
 		s.Cfg = rcfg
 
+	case externaldns.Type:
+		rcfg := externaldns.Config{}
+		err = node.Decode(&rcfg)
+		if err != nil {
+			return err
+		}
+		s.Cfg = rcfg
+
 	default:
 		return fmt.Errorf("unknown source type %q", cfg.Type)
 	}
@@ -90,6 +99,9 @@ func loadSources(log *slog.Logger, cfg Config) ([]source.Source, error) {
 		case mikrotikdhcp.Config:
 			src, err = mikrotikdhcp.New(log, srcCfg)
 
+		case externaldns.Config:
+			src, err = externaldns.New(log, srcCfg)
+
 		default:
 			return nil, fmt.Errorf("source #%d: unknown type %q", i, anySrcCfg.Type)
 		}